@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	redisv9 "github.com/redis/go-redis/v9"
+
+	"github.com/dora-network/dora-service-utils/candles/types"
+	"github.com/dora-network/dora-service-utils/redis"
+)
+
+// CandlesKey returns the key of the sorted set holding an order book's candles at a resolution.
+// Candles are scored by their start time in unix seconds.
+func CandlesKey(orderBookID string, resolution types.Resolution) string {
+	return fmt.Sprintf("candles:%s:%s", orderBookID, resolution)
+}
+
+// SetCandles writes candles to Redis, replacing any stored candle with the same start time.
+// If retention is positive, only the latest retention candles of each affected sorted set are kept.
+func SetCandles(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	retention int64,
+	candles ...*types.Candle,
+) error {
+	watch := make([]string, 0, len(candles))
+	for _, c := range candles {
+		watch = append(watch, CandlesKey(c.OrderBookID, c.Resolution))
+	}
+
+	txFunc := func(tx *redisv9.Tx) error {
+		_, err := tx.TxPipelined(
+			ctx, func(pipe redisv9.Pipeliner) error {
+				SetCandlesCmd(ctx, pipe, candles...)
+				if retention > 0 {
+					for _, key := range watch {
+						pipe.ZRemRangeByRank(ctx, key, 0, -retention-1)
+					}
+				}
+				return nil
+			},
+		)
+		return err
+	}
+
+	return redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		watch...,
+	)
+}
+
+// SetCandlesCmd queues the commands which replace stored candles with the given ones.
+func SetCandlesCmd(ctx context.Context, tx redis.Cmdable, candles ...*types.Candle) []redisv9.Cmder {
+	cmds := make([]redisv9.Cmder, 0, 2*len(candles))
+	for _, c := range candles {
+		key := CandlesKey(c.OrderBookID, c.Resolution)
+		start := strconv.FormatInt(c.Start, 10)
+		// a candle's members change as trades arrive, so the old member is removed by score
+		cmds = append(
+			cmds,
+			tx.ZRemRangeByScore(ctx, key, start, start),
+			tx.ZAdd(ctx, key, redisv9.Z{Score: float64(c.Start), Member: c}),
+		)
+	}
+	return cmds
+}
+
+// GetCandles returns an order book's stored candles which start in [from, to), sorted by start time.
+func GetCandles(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	orderBookID string,
+	resolution types.Resolution,
+	from, to time.Time,
+) ([]*types.Candle, error) {
+	if err := types.ValidateRange(from, to, resolution); err != nil {
+		return nil, err
+	}
+	key := CandlesKey(orderBookID, resolution)
+
+	var candles []*types.Candle
+	f := func(tx *redisv9.Tx) error {
+		res, err := GetCandlesCmd(ctx, tx, orderBookID, resolution, from, to).Result()
+		if err != nil {
+			return err
+		}
+
+		candles = make([]*types.Candle, 0, len(res))
+		for _, v := range res {
+			c := new(types.Candle)
+			if err := c.UnmarshalBinary([]byte(v)); err != nil {
+				return err
+			}
+			candles = append(candles, c)
+		}
+		return nil
+	}
+
+	if err := redis.TryTransaction(
+		ctx,
+		rdb,
+		f,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		key,
+	); err != nil {
+		return nil, err
+	}
+
+	return candles, nil
+}
+
+// GetCandlesCmd queries the candles which start in [from, to). The range is not validated.
+func GetCandlesCmd(
+	ctx context.Context,
+	tx redis.Cmdable,
+	orderBookID string,
+	resolution types.Resolution,
+	from, to time.Time,
+) *redisv9.StringSliceCmd {
+	return tx.ZRangeByScore(
+		ctx, CandlesKey(orderBookID, resolution), &redisv9.ZRangeBy{
+			Min: strconv.FormatInt(from.Unix(), 10),
+			Max: "(" + strconv.FormatInt(to.Unix(), 10),
+		},
+	)
+}
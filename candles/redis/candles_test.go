@@ -0,0 +1,98 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/candles/redis"
+	"github.com/dora-network/dora-service-utils/candles/types"
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/testing/integration"
+)
+
+func TestCandles(t *testing.T) {
+	dn, err := integration.NewDoraNetwork(t)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, dn.Cleanup())
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, dn.CreateRedisResource(t, ctx))
+
+	rdb, err := dn.GetRedisClient()
+	require.NoError(t, err)
+
+	start := time.Date(2024, 8, 12, 20, 0, 0, 0, time.UTC)
+	agg, err := types.NewAggregator("base-quote", time.Minute, 0, types.Resolution1m)
+	require.NoError(t, err)
+
+	t.Run(
+		"Should replace candles with the same start time", func(tt *testing.T) {
+			updated, err := agg.AddTrade(
+				types.Trade{OrderBookID: "base-quote", Price: decimal.MustParse("1.5"), Amount: 10, Time: start},
+			)
+			require.NoError(tt, err)
+			require.NoError(tt, redis.SetCandles(ctx, rdb, time.Second, 0, updated...))
+
+			updated, err = agg.AddTrade(
+				types.Trade{
+					OrderBookID: "base-quote",
+					Price:       decimal.MustParse("1.6"),
+					Amount:      5,
+					Time:        start.Add(time.Second),
+				},
+			)
+			require.NoError(tt, err)
+			require.NoError(tt, redis.SetCandles(ctx, rdb, time.Second, 0, updated...))
+
+			got, err := redis.GetCandles(
+				ctx, rdb, time.Second, "base-quote", types.Resolution1m, start, start.Add(time.Hour),
+			)
+			require.NoError(tt, err)
+			require.Len(tt, got, 1)
+			assert.Equal(tt, updated[0], got[0])
+		},
+	)
+
+	t.Run(
+		"Should keep only the latest candles", func(tt *testing.T) {
+			for i := 1; i < 5; i++ {
+				updated, err := agg.AddTrade(
+					types.Trade{
+						OrderBookID: "base-quote",
+						Price:       decimal.MustParse("1.5"),
+						Amount:      1,
+						Time:        start.Add(time.Duration(i) * time.Minute),
+					},
+				)
+				require.NoError(tt, err)
+				require.NoError(tt, redis.SetCandles(ctx, rdb, time.Second, 3, updated...))
+			}
+
+			got, err := redis.GetCandles(
+				ctx, rdb, time.Second, "base-quote", types.Resolution1m, start, start.Add(time.Hour),
+			)
+			require.NoError(tt, err)
+			require.Len(tt, got, 3)
+			assert.Equal(tt, start.Add(2*time.Minute).Unix(), got[0].Start)
+			assert.Equal(tt, start.Add(4*time.Minute).Unix(), got[2].Start)
+		},
+	)
+
+	t.Run(
+		"Should validate the requested range", func(tt *testing.T) {
+			_, err := redis.GetCandles(
+				ctx, rdb, time.Second, "base-quote", types.Resolution1h, start, start.Add(time.Minute),
+			)
+			require.ErrorIs(tt, err, errors.ErrResolutionHigherThanToMinusFrom)
+		},
+	)
+}
@@ -0,0 +1,139 @@
+package types
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dora-network/dora-service-utils/errors"
+)
+
+// Aggregator maintains candles for a single order book at multiple resolutions.
+// Aggregator is not safe for concurrent use.
+type Aggregator struct {
+	orderBookID string
+	resolutions []Resolution
+	// trades older than the latest trade seen minus grace are rejected
+	grace time.Duration
+	// number of candles kept in memory per resolution. Zero keeps all candles.
+	retention int
+	latest    time.Time
+	candles   map[Resolution]map[int64]*Candle
+}
+
+// NewAggregator creates an Aggregator for an order book. If no resolutions are given, all supported
+// resolutions are maintained. retention is the number of candles kept in memory per resolution (zero
+// keeps everything); older candles are expected to be persisted and queried from Redis instead.
+func NewAggregator(
+	orderBookID string,
+	grace time.Duration,
+	retention int,
+	resolutions ...Resolution,
+) (*Aggregator, error) {
+	if orderBookID == "" {
+		return nil, errors.ErrInvalidInput
+	}
+	if grace < 0 || retention < 0 {
+		return nil, errors.ErrInvalidInput
+	}
+	if len(resolutions) == 0 {
+		resolutions = Resolutions
+	}
+	a := &Aggregator{
+		orderBookID: orderBookID,
+		grace:       grace,
+		retention:   retention,
+		candles:     map[Resolution]map[int64]*Candle{},
+	}
+	for _, r := range resolutions {
+		if r.Duration() == 0 {
+			return nil, errors.ErrInvalidResolution
+		}
+		if retention > 0 && time.Duration(retention-1)*r.Duration() < grace {
+			// a late trade could otherwise land in a candle which was already dropped from memory
+			return nil, errors.Data("retention of %d %s candles does not cover grace window %s", retention, r, grace)
+		}
+		if _, ok := a.candles[r]; ok {
+			continue
+		}
+		a.resolutions = append(a.resolutions, r)
+		a.candles[r] = map[int64]*Candle{}
+	}
+	return a, nil
+}
+
+// AddTrade ingests a trade and returns copies of the candles it updated, one per resolution, which
+// can be published and persisted. A trade is accepted as long as it is no older than the latest trade
+// seen minus the grace window. Late trades within the grace window update already published candles.
+func (a *Aggregator) AddTrade(trade Trade) ([]*Candle, error) {
+	if err := trade.Validate(); err != nil {
+		return nil, err
+	}
+	if trade.OrderBookID != a.orderBookID {
+		return nil, errors.ErrInvalidInput
+	}
+	if trade.Time.Before(a.latest.Add(-a.grace)) {
+		return nil, errors.ErrTradeTooLate
+	}
+
+	// Check all candles first, so a failed trade does not leave candles partially updated
+	updated := make([]*Candle, 0, len(a.resolutions))
+	for _, r := range a.resolutions {
+		candle, ok := a.candles[r][r.Start(trade.Time)]
+		if !ok {
+			updated = append(updated, NewCandle(r, trade))
+			continue
+		}
+		candle = candle.Copy()
+		if err := candle.Add(trade); err != nil {
+			return nil, err
+		}
+		updated = append(updated, candle)
+	}
+
+	result := make([]*Candle, 0, len(updated))
+	for _, candle := range updated {
+		a.candles[candle.Resolution][candle.Start] = candle
+		a.prune(candle.Resolution)
+		result = append(result, candle.Copy())
+	}
+	if trade.Time.After(a.latest) {
+		a.latest = trade.Time
+	}
+	return result, nil
+}
+
+// Candles returns copies of the in-memory candles of a resolution which start in [from, to), sorted by start time.
+// Intervals without trades have no candle.
+func (a *Aggregator) Candles(from, to time.Time, resolution Resolution) ([]*Candle, error) {
+	if err := ValidateRange(from, to, resolution); err != nil {
+		return nil, err
+	}
+	candles, ok := a.candles[resolution]
+	if !ok {
+		return nil, errors.ErrInvalidResolution
+	}
+	result := []*Candle{}
+	for start, candle := range candles {
+		if start >= from.Unix() && start < to.Unix() {
+			result = append(result, candle.Copy())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Start < result[j].Start })
+	return result, nil
+}
+
+// prune drops the oldest candles of a resolution beyond the retention limit.
+func (a *Aggregator) prune(resolution Resolution) {
+	candles := a.candles[resolution]
+	if a.retention == 0 || len(candles) <= a.retention {
+		return
+	}
+	starts := make([]int64, 0, len(candles))
+	for start := range candles {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	for _, start := range starts[:len(starts)-a.retention] {
+		delete(candles, start)
+	}
+}
@@ -0,0 +1,119 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/candles/types"
+	"github.com/dora-network/dora-service-utils/errors"
+)
+
+const orderBookID = "bond1-stable1"
+
+func trade(price string, amount uint64, at time.Time) types.Trade {
+	return types.Trade{
+		OrderBookID: orderBookID,
+		Price:       decimal.MustParse(price),
+		Amount:      amount,
+		Time:        at,
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	require := require.New(t)
+	start := time.Date(2024, 8, 12, 20, 0, 0, 0, time.UTC)
+
+	agg, err := types.NewAggregator(orderBookID, 2*time.Minute, 0, types.Resolution1m, types.Resolution1h)
+	require.NoError(err)
+
+	updated, err := agg.AddTrade(trade("100", 10, start.Add(10*time.Second)))
+	require.NoError(err)
+	require.Len(updated, 2)
+	require.Equal(types.Resolution1m, updated[0].Resolution)
+	require.Equal(start.Unix(), updated[0].Start)
+
+	_, err = agg.AddTrade(trade("105", 5, start.Add(40*time.Second)))
+	require.NoError(err)
+	_, err = agg.AddTrade(trade("98", 1, start.Add(90*time.Second)))
+	require.NoError(err)
+
+	// late trade within the grace window, earlier than every other trade in its candle
+	updated, err = agg.AddTrade(trade("99", 2, start.Add(5*time.Second)))
+	require.NoError(err)
+	minute := updated[0]
+	require.Equal(decimal.MustParse("99"), minute.Open)
+	require.Equal(decimal.MustParse("105"), minute.High)
+	require.Equal(decimal.MustParse("99"), minute.Low)
+	require.Equal(decimal.MustParse("105"), minute.Close)
+	require.Equal(uint64(17), minute.Volume)
+	require.Equal(uint64(3), minute.Trades)
+
+	hour := updated[1]
+	require.Equal(types.Resolution1h, hour.Resolution)
+	require.Equal(decimal.MustParse("99"), hour.Open)
+	require.Equal(decimal.MustParse("98"), hour.Close)
+	require.Equal(uint64(18), hour.Volume)
+
+	// trade older than the grace window
+	_, err = agg.AddTrade(trade("99", 2, start.Add(90*time.Second-3*time.Minute)))
+	require.ErrorIs(err, errors.ErrTradeTooLate)
+	_, err = agg.AddTrade(trade("0", 2, start.Add(90*time.Second)))
+	require.ErrorIs(err, errors.ErrPriceMustBePositive)
+
+	candles, err := agg.Candles(start, start.Add(5*time.Minute), types.Resolution1m)
+	require.NoError(err)
+	require.Len(candles, 2)
+	require.Equal(start.Unix(), candles[0].Start)
+	require.Equal(start.Add(time.Minute).Unix(), candles[1].Start)
+
+	// range validation
+	_, err = agg.Candles(start, start, types.Resolution1m)
+	require.ErrorIs(err, errors.ErrFromMustBeSmallerThanTo)
+	_, err = agg.Candles(start, start.Add(30*time.Minute), types.Resolution1h)
+	require.ErrorIs(err, errors.ErrResolutionHigherThanToMinusFrom)
+	_, err = agg.Candles(start, start.Add(30*time.Minute), types.Resolution5m)
+	require.ErrorIs(err, errors.ErrInvalidResolution) // not maintained by this aggregator
+}
+
+func TestAggregator_Retention(t *testing.T) {
+	require := require.New(t)
+	start := time.Date(2024, 8, 12, 20, 0, 0, 0, time.UTC)
+
+	_, err := types.NewAggregator(orderBookID, 5*time.Minute, 3, types.Resolution1m)
+	require.Error(err)
+
+	agg, err := types.NewAggregator(orderBookID, time.Minute, 3, types.Resolution1m)
+	require.NoError(err)
+	for i := 0; i < 5; i++ {
+		_, err = agg.AddTrade(trade("1", 1, start.Add(time.Duration(i)*time.Minute)))
+		require.NoError(err)
+	}
+	candles, err := agg.Candles(start, start.Add(time.Hour), types.Resolution1m)
+	require.NoError(err)
+	require.Len(candles, 3)
+	require.Equal(start.Add(2*time.Minute).Unix(), candles[0].Start)
+}
+
+func TestResolution(t *testing.T) {
+	require := require.New(t)
+	at := time.Date(2024, 8, 12, 20, 7, 31, 0, time.UTC)
+
+	require.Equal(time.Date(2024, 8, 12, 20, 7, 0, 0, time.UTC).Unix(), types.Resolution1m.Start(at))
+	require.Equal(time.Date(2024, 8, 12, 20, 5, 0, 0, time.UTC).Unix(), types.Resolution5m.Start(at))
+	require.Equal(time.Date(2024, 8, 12, 20, 0, 0, 0, time.UTC).Unix(), types.Resolution1h.Start(at))
+	require.Equal(time.Date(2024, 8, 12, 0, 0, 0, 0, time.UTC).Unix(), types.Resolution1d.Start(at))
+	// before the epoch, candles still start at or before t
+	before := time.Date(1969, 12, 31, 23, 59, 30, 0, time.UTC)
+	require.Equal(time.Date(1969, 12, 31, 23, 59, 0, 0, time.UTC).Unix(), types.Resolution1m.Start(before))
+	require.Equal(time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC).Unix(), types.Resolution1d.Start(before))
+	require.Equal(time.Date(1969, 12, 31, 23, 59, 0, 0, time.UTC).Unix(), types.Resolution1m.Start(before.Add(-30*time.Second)))
+
+	r, err := types.ParseResolution("5m")
+	require.NoError(err)
+	require.Equal(types.Resolution5m, r)
+	_, err = types.ParseResolution("2m")
+	require.ErrorIs(err, errors.ErrInvalidResolution)
+}
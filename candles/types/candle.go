@@ -0,0 +1,195 @@
+package types
+
+import (
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/govalues/decimal"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/math"
+)
+
+// Resolution is the length of the interval covered by a single candle.
+type Resolution string
+
+const (
+	Resolution1m Resolution = "1m"
+	Resolution5m Resolution = "5m"
+	Resolution1h Resolution = "1h"
+	Resolution1d Resolution = "1d"
+)
+
+// Resolutions lists all supported resolutions, from shortest to longest.
+var Resolutions = []Resolution{Resolution1m, Resolution5m, Resolution1h, Resolution1d}
+
+// ParseResolution validates a resolution string.
+func ParseResolution(s string) (Resolution, error) {
+	r := Resolution(s)
+	if r.Duration() == 0 {
+		return "", errors.ErrInvalidResolution
+	}
+	return r, nil
+}
+
+// Duration of the resolution. Zero for unsupported resolutions.
+func (r Resolution) Duration() time.Duration {
+	switch r {
+	case Resolution1m:
+		return time.Minute
+	case Resolution5m:
+		return 5 * time.Minute
+	case Resolution1h:
+		return time.Hour
+	case Resolution1d:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// Start returns the unix time (seconds) of the start of the candle containing t.
+// Candles are aligned to the unix epoch, so daily candles start at midnight UTC.
+func (r Resolution) Start(t time.Time) int64 {
+	seconds := int64(r.Duration() / time.Second)
+	unix := t.Unix()
+	rem := unix % seconds
+	if rem < 0 {
+		// % is negative before the epoch, which would round up
+		rem += seconds
+	}
+	return unix - rem
+}
+
+// ValidateRange checks a candle query. from must be before to, and the range must cover at least one
+// candle of the given resolution.
+func ValidateRange(from, to time.Time, resolution Resolution) error {
+	if resolution.Duration() == 0 {
+		return errors.ErrInvalidResolution
+	}
+	if !from.Before(to) {
+		return errors.ErrFromMustBeSmallerThanTo
+	}
+	if resolution.Duration() > to.Sub(from) {
+		return errors.ErrResolutionHigherThanToMinusFrom
+	}
+	return nil
+}
+
+// Trade is a single execution on an order book, as ingested by the candle Aggregator.
+type Trade struct {
+	OrderBookID string          `json:"order_book_id"`
+	Price       decimal.Decimal `json:"price"`
+	Amount      uint64          `json:"amount"`
+	Time        time.Time       `json:"time"`
+}
+
+// Validate requires an order book, a positive price and a non-zero amount.
+func (t Trade) Validate() error {
+	if t.OrderBookID == "" {
+		return errors.ErrInvalidInput
+	}
+	if !t.Price.IsPos() {
+		return errors.ErrPriceMustBePositive
+	}
+	if t.Amount == 0 {
+		return errors.ErrAmountCannotBeZero
+	}
+	return nil
+}
+
+// Candle contains open, high, low, close and volume of an order book for one interval.
+type Candle struct {
+	OrderBookID string     `json:"order_book_id"`
+	Resolution  Resolution `json:"resolution"`
+	// Unix time (seconds) of the start of the interval
+	Start  int64           `json:"start"`
+	Open   decimal.Decimal `json:"open"`
+	High   decimal.Decimal `json:"high"`
+	Low    decimal.Decimal `json:"low"`
+	Close  decimal.Decimal `json:"close"`
+	Volume uint64          `json:"volume"`
+	Trades uint64          `json:"trades"`
+	// Unix time (nanoseconds) of the earliest and latest trades, so that late trades
+	// can still set the open or close price correctly.
+	FirstTradeAt int64 `json:"first_trade_at"`
+	LastTradeAt  int64 `json:"last_trade_at"`
+}
+
+func (c *Candle) MarshalBinary() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+func (c *Candle) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, c)
+}
+
+// NewCandle creates a candle from the first trade in its interval.
+func NewCandle(resolution Resolution, trade Trade) *Candle {
+	return &Candle{
+		OrderBookID:  trade.OrderBookID,
+		Resolution:   resolution,
+		Start:        resolution.Start(trade.Time),
+		Open:         trade.Price,
+		High:         trade.Price,
+		Low:          trade.Price,
+		Close:        trade.Price,
+		Volume:       trade.Amount,
+		Trades:       1,
+		FirstTradeAt: trade.Time.UnixNano(),
+		LastTradeAt:  trade.Time.UnixNano(),
+	}
+}
+
+// End returns the unix time (seconds) at which the candle's interval ends. The end is not part of the interval.
+func (c *Candle) End() int64 {
+	return c.Start + int64(c.Resolution.Duration()/time.Second)
+}
+
+// Add a trade to the candle. Trades may arrive out of order: the open and close prices are taken from
+// the earliest and latest trades respectively. Error if the trade is outside of the candle's interval.
+func (c *Candle) Add(trade Trade) error {
+	if trade.OrderBookID != c.OrderBookID || c.Resolution.Start(trade.Time) != c.Start {
+		return errors.Data("trade at %s does not belong to candle %s %d", trade.Time, c.Resolution, c.Start)
+	}
+	volume, err := math.CheckedAddU64(c.Volume, trade.Amount)
+	if err != nil {
+		return err
+	}
+	at := trade.Time.UnixNano()
+	if at < c.FirstTradeAt {
+		c.Open = trade.Price
+		c.FirstTradeAt = at
+	}
+	if at >= c.LastTradeAt {
+		c.Close = trade.Price
+		c.LastTradeAt = at
+	}
+	c.High = c.High.Max(trade.Price)
+	c.Low = c.Low.Min(trade.Price)
+	c.Volume = volume
+	c.Trades++
+	return nil
+}
+
+// Copy returns a copied Candle.
+func (c *Candle) Copy() *Candle {
+	cp := *c
+	return &cp
+}
+
+// CandlesRequest is a range query for an order book's candles, as received on the candles request topic.
+type CandlesRequest struct {
+	OrderBookID string     `json:"order_book_id"`
+	Resolution  Resolution `json:"resolution"`
+	From        time.Time  `json:"from"`
+	To          time.Time  `json:"to"`
+}
+
+// Validate the request's order book and range.
+func (r CandlesRequest) Validate() error {
+	if r.OrderBookID == "" {
+		return errors.ErrInvalidInput
+	}
+	return ValidateRange(r.From, r.To, r.Resolution)
+}
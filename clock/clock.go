@@ -0,0 +1,26 @@
+package clock
+
+import "time"
+
+// Clock tells the current time. Time-dependent calculations accept a Clock,
+// so they can be tested and replayed at specific moments.
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the Clock backed by time.Now.
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// OrSystem returns c, or System if c is nil.
+func OrSystem(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
@@ -0,0 +1,49 @@
+// Command backfill-pool-index adds the pools stored in Redis to the pool indexes, for pools created before
+// CreatePool and UpdatePool maintained them. It is safe to run more than once.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	predis "github.com/dora-network/dora-service-utils/pools/redis"
+	"github.com/dora-network/dora-service-utils/redis"
+)
+
+func main() {
+	address := flag.String("address", "localhost:6379", "comma separated Redis addresses")
+	username := flag.String("username", "", "Redis username")
+	password := flag.String("password", "", "Redis password")
+	db := flag.Int("db", 0, "Redis database")
+	clientType := flag.String("client-type", "regular", "Redis client type: regular, cluster or failover")
+	masterName := flag.String("master-name", "", "Redis master name, for failover clients")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout for each pool's transaction")
+	flag.Parse()
+
+	rdb, err := redis.NewClient(
+		redis.Config{
+			Address:    strings.Split(*address, ","),
+			Username:   *username,
+			Password:   *password,
+			DB:         *db,
+			ClientType: redis.ClientTypeFromString(*clientType),
+			MasterName: *masterName,
+		},
+	)
+	if err != nil {
+		log.Fatalf("failed to create Redis client: %v", err)
+	}
+
+	indexed, err := predis.BackfillPoolIndex(context.Background(), rdb, *timeout)
+	// log.Fatalf exits without running deferred calls, so the client is closed first
+	if closeErr := rdb.Close(); closeErr != nil {
+		log.Printf("failed to close Redis client: %v", closeErr)
+	}
+	if err != nil {
+		log.Fatalf("indexed %d pools before failing: %v", indexed, err)
+	}
+	log.Printf("indexed %d pools", indexed)
+}
@@ -47,6 +47,24 @@ var (
 	ErrTimeFrom = New(InvalidInputError, "timeFrom should be less than timeTo")
 	// ErrAssetNotFoundInPool error for when the asset is not found in the pool assets.
 	ErrAssetNotFoundInPool = New(NotFoundError, "asset not found in pool")
+	// ErrNotEnoughPoolReserves error for when the requested swap amount out is not below the pool's reserves.
+	ErrNotEnoughPoolReserves = New(InvalidInputError, "amount out must be lower than the pool reserves")
+	// ErrSwapDeadlineExceeded error for when a swap is executed after its deadline.
+	ErrSwapDeadlineExceeded = New(InvalidInputError, "swap deadline exceeded")
+	// ErrPoolNotFound error for when a pool does not exist.
+	ErrPoolNotFound = New(NotFoundError, "pool not found")
+	// ErrPoolSequenceMismatch error for when a pool changed since the caller last read it.
+	ErrPoolSequenceMismatch = New(InvalidInputError, "pool sequence does not match the expected sequence")
+	// ErrPoolMatured error for when a swap is executed against a yield pool at or after its maturity.
+	ErrPoolMatured = New(InvalidInputError, "pool has matured and no longer swaps")
+	// ErrPoolNotMatured error for when a yield pool is settled before its maturity.
+	ErrPoolNotMatured = New(InvalidInputError, "pool has not matured")
+	// ErrPoolSettled error for when a settled pool is swapped against, given liquidity, or settled again.
+	ErrPoolSettled = New(InvalidInputError, "pool is settled")
+	// ErrPoolHasNoPrice error for when a pool cannot be priced, because its reserves are empty or it has matured.
+	ErrPoolHasNoPrice = New(InvalidInputError, "pool has no price")
+	// ErrNotEnoughPriceHistory error for when a pool has no price observations as old as a requested TWAP window.
+	ErrNotEnoughPriceHistory = New(InvalidInputError, "not enough price history for the TWAP window")
 	// ErrNotEnoughLP error for when the pool does not give out enough LP shares.
 	ErrNotEnoughLP = New(InvalidInputError, "new LP shares created are lower than min LP share needed")
 	// ErrAssetBondMissingFields error for when the asset is a bond type but didn't fill all the fields.
@@ -61,6 +79,8 @@ var (
 	ErrAmountMustBePositive               = New(InvalidInputError, "the amount should be positive")
 	ErrFromMustBeSmallerThanTo            = New(InvalidInputError, "from must be smaller than to")
 	ErrResolutionHigherThanToMinusFrom    = New(InvalidInputError, "resolution higher than to minus from")
+	ErrInvalidResolution                  = New(InvalidInputError, "invalid resolution")
+	ErrTradeTooLate                       = New(InvalidInputError, "trade is older than the late trade grace window")
 	ErrNoValidSwapPath                    = New(InternalError, "no swap path found")
 	ErrSwapInputInNil                     = New(InternalError, "AssetIn and MinAmtOut cannot be nil")
 
@@ -80,6 +100,10 @@ var (
 		"price must be equal or greater than orderBook tickSize",
 	)
 	ErrInsufficientBalance = New(InvalidInputError, "insufficient balance")
+	// ErrRepayExceedsDebt error for when a user repays more of an asset than they owe.
+	ErrRepayExceedsDebt = New(InvalidInputError, "repay exceeds debt")
+	// ErrUnbalancedJournalEntry error for when a journal entry's postings do not net to zero for every asset.
+	ErrUnbalancedJournalEntry = New(InvalidInputError, "journal entry postings do not balance")
 
 	ErrReadNotAllowed  = New(InternalError, "txctx has reads disabled")
 	ErrWriteNotAllowed = New(InternalError, "txctx has writes disabled")
@@ -100,14 +124,21 @@ var (
 	ErrOrderAmendCannotChangeAssets   = Data("order amend cannot change assets")
 	ErrOrderNotFound                  = Data("order not found")
 	ErrOrderAmendCannotChangeLeverage = Data("order amend cannot change leverage")
+	ErrOrderAmendAmountNotAboveFilled = Data("order amend amount must exceed filled amount")
 	ErrOrderContainsInvalidOrderType  = Data("order contains invalid order type")
+	ErrInvalidOrderTransition         = Data("invalid order status transition")
+	ErrOrderFillExceedsAmount         = Data("order filled amount cannot exceed order amount")
 
 	ErrPoolAssetsMismatch = Data("pools asset mismatch")
 
 	ErrInvalidOrderType = Data("invalid order type")
 
+	ErrDepthSequenceGap    = Data("order book depth update sequence gap")
+	ErrDepthResyncRequired = Data("order book depth requires a snapshot resync")
+
 	ErrAmountCannotBeZero = New(InvalidInputError, "amount cannot be zero")
 	ErrBaseAssetMismatch  = New(InvalidInputError, "AddLiquidity: base asset id mismatch")
+	ErrQuoteAssetMismatch = New(InvalidInputError, "AddLiquidityQuote: quote asset id mismatch")
 )
 
 // TypedError represents an error with a specific type.
@@ -42,6 +42,12 @@ type AssetData struct {
 
 	// also track asset prices
 	prices map[string]float64
+	// and optional time-weighted average prices, which value collateral instead when useTWAP is set
+	twapPrices map[string]float64
+	useTWAP    bool
+
+	// pool share assets, valued by the assets underlying them
+	poolShares map[string]poolShare
 
 	// internal
 	initialized bool
@@ -64,6 +70,8 @@ func (ad *AssetData) Init() {
 		ad.coupons = map[string][]Coupon{}
 
 		ad.prices = map[string]float64{}
+		ad.twapPrices = map[string]float64{}
+		ad.poolShares = map[string]poolShare{}
 
 		ad.initialized = true
 	}
@@ -139,6 +147,62 @@ func (ad *AssetData) UpdatePrice(
 	return nil
 }
 
+// UpdateTWAPPrice stores an asset's time-weighted average price, such as one derived from a pool TWAP.
+func (ad *AssetData) UpdateTWAPPrice(
+	id string,
+	price float64,
+) error {
+	ad.Init()
+	if id == "" {
+		return errors.New("empty asset ID")
+	}
+	if math.IsNaN(price) || math.IsInf(price, 0) || price < 0 {
+		return errors.New("invalid price")
+	}
+	ad.twapPrices[id] = price
+	return nil
+}
+
+// poolShare holds the assets underlying all of a pool's shares.
+type poolShare struct {
+	shares     uint64
+	underlying []types.Amount
+}
+
+// UpdatePoolShare stores the assets underlying all of a pool's shares, including its collected fees, such as
+// the pool's ShareValue of all its shares. Registered pool share assets are valued in USD by the value of their
+// underlying assets, whose prices and decimals must be registered, instead of by their own price.
+func (ad *AssetData) UpdatePoolShare(
+	poolShareID string,
+	shares uint64,
+	underlying ...types.Amount,
+) error {
+	ad.Init()
+	id, err := types.ParseAssetID(poolShareID)
+	if err != nil {
+		return err
+	}
+	if !id.IsPoolShare() {
+		return fmt.Errorf("%s is not a pool share", poolShareID)
+	}
+	if shares == 0 {
+		return errors.New("pool share without shares")
+	}
+	for _, u := range underlying {
+		if err := u.Validate(); err != nil {
+			return err
+		}
+	}
+	ad.poolShares[poolShareID] = poolShare{shares: shares, underlying: underlying}
+	return nil
+}
+
+// UseTWAPPrices sets whether collateral is valued at TWAP prices, which are harder to manipulate than spot prices.
+// Assets without a TWAP price are still valued at their spot price.
+func (ad *AssetData) UseTWAPPrices(use bool) {
+	ad.useTWAP = use
+}
+
 // IDs returns an unsorted slice of the assetIDs of all registered assets
 func (ad *AssetData) IDs() []string {
 	ids := []string{}
@@ -196,6 +260,28 @@ func (ad AssetData) CouponEndingAt(assetID string, time int64) (*Coupon, error)
 	return &result[0], nil
 }
 
+// MaturityPayment returns an asset's maturity payment, which redeems each unit of the asset for its Yield in
+// dollars. Error if the asset has no maturity payment, or multiple.
+func (ad AssetData) MaturityPayment(assetID string) (*Coupon, error) {
+	if ad.coupons == nil {
+		err := fmt.Errorf("asset %s not found", assetID)
+		return nil, err
+	}
+	result := []Coupon{}
+	for _, c := range ad.coupons[assetID] {
+		if c.IsMaturity {
+			result = append(result, c)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("maturity payment for %s not found", assetID)
+	}
+	if len(result) != 1 {
+		return nil, fmt.Errorf("multiple maturity payments for %s found", assetID)
+	}
+	return &result[0], nil
+}
+
 // CouponsEndingInRange returns any of an asset's coupon periods which end after fromTime
 // AND (before OR at) toTime. (If the two times are equal, the coupon period is not returned.)
 // Also ignores coupon periods without a positive yield.
@@ -320,6 +406,17 @@ func (ad AssetData) Price(assetID string) (float64, error) {
 	return 0, fmt.Errorf("price for %s not found", assetID)
 }
 
+// CollateralPrice returns the price an asset is valued at as collateral: its TWAP price if TWAP prices are used
+// and it has one, otherwise its price. Error if neither is registered.
+func (ad AssetData) CollateralPrice(assetID string) (float64, error) {
+	if ad.useTWAP {
+		if p, ok := ad.twapPrices[assetID]; ok {
+			return p, nil
+		}
+	}
+	return ad.Price(assetID)
+}
+
 // ExactLiquidationThreshold returns a positions's Liquidation Threshold.
 // Only the position's positive Owned assets are considered. Missing prices result in errors.
 func (ad AssetData) ExactLiquidationThreshold(p *types.Position) (float64, error) {
@@ -335,7 +432,7 @@ func (ad AssetData) ExactLiquidationThreshold(p *types.Position) (float64, error
 				if lt == 0 {
 					return nil // assets not meant for collateral don't need prices below
 				}
-				value, err := ad.GetAssetValueInUSD(amt, assetID, lt)
+				value, err := ad.GetCollateralValueInUSD(amt, assetID, lt)
 				if err != nil {
 					return err
 				}
@@ -363,7 +460,7 @@ func (ad AssetData) ExactBorrowLimit(p *types.Position) (float64, error) {
 				if cw == 0 {
 					return nil // assets not meant for collateral don't need prices below
 				}
-				value, err := ad.GetAssetValueInUSD(amt, assetID, cw)
+				value, err := ad.GetCollateralValueInUSD(amt, assetID, cw)
 				if err != nil {
 					return err
 				}
@@ -412,7 +509,7 @@ func (ad AssetData) ExactCollateralValue(p *types.Position) (float64, error) {
 				if cw == 0 {
 					return nil // assets not meant for collateral are not considered
 				}
-				value, err := ad.GetAssetValueInUSD(amt, assetID, 1)
+				value, err := ad.GetCollateralValueInUSD(amt, assetID, 1)
 				if err != nil {
 					return err
 				}
@@ -493,13 +590,39 @@ func (ad AssetData) ExactAvailableValue(p *types.Position) (float64, error) {
 
 // GetAssetValueInUSD will convert amount into USD.
 func (ad AssetData) GetAssetValueInUSD(amt int64, assetID string, multiplier float64) (float64, error) {
+	return ad.valueInUSD(amt, assetID, multiplier, ad.Price)
+}
+
+// GetCollateralValueInUSD is GetAssetValueInUSD at the asset's collateral price, see CollateralPrice.
+func (ad AssetData) GetCollateralValueInUSD(amt int64, assetID string, multiplier float64) (float64, error) {
+	return ad.valueInUSD(amt, assetID, multiplier, ad.CollateralPrice)
+}
+
+func (ad AssetData) valueInUSD(
+	amt int64,
+	assetID string,
+	multiplier float64,
+	priceOf func(assetID string) (float64, error),
+) (float64, error) {
+	if ps, ok := ad.poolShares[assetID]; ok {
+		// the shares' part of each underlying asset, valued at that asset's price
+		total := 0.0
+		for _, u := range ps.underlying {
+			value, err := ad.valueInUSD(1, u.AssetID, multiplier, priceOf)
+			if err != nil {
+				return 0.0, err
+			}
+			total += value * float64(u.Amount) * float64(amt) / float64(ps.shares)
+		}
+		return total, nil
+	}
 	decimals, err := ad.Decimals(assetID)
 	if err != nil {
 		return 0.0, err
 	}
 	multiplier /= math.Pow10(decimals)
 	// For known prices, compute exact value
-	price, err := ad.Price(assetID)
+	price, err := priceOf(assetID)
 	if err != nil {
 		return 0.0, err
 	}
@@ -0,0 +1,225 @@
+package coupons_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/helpers"
+	"github.com/dora-network/dora-service-utils/ledger/coupons"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	ptypes "github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+const (
+	period    int64 = 1_700_000_000
+	userThree       = "user3"
+	userFour        = "user4"
+)
+
+func testAssetData(t *testing.T) *helpers.AssetData {
+	ad := new(helpers.AssetData)
+	coupon := &helpers.Coupon{
+		Start: time.Unix(period-86400*182, 0).UTC().Format(time.RFC1123),
+		Date:  time.Unix(period, 0).UTC().Format(time.RFC1123),
+		Yield: 0.03,
+	}
+	maturity := &helpers.Coupon{
+		Date:       time.Unix(period*2, 0).UTC().Format(time.RFC1123),
+		Yield:      1,
+		IsMaturity: true,
+	}
+	require.NoError(t, ad.RegisterAsset(consts.StableID, 6, 0.8, 0.9, true, false, true, true, false, false, nil))
+	require.NoError(
+		t,
+		ad.RegisterAsset(
+			consts.BondID, 6, 0.5, 0.8, false, true, true, true, true, false, []*helpers.Coupon{coupon, maturity},
+		),
+	)
+	return ad
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	require := require.New(t)
+	pool := &ptypes.Pool{
+		PoolID:       types.NewPoolShareID(consts.BondID, consts.StableID).String(),
+		BaseAsset:    consts.BondID,
+		QuoteAsset:   consts.StableID,
+		AmountShares: 1_000,
+		AmountBase:   2_000_000,
+		AmountQuote:  2_000_000,
+	}
+
+	one := types.InitialPosition(consts.UserIDOne)
+	one.Owned = types.NewBalances(consts.BondID, 1_000_000)
+	one.Supplied = types.NewBalances(consts.BondID, 500_000)
+	two := types.InitialPosition(consts.UserIDTwo)
+	two.Owned = types.NewBalances(pool.PoolID, 300)
+	two.Supplied = types.NewBalances(pool.PoolID, 200)
+	// borrowers hold nothing
+	three := types.InitialPosition(userThree)
+	three.Owned = types.NewBalances(consts.BondID, -250_000)
+	// half of the supplied bonds and shares are lent, and whoever holds what was lent is paid for it, so
+	// suppliers hold only the other half
+	module := types.InitialModule()
+	module.Supplied = types.NewBalances(consts.BondID, 500_000).AddAmount(pool.PoolID, 200)
+	module.Borrowed = types.NewBalances(consts.BondID, 250_000).AddAmount(pool.PoolID, 100)
+
+	snapshot, err := coupons.TakeSnapshot(
+		consts.BondID, period, []*types.Position{three, two, one}, module, []*ptypes.Pool{pool},
+	)
+	require.NoError(err)
+	require.Equal(
+		[]coupons.Holding{
+			{UserID: consts.UserIDOne, Owned: 1_000_000, Supplied: 250_000},
+			{UserID: consts.UserIDTwo, Pooled: 800_000},
+		},
+		snapshot.Holdings,
+	)
+	require.Equal(int64(2_050_000), snapshot.TotalSupply)
+
+	// with nothing lent, suppliers hold all they supply
+	module.Borrowed = types.EmptyBalances()
+	snapshot, err = coupons.TakeSnapshot(consts.BondID, period, []*types.Position{one}, module, nil)
+	require.NoError(err)
+	require.Equal([]coupons.Holding{{UserID: consts.UserIDOne, Owned: 1_000_000, Supplied: 500_000}}, snapshot.Holdings)
+
+	// holding more shares than the pool has
+	two.Owned = types.NewBalances(pool.PoolID, 2_000)
+	_, err = coupons.TakeSnapshot(consts.BondID, period, []*types.Position{two}, module, []*ptypes.Pool{pool})
+	require.Error(err)
+	_, err = coupons.TakeSnapshot(consts.BondID, period, []*types.Position{one, one}, module, nil)
+	require.Error(err)
+	_, err = coupons.TakeSnapshot(consts.BondID, period, []*types.Position{one}, nil, nil)
+	require.Error(err)
+	// supply the module does not have
+	_, err = coupons.TakeSnapshot(consts.BondID, period, []*types.Position{one}, types.InitialModule(), nil)
+	require.Error(err)
+}
+
+func TestProcessor(t *testing.T) {
+	require := require.New(t)
+	ad := testAssetData(t)
+	_, err := coupons.NewProcessor(ad, consts.BondID)
+	require.Error(err)
+	_, err = coupons.NewProcessor(nil, consts.StableID)
+	require.Error(err)
+	processor, err := coupons.NewProcessor(ad, consts.StableID)
+	require.NoError(err)
+
+	couponID := types.NewCouponID(consts.BondID, period).String()
+	snapshotID := types.NewSnapshotID(consts.BondID, period).String()
+	pool := &ptypes.Pool{
+		PoolID:       types.NewPoolShareID(consts.BondID, consts.StableID).String(),
+		BaseAsset:    consts.BondID,
+		QuoteAsset:   consts.StableID,
+		AmountShares: 1_000,
+		AmountBase:   2_000_000,
+		AmountQuote:  2_000_000,
+	}
+	one := types.InitialPosition(consts.UserIDOne)
+	one.Owned = types.NewBalances(consts.BondID, 1_000_000)
+	one.Supplied = types.NewBalances(consts.BondID, 500_000)
+	two := types.InitialPosition(consts.UserIDTwo)
+	two.Owned = types.NewBalances(consts.StableID, -10_000).AddAmount(pool.PoolID, 500)
+	// rounds down to nothing
+	three := types.InitialPosition(userThree)
+	three.Owned = types.NewBalances(consts.BondID, 33)
+	// borrowed half of one's supply, which has left the ledger
+	four := types.InitialPosition(userFour)
+	four.Owned = types.NewBalances(consts.BondID, -250_000)
+	positions := map[string]*types.Position{
+		consts.UserIDOne: one, consts.UserIDTwo: two, userThree: three, userFour: four,
+	}
+	module := types.InitialModule()
+	module.Balance = types.NewBalances(consts.BondID, 250_000)
+	module.Supplied = types.NewBalances(consts.BondID, 500_000)
+	module.Borrowed = types.NewBalances(consts.StableID, 10_000).AddAmount(consts.BondID, 250_000)
+	module.CouponFunds = types.NewBalances(consts.StableID, 100_000)
+	module.DollarCouponFundSources = types.NewBalances(couponID, 50_000)
+	module.TotalSupplySnapshots = types.NewBalances(snapshotID, -1)
+	snapshot, err := coupons.TakeSnapshot(
+		consts.BondID, period, []*types.Position{one, two, three, four}, module, []*ptypes.Pool{pool},
+	)
+	require.NoError(err)
+	require.Equal(int64(2_250_033), snapshot.TotalSupply)
+	now := time.Unix(period+60, 0)
+
+	_, err = processor.Plan(snapshot, positions, module, time.Unix(period-1, 0))
+	require.Error(err)
+	_, err = processor.Plan(&coupons.Snapshot{AssetID: consts.BondID, Period: period + 1}, positions, module, now)
+	require.True(errors.Is(err, errors.InvalidDataErr))
+	_, err = processor.Plan(&coupons.Snapshot{AssetID: consts.BondID, Period: period * 2}, positions, module, now)
+	require.Error(err)
+	// the coupon period's funds do not cover it
+	_, err = processor.Pay(snapshot, positions, module, now)
+	require.ErrorIs(err, errors.ErrInsufficientBalance)
+	require.Equal(int64(-10_000), two.Owned.AmountOf(consts.StableID))
+
+	// whoever holds the bonds lent to four is paid for them, so one is paid on the supply which is not lent.
+	// The period's end is the next period's start, so its supply may be tracked before its coupon is paid.
+	module.DollarCouponFundSources = types.NewBalances(couponID, 100_000)
+	module.TotalSupplySnapshots = types.NewBalances(snapshotID, 2_000_000)
+	payout, err := processor.Pay(snapshot, positions, module, now)
+	require.NoError(err)
+	require.Equal(
+		[]coupons.Payment{{UserID: consts.UserIDOne, Amount: 37_500}, {UserID: consts.UserIDTwo, Amount: 30_000}},
+		payout.Payments,
+	)
+	require.Equal(int64(67_500), payout.Total)
+	require.Equal(coupons.CouponReason, payout.Entry.Reason)
+
+	require.Equal(int64(37_500), one.Owned.AmountOf(consts.StableID))
+	require.Equal(int64(37_500), one.InterestSources.AmountOf(couponID))
+	require.Equal(now.Unix(), one.LastUpdated)
+	// the payment repays what the holder owes
+	require.Equal(int64(20_000), two.Owned.AmountOf(consts.StableID))
+	require.Equal(int64(30_000), two.InterestSources.AmountOf(couponID))
+	require.Zero(module.Borrowed.AmountOf(consts.StableID))
+	require.Equal(int64(10_000), module.Balance.AmountOf(consts.StableID))
+	require.Zero(three.Owned.AmountOf(consts.StableID))
+	require.Zero(three.InterestSources.AmountOf(couponID))
+
+	require.Zero(four.Owned.AmountOf(consts.StableID))
+
+	require.Equal(int64(32_500), module.CouponFunds.AmountOf(consts.StableID))
+	require.Equal(int64(32_500), module.DollarCouponFundSources.AmountOf(couponID))
+	require.Equal(int64(2_250_033), module.TotalSupplySnapshots.AmountOf(snapshotID))
+	require.Equal(now.Unix(), module.PaidCoupons.AmountOf(couponID))
+	require.Equal(now.Unix(), module.LastUpdated)
+	require.Equal(module.PaidCoupons, module.Copy().PaidCoupons)
+
+	// a coupon is paid once
+	_, err = processor.Pay(snapshot, positions, module, now)
+	require.Error(err)
+}
+
+func TestProcessor_NoSupply(t *testing.T) {
+	require := require.New(t)
+	processor, err := coupons.NewProcessor(testAssetData(t), consts.StableID)
+	require.NoError(err)
+
+	couponID := types.NewCouponID(consts.BondID, period).String()
+	snapshotID := types.NewSnapshotID(consts.BondID, period).String()
+	module := types.InitialModule()
+	module.TotalSupplySnapshots = types.NewBalances(snapshotID, -1)
+	snapshot, err := coupons.TakeSnapshot(consts.BondID, period, []*types.Position{}, module, []*ptypes.Pool{})
+	require.NoError(err)
+	require.Zero(snapshot.TotalSupply)
+	now := time.Unix(period+60, 0)
+
+	// nothing is paid, but the coupon is still marked as paid
+	payout, err := processor.Pay(snapshot, map[string]*types.Position{}, module, now)
+	require.NoError(err)
+	require.Empty(payout.Payments)
+	require.Zero(payout.Total)
+	require.Equal(int64(-1), module.TotalSupplySnapshots.AmountOf(snapshotID))
+	require.Equal(now.Unix(), module.PaidCoupons.AmountOf(couponID))
+	require.NoError(module.Validate())
+
+	_, err = processor.Pay(snapshot, map[string]*types.Position{}, module, now)
+	require.Error(err)
+}
@@ -0,0 +1,250 @@
+package coupons
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/govalues/decimal"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/helpers"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	mdecimal "github.com/dora-network/dora-service-utils/math/decimal"
+)
+
+// CouponReason is the reason of coupon payments' journal entries.
+const CouponReason = "coupon"
+
+// Processor pays bonds' coupons in a dollar asset, from the module's CouponFunds which LPs provide for each
+// coupon period of each bond, see Module.DollarCouponFundSources.
+type Processor struct {
+	assetData *helpers.AssetData
+	// dollarAsset is the currency coupons are paid in.
+	dollarAsset string
+}
+
+// NewProcessor returns a coupon processor finding bonds' coupons in assetData, which pays them in dollarAsset.
+// Error if dollarAsset is not a registered currency.
+func NewProcessor(assetData *helpers.AssetData, dollarAsset string) (*Processor, error) {
+	if assetData == nil {
+		return nil, errors.New(errors.InvalidInputError, "coupon processor needs asset data")
+	}
+	if !assetData.IsCurrency(dollarAsset) {
+		return nil, errors.Newf(errors.InvalidInputError, "coupon processor dollar asset %s is not a currency", dollarAsset)
+	}
+	return &Processor{assetData: assetData, dollarAsset: dollarAsset}, nil
+}
+
+// Payment of a coupon to a holder of the bond.
+type Payment struct {
+	UserID string `json:"user_id"`
+	Amount int64  `json:"amount"`
+}
+
+// Payout of one coupon period of a bond to its holders.
+type Payout struct {
+	// CouponID identifies the coupon period in Position.InterestSources and Module.DollarCouponFundSources.
+	CouponID string `json:"coupon_id"`
+	// SnapshotID identifies the coupon period's end in Module.TotalSupplySnapshots.
+	SnapshotID string `json:"snapshot_id"`
+	// AssetID is the dollar asset the coupon is paid in.
+	AssetID string `json:"asset_id"`
+	// Yield is the coupon in dollars per whole bond.
+	Yield    float64   `json:"yield"`
+	Snapshot *Snapshot `json:"snapshot"`
+	// Payments to the holders, sorted by user ID. Holders whose coupon rounds down to zero are not paid.
+	Payments []Payment `json:"payments"`
+	// Total of the payments, which is taken from the coupon funds.
+	Total int64 `json:"total"`
+	// Entry posts the payments to the holders' positions and the module, see Apply. Nil if nothing is paid.
+	Entry *types.JournalEntry `json:"entry"`
+	// Time the coupon is paid at.
+	Time int64 `json:"time"`
+}
+
+// Plan the payout of a bond's coupon period to the holders in a snapshot taken at its end, see TakeSnapshot,
+// without modifying their positions or the module. Positions must contain the position of every holder.
+//
+// Each holder is paid the coupon's yield on what they hold, in the dollar asset, rounded down. Payments repay any
+// of the dollar asset a holder owes. Error if the period has not ended at now, has no coupon or ends at the
+// bond's maturity, or its coupon was already paid, or ErrInsufficientBalance if its coupon funds do not cover
+// the payments.
+func (c *Processor) Plan(
+	snapshot *Snapshot,
+	positions map[string]*types.Position,
+	module *types.Module,
+	now time.Time,
+) (*Payout, error) {
+	if snapshot == nil || module == nil {
+		return nil, errors.New(errors.InvalidInputError, "coupon payout needs a snapshot and the module")
+	}
+	couponID := types.NewCouponID(snapshot.AssetID, snapshot.Period).String()
+	snapshotID := types.NewSnapshotID(snapshot.AssetID, snapshot.Period).String()
+	if now.Unix() < snapshot.Period {
+		return nil, errors.Newf(errors.InvalidInputError, "coupon period %s has not ended at %s", couponID, now)
+	}
+	if module.PaidCoupons.AmountOf(couponID) != 0 {
+		return nil, errors.Newf(errors.InvalidInputError, "coupon %s is already paid", couponID)
+	}
+	coupon, err := c.assetData.CouponEndingAt(snapshot.AssetID, snapshot.Period)
+	if err != nil {
+		return nil, errors.Wrap(errors.InvalidDataErr, err, "Plan")
+	}
+	if coupon.IsMaturity {
+		return nil, errors.Newf(errors.InvalidInputError, "%s is the maturity payment of %s", couponID, snapshot.AssetID)
+	}
+	scale, err := c.scale(snapshot.AssetID)
+	if err != nil {
+		return nil, err
+	}
+
+	payout := &Payout{
+		CouponID:   couponID,
+		SnapshotID: snapshotID,
+		AssetID:    c.dollarAsset,
+		Yield:      coupon.Yield,
+		Snapshot:   snapshot,
+		Payments:   []Payment{},
+		Time:       now.Unix(),
+	}
+	var postings []types.Posting
+	for _, h := range snapshot.Holdings {
+		amount, err := entitlement(h.Total(), coupon.Yield, scale)
+		if err != nil {
+			return nil, errors.Wrap(errors.InvalidDataErr, err, "coupon "+couponID+" of user "+h.UserID)
+		}
+		if amount == 0 {
+			continue
+		}
+		p := positions[h.UserID]
+		if p == nil {
+			return nil, errors.Newf(errors.InvalidInputError, "no position for user %s", h.UserID)
+		}
+		if payout.Total, err = add(payout.Total, uint64(amount)); err != nil {
+			return nil, errors.Wrap(errors.InvalidDataErr, err, "coupon "+couponID)
+		}
+		payout.Payments = append(payout.Payments, Payment{UserID: h.UserID, Amount: amount})
+		postings = append(
+			postings,
+			types.Posting{UserID: h.UserID, Account: types.AccountOwned, AssetID: c.dollarAsset, Amount: amount},
+		)
+		// payments repay the dollar asset the holder owes, like a transfer
+		if owed := min(amount, p.Debt(c.dollarAsset)); owed > 0 {
+			postings = append(postings, types.RepayPostings(module, c.dollarAsset, owed)...)
+		}
+	}
+	sort.Slice(
+		payout.Payments, func(i, j int) bool {
+			return payout.Payments[i].UserID < payout.Payments[j].UserID
+		},
+	)
+	if payout.Total == 0 {
+		return payout, nil
+	}
+
+	funds := min(module.CouponFunds.AmountOf(c.dollarAsset), module.DollarCouponFundSources.AmountOf(couponID))
+	if funds < payout.Total {
+		return nil, errors.Wrap(
+			errors.InvalidInputError,
+			errors.ErrInsufficientBalance,
+			fmt.Sprintf("coupon %s pays %d %s but its coupon funds hold %d", couponID, payout.Total, c.dollarAsset, funds),
+		)
+	}
+	postings = append(
+		postings,
+		types.Posting{Account: types.AccountModuleCouponFunds, AssetID: c.dollarAsset, Amount: -payout.Total},
+	)
+	if payout.Entry, err = types.NewJournalEntry(CouponReason, payout.Time, postings...); err != nil {
+		return nil, err
+	}
+	return payout, nil
+}
+
+// Pay a bond's coupon period to the holders in a snapshot taken at its end, see Plan and Apply. Either the coupon
+// is paid or nothing is modified.
+func (c *Processor) Pay(
+	snapshot *Snapshot,
+	positions map[string]*types.Position,
+	module *types.Module,
+	now time.Time,
+) (*Payout, error) {
+	payout, err := c.Plan(snapshot, positions, module, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := payout.Apply(positions, module); err != nil {
+		return nil, err
+	}
+	return payout, nil
+}
+
+// Apply the payout's entry to the holders' positions and the module, atomically. Then each holder's payment is
+// recorded in their InterestSources, the coupon funds used are taken from the coupon period's
+// DollarCouponFundSources, the period's total supply is recorded in TotalSupplySnapshots, -1 if it is zero, and
+// the coupon is marked as paid in PaidCoupons, even if nothing was paid. Positions must contain the position of
+// every holder paid.
+func (p *Payout) Apply(positions map[string]*types.Position, module *types.Module) error {
+	if p.Entry != nil {
+		if err := p.Entry.Apply(positions, module); err != nil {
+			return err
+		}
+	}
+	for _, payment := range p.Payments {
+		position := positions[payment.UserID]
+		position.InterestSources = position.InterestSources.AddAmount(p.CouponID, payment.Amount)
+		position.LastUpdated = p.Time
+		position.UpdateSequence()
+	}
+	if p.Total > 0 {
+		module.DollarCouponFundSources = module.DollarCouponFundSources.SubAmount(p.CouponID, p.Total)
+	}
+	supply := int64(-1)
+	if p.Snapshot.TotalSupply > 0 {
+		supply = p.Snapshot.TotalSupply
+	}
+	module.TotalSupplySnapshots = module.TotalSupplySnapshots.AddAmount(
+		p.SnapshotID, supply-module.TotalSupplySnapshots.AmountOf(p.SnapshotID),
+	)
+	module.PaidCoupons = module.PaidCoupons.AddAmount(p.CouponID, p.Time-module.PaidCoupons.AmountOf(p.CouponID))
+	module.LastUpdated = p.Time
+	module.UpdateSequence()
+	return nil
+}
+
+// scale returns the factor converting whole bonds to their units, and dollars to the dollar asset's units.
+func (c *Processor) scale(bondID string) (decimal.Decimal, error) {
+	bondDecimals, err := c.assetData.Decimals(bondID)
+	if err != nil {
+		return decimal.Decimal{}, errors.Wrap(errors.InvalidDataErr, err, "coupon")
+	}
+	dollarDecimals, err := c.assetData.Decimals(c.dollarAsset)
+	if err != nil {
+		return decimal.Decimal{}, errors.Wrap(errors.InvalidDataErr, err, "coupon")
+	}
+	return decimal.Ten.PowInt(dollarDecimals - bondDecimals)
+}
+
+// entitlement returns the coupon paid on an amount of a bond, at a yield in dollars per whole bond, rounded down.
+func entitlement(amount int64, yield float64, scale decimal.Decimal) (int64, error) {
+	yieldD, err := decimal.NewFromFloat64(yield)
+	if err != nil || yieldD.IsNeg() {
+		return 0, errors.Data("invalid yield %v", yield)
+	}
+	amountD, err := mdecimal.FromUint64(uint64(amount))
+	if err != nil {
+		return 0, err
+	}
+	paid, err := amountD.Mul(yieldD)
+	if err != nil {
+		return 0, err
+	}
+	if paid, err = paid.Mul(scale); err != nil {
+		return 0, err
+	}
+	result, err := mdecimal.FloorUint64(paid)
+	if err != nil {
+		return 0, err
+	}
+	return add(0, result)
+}
@@ -0,0 +1,157 @@
+// Package coupons pays bonds' coupons to the users holding them at the end of each coupon period, from the
+// module's coupon funds.
+package coupons
+
+import (
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	dmath "github.com/dora-network/dora-service-utils/math"
+	ptypes "github.com/dora-network/dora-service-utils/pools/types"
+)
+
+// Holding is the amount of a bond which a user holds at the end of a coupon period.
+type Holding struct {
+	UserID string `json:"user_id"`
+	// Owned is the user's Owned balance of the bond, if positive. Borrowers are paid nothing on what they borrow.
+	Owned int64 `json:"owned"`
+	// Supplied is the bond the user supplies to the module which the module has not lent, and so still pays its
+	// coupons to the user. Whoever holds the lent part is paid its coupons instead.
+	Supplied int64 `json:"supplied"`
+	// Pooled is the user's part of the bond in pools whose shares they own, or supply and are not lent, see
+	// Pool.ShareValue.
+	Pooled int64 `json:"pooled"`
+}
+
+// Total returns the amount of the bond the user holds in all.
+func (h Holding) Total() int64 {
+	return h.Owned + h.Supplied + h.Pooled
+}
+
+// Snapshot of the holders of a bond at the end of one of its coupon periods.
+type Snapshot struct {
+	AssetID string `json:"asset_id"`
+	// Period is the unix time the coupon period ends at.
+	Period int64 `json:"period"`
+	// Holdings of the users who hold any of the bond, sorted by user ID.
+	Holdings []Holding `json:"holdings"`
+	// TotalSupply is the total of the holdings.
+	TotalSupply int64 `json:"total_supply"`
+}
+
+// TakeSnapshot of the holders of a bond at the end of a coupon period, from their positions and the module at that
+// time. Users hold the bond they own and supply, and their part of the bond in any of the pools which trade it, by
+// the pool shares they own and supply. The module lends supply to borrowers, whose borrowed units are held, and
+// paid for, by whoever owns them, so each supplier only holds the part of their supply which is not lent, see
+// Module.Borrowed, rounded down. Virtual borrows mint what they lend, so do not reduce supply. Error if a user has
+// more than one position, or holds more shares than a pool has.
+func TakeSnapshot(
+	assetID string,
+	period int64,
+	positions []*types.Position,
+	module *types.Module,
+	pools []*ptypes.Pool,
+) (*Snapshot, error) {
+	if err := types.ValidAssetID(assetID); err != nil {
+		return nil, err
+	}
+	if module == nil {
+		return nil, errors.New(errors.InvalidInputError, "coupon snapshot needs the module")
+	}
+	var bondPools []*ptypes.Pool
+	for _, pool := range pools {
+		if pool.BaseAsset == assetID || pool.QuoteAsset == assetID {
+			bondPools = append(bondPools, pool)
+		}
+	}
+
+	snapshot := &Snapshot{AssetID: assetID, Period: period, Holdings: []Holding{}}
+	seen := make(map[string]bool)
+	for _, p := range positions {
+		if seen[p.UserID] {
+			return nil, errors.Data("TakeSnapshot: multiple positions of user %s", p.UserID)
+		}
+		seen[p.UserID] = true
+
+		supplied, err := unlent(module, assetID, p.Supplied.AmountOf(assetID))
+		if err != nil {
+			return nil, err
+		}
+		h := Holding{
+			UserID:   p.UserID,
+			Owned:    max(0, p.Owned.AmountOf(assetID)),
+			Supplied: supplied,
+		}
+		for _, pool := range bondPools {
+			suppliedShares, err := unlent(module, pool.PoolID, p.Supplied.AmountOf(pool.PoolID))
+			if err != nil {
+				return nil, err
+			}
+			shares, err := add(max(0, p.Owned.AmountOf(pool.PoolID)), uint64(suppliedShares))
+			if err != nil {
+				return nil, err
+			}
+			if shares == 0 {
+				continue
+			}
+			base, quote, err := pool.ShareValue(uint64(shares))
+			if err != nil {
+				return nil, err
+			}
+			underlying := base
+			if pool.QuoteAsset == assetID {
+				underlying = quote
+			}
+			if h.Pooled, err = add(h.Pooled, underlying.Amount); err != nil {
+				return nil, err
+			}
+		}
+
+		total, err := add(h.Owned, uint64(h.Supplied))
+		if err == nil {
+			total, err = add(total, uint64(h.Pooled))
+		}
+		if err == nil {
+			snapshot.TotalSupply, err = add(snapshot.TotalSupply, uint64(total))
+		}
+		if err != nil {
+			return nil, errors.Wrap(errors.InvalidDataErr, err, "TakeSnapshot: user "+p.UserID)
+		}
+		if total > 0 {
+			snapshot.Holdings = append(snapshot.Holdings, h)
+		}
+	}
+	sort.Slice(
+		snapshot.Holdings, func(i, j int) bool {
+			return snapshot.Holdings[i].UserID < snapshot.Holdings[j].UserID
+		},
+	)
+	return snapshot, nil
+}
+
+// unlent returns the part of an amount a user supplies of an asset which the module has not lent, pro-rata to
+// the module's supply of it which is not borrowed, rounded down.
+func unlent(module *types.Module, assetID string, supplied int64) (int64, error) {
+	if supplied <= 0 {
+		return 0, nil
+	}
+	supply := module.Supplied.AmountOf(assetID)
+	if supplied > supply {
+		return 0, errors.Data("TakeSnapshot: %d %s supplied is more than the module's supply %d", supplied, assetID, supply)
+	}
+	available := supply - min(supply, max(0, module.Borrowed.AmountOf(assetID)))
+	amount := dmath.DivI(dmath.Mul(big.NewInt(supplied), big.NewInt(available)), big.NewInt(supply), false)
+	return amount.Int64(), nil
+}
+
+// add a non-negative amount to another. Error if the sum does not fit in an int64.
+func add(a int64, b uint64) (int64, error) {
+	sum, err := dmath.CheckedAddU64(uint64(a), b)
+	if err != nil || sum > math.MaxInt64 {
+		return 0, errors.Data("amount %d + %d overflows", a, b)
+	}
+	return int64(sum), nil
+}
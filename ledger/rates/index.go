@@ -0,0 +1,110 @@
+package rates
+
+import (
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	dmath "github.com/dora-network/dora-service-utils/math"
+)
+
+// Interest compounds through the module's borrow and supply index of each asset, see types.IndexedBalance. The
+// module accrues first, growing its indices, and then users accrue at them, so users need not all accrue at once,
+// and a balance accrues the same interest however often it accrues. Balances accrue interest on their principal
+// when they last accrued, so users must be accrued before what they borrow or supply changes.
+
+// Growth returns the factor a balance grows by, compounding continuously at an annual rate over a number of
+// seconds, scaled by types.IndexScale and rounded down.
+func Growth(rate float64, seconds int64) *big.Int {
+	x := new(big.Float).SetPrec(256).SetFloat64(rate)
+	x.Mul(x, new(big.Float).SetInt64(seconds))
+	x.Quo(x, new(big.Float).SetFloat64(SecondsPerYear))
+	growth := dmath.Exponential(x)
+	growth.Mul(growth, new(big.Float).SetInt(types.IndexScale))
+	result, _ := growth.Int(nil)
+	return result
+}
+
+// AccrueModule compounds the borrow interest of every asset with a model from when the module last accrued until
+// now, at the borrow rate of the asset's current utilization, growing its borrow index. Suppliers earn the
+// interest borrowers accrue, less the reserve factor, which grows the supply index. The module's Owed and Earned
+// are the total interest on the module's borrows and supply, and its Reserves the difference. Balances are then
+// rebased on the module's current borrows and supply. Error if the module last accrued after now.
+func (ms Models) AccrueModule(module *types.Module, interest *types.AssetInterest, now time.Time) error {
+	seconds := now.Unix() - interest.LastUpdated.Unix()
+	if seconds < 0 {
+		return errors.Newf(errors.InvalidInputError, "module last accrued interest after %s", now)
+	}
+	assetIDs := make([]string, 0, len(ms))
+	for assetID := range ms {
+		assetIDs = append(assetIDs, assetID)
+	}
+	sort.Strings(assetIDs)
+
+	for _, assetID := range assetIDs {
+		m := ms[assetID]
+		borrowIndex := interest.BorrowIndex.Of(assetID)
+		borrows := carried(interest, assetID, borrowIndex)
+
+		before := borrows.Value(borrowIndex)
+		borrowIndex.Mul(borrowIndex, Growth(m.BorrowRate(ModuleUtilization(module, assetID)), seconds))
+		borrowIndex.Quo(borrowIndex, types.IndexScale)
+		after := borrows.Value(borrowIndex)
+
+		interest.Owed = set(interest.Owed, assetID, borrows.Interest(borrowIndex))
+		interest.BorrowIndex[assetID] = borrowIndex
+		distribute(module, interest, assetID, after.Sub(after, before), m.ReserveFactor)
+
+		borrows.Rebase(module.Borrowed.AmountOf(assetID)+module.Virtual.AmountOf(assetID), borrowIndex)
+		store(interest.Borrows, assetID, borrows)
+	}
+	interest.LastUpdated = now
+	return nil
+}
+
+// AccrueUser accrues a user's interest at the module's indices, which must have accrued until now, see
+// AccrueModule. Users start accruing interest on their borrows and supply when they first accrue. Returns the
+// interest the user accrued on their borrows and earned on their supply since they last accrued. Error if they
+// last accrued after now, or they borrow or supply an asset without a model.
+func (ms Models) AccrueUser(
+	p *types.Position,
+	interest, moduleInterest *types.AssetInterest,
+	now time.Time,
+) (owed, earned *types.Balances, err error) {
+	if interest.LastUpdated.After(now) {
+		return nil, nil, errors.Newf(errors.InvalidInputError, "user %s last accrued interest after %s", p.UserID, now)
+	}
+	for _, assetID := range append(p.Owned.NegativeAssets(), p.Supplied.PositiveAssets()...) {
+		if _, ok := ms[assetID]; !ok {
+			return nil, nil, errors.NewAssetNotFound(assetID)
+		}
+	}
+	owed = types.EmptyBalances()
+	for _, assetID := range accruing(p.Owned.NegativeAssets(), interest.Borrows) {
+		index := moduleInterest.BorrowIndex.Of(assetID)
+		borrows := carried(interest, assetID, index)
+		total := borrows.Interest(index)
+		owed = set(owed, assetID, total-interest.Owed.AmountOf(assetID))
+		interest.Owed = set(interest.Owed, assetID, total)
+		borrows.Rebase(p.Debt(assetID), index)
+		store(interest.Borrows, assetID, borrows)
+	}
+	earned = Credit(p, interest, moduleInterest)
+	interest.LastUpdated = now
+	return owed, earned, nil
+}
+
+// carried returns a copy of an asset's indexed borrows. Interest owed before borrows were indexed, when there is no
+// indexed balance yet, is carried over into it as accrued at the index, rounded up, so it is not lost.
+func carried(interest *types.AssetInterest, assetID string, index *big.Int) *types.IndexedBalance {
+	b := indexed(interest.Borrows, assetID)
+	if _, ok := interest.Borrows[assetID]; ok || interest.Owed.AmountOf(assetID) <= 0 {
+		return b
+	}
+	scaled := new(big.Int).Mul(big.NewInt(interest.Owed.AmountOf(assetID)), types.IndexScale)
+	scaled.Mul(scaled, types.IndexScale)
+	b.Scaled = dmath.DivI(scaled, index, true)
+	return b
+}
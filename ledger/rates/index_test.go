@@ -0,0 +1,138 @@
+package rates_test
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/rates"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func TestGrowth(t *testing.T) {
+	require.Equal(t, types.IndexScale, rates.Growth(0.04, 0))
+	// e to the float64 nearest 0.04
+	want, _ := new(big.Int).SetString("1040810774192388227623693822", 10)
+	require.Equal(t, want, rates.Growth(0.04, int64(rates.SecondsPerYear)))
+}
+
+// lending is a borrower and a supplier of stable, accruing interest.
+type lending struct {
+	module                           *types.Module
+	borrower, supplier               *types.Position
+	moduleInterest, borrowerInterest *types.AssetInterest
+	supplierInterest                 *types.AssetInterest
+}
+
+func newLending(start time.Time) *lending {
+	l := &lending{
+		module:           types.InitialModule(),
+		borrower:         types.InitialPosition(consts.UserIDOne),
+		supplier:         types.InitialPosition(consts.UserIDTwo),
+		moduleInterest:   types.InitialAssetInterest(start),
+		borrowerInterest: types.InitialAssetInterest(start),
+		supplierInterest: types.InitialAssetInterest(start),
+	}
+	l.module.Supplied = types.NewBalances(consts.StableID, 1_000_000)
+	l.module.Borrowed = types.NewBalances(consts.StableID, 400_000)
+	l.borrower.Owned = types.NewBalances(consts.StableID, -400_000)
+	l.supplier.Supplied = types.NewBalances(consts.StableID, 1_000_000)
+	return l
+}
+
+func (l *lending) accrue(t *testing.T, models rates.Models, now time.Time) (owed, earned *types.Balances) {
+	require.NoError(t, models.AccrueModule(l.module, l.moduleInterest, now))
+	owed, _, err := models.AccrueUser(l.borrower, l.borrowerInterest, l.moduleInterest, now)
+	require.NoError(t, err)
+	_, earned, err = models.AccrueUser(l.supplier, l.supplierInterest, l.moduleInterest, now)
+	require.NoError(t, err)
+	return owed, earned
+}
+
+func TestModels_Accrue(t *testing.T) {
+	require := require.New(t)
+	models := rates.Models{consts.StableID: {Base: 0.04, ReserveFactor: 0.1}}
+	start := time.Unix(1_700_000_000, 0)
+	year := time.Duration(rates.SecondsPerYear) * time.Second
+
+	// the first accrual starts accruing
+	once := newLending(start)
+	owed, earned := once.accrue(t, models, start)
+	require.Equal(types.EmptyBalances(), owed)
+	require.Equal(types.EmptyBalances(), earned)
+
+	// a year at 4%, compounded continuously, of which suppliers earn all but the 10% reserve
+	owed, earned = once.accrue(t, models, start.Add(year))
+	require.Equal(int64(16_324), owed.AmountOf(consts.StableID))
+	require.Equal(int64(14_691), earned.AmountOf(consts.StableID))
+	require.Equal(int64(16_324), once.moduleInterest.Owed.AmountOf(consts.StableID))
+	require.Equal(int64(14_691), once.moduleInterest.Earned.AmountOf(consts.StableID))
+	require.Equal(int64(1_633), once.moduleInterest.Reserves.AmountOf(consts.StableID))
+
+	// accruing monthly accrues the same
+	monthly := newLending(start)
+	monthly.accrue(t, models, start)
+	for month := 1; month <= 12; month++ {
+		monthly.accrue(t, models, start.Add(year*time.Duration(month)/12))
+	}
+	require.Equal(once.borrowerInterest.Owed, monthly.borrowerInterest.Owed)
+	require.Equal(once.supplierInterest.Earned, monthly.supplierInterest.Earned)
+	require.Equal(once.moduleInterest.Reserves, monthly.moduleInterest.Reserves)
+
+	// interest compounds on interest, after the borrower repays
+	once.borrower.Owned = types.EmptyBalances()
+	once.module.Borrowed = types.EmptyBalances()
+	once.accrue(t, models, start.Add(year))
+	owed, _ = once.accrue(t, models, start.Add(2*year))
+	require.Equal(int64(666), owed.AmountOf(consts.StableID))
+
+	// accrual cannot go back in time, or accrue assets without models
+	require.Error(models.AccrueModule(once.module, once.moduleInterest, start))
+	_, _, err := models.AccrueUser(once.borrower, once.borrowerInterest, once.moduleInterest, start)
+	require.Error(err)
+	once.borrower.Owned = types.NewBalances(consts.BondID, -1)
+	_, _, err = models.AccrueUser(once.borrower, once.borrowerInterest, once.moduleInterest, start.Add(2*year))
+	require.True(errors.Is(err, errors.NotFoundError))
+}
+
+func TestModels_AccrueCarriesOwed(t *testing.T) {
+	require := require.New(t)
+	models := rates.Models{consts.StableID: {Base: 0.04, ReserveFactor: 0.1}}
+	start := time.Unix(1_700_000_000, 0)
+	year := time.Duration(rates.SecondsPerYear) * time.Second
+
+	// interest owed before borrows were indexed is kept, and compounds from then on
+	l := newLending(start)
+	l.moduleInterest.Owed = types.NewBalances(consts.StableID, 16_000)
+	l.borrowerInterest.Owed = types.NewBalances(consts.StableID, 16_000)
+	owed, _ := l.accrue(t, models, start)
+	require.Equal(types.EmptyBalances(), owed)
+	require.Equal(int64(16_000), l.borrowerInterest.Owed.AmountOf(consts.StableID))
+	require.Equal(int64(16_000), l.moduleInterest.Owed.AmountOf(consts.StableID))
+
+	owed, _ = l.accrue(t, models, start.Add(year))
+	require.Equal(int64(16_324+653), owed.AmountOf(consts.StableID))
+	require.Equal(int64(16_000+16_324+653), l.borrowerInterest.Owed.AmountOf(consts.StableID))
+}
+
+func TestAssetInterest_JSON(t *testing.T) {
+	require := require.New(t)
+	models := rates.Models{consts.StableID: {Base: 0.04, ReserveFactor: 0.1}}
+	start := time.Unix(1_700_000_000, 0)
+	l := newLending(start)
+	l.accrue(t, models, start)
+	l.accrue(t, models, start.Add(time.Hour))
+
+	// indices survive storage at full precision
+	data, err := l.moduleInterest.MarshalBinary()
+	require.NoError(err)
+	stored := new(types.AssetInterest)
+	require.NoError(stored.UnmarshalBinary(data))
+	require.Equal(l.moduleInterest.BorrowIndex, stored.BorrowIndex)
+	require.Equal(l.moduleInterest.Borrows, stored.Borrows)
+	require.Equal(0, stored.BorrowIndex.Of(consts.StableID).Cmp(l.moduleInterest.BorrowIndex.Of(consts.StableID)))
+}
@@ -0,0 +1,100 @@
+// Package rates models lending interest rates per asset, from the utilization of the asset's supply.
+package rates
+
+import (
+	"math"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+)
+
+// SecondsPerYear is the length of the year which annual rates are over: 365.2425 days.
+const SecondsPerYear = 31556952.0
+
+// Model is a kinked utilization curve of an asset's annual borrow rate. The rate rises from Base by Slope1 as
+// utilization rises to Kink, and then more steeply, by Slope2, as utilization rises to 1, so that borrowers are
+// charged more as supply runs out.
+type Model struct {
+	Base   float64 `json:"base"`
+	Slope1 float64 `json:"slope1"`
+	Kink   float64 `json:"kink"`
+	Slope2 float64 `json:"slope2"`
+	// ReserveFactor is the part of borrowers' interest which the module keeps, rather than paying to suppliers.
+	ReserveFactor float64 `json:"reserve_factor"`
+}
+
+// Validate that the model's rates are not negative, and its kink and reserve factor are in [0, 1].
+func (m Model) Validate() error {
+	for _, f := range []float64{m.Base, m.Slope1, m.Kink, m.Slope2, m.ReserveFactor} {
+		if math.IsNaN(f) || math.IsInf(f, 0) || f < 0 {
+			return errors.Data("invalid interest rate model %+v", m)
+		}
+	}
+	if m.Kink > 1 {
+		return errors.Data("interest rate model kink %v above 1", m.Kink)
+	}
+	if m.ReserveFactor > 1 {
+		return errors.Data("interest rate model reserve factor %v above 1", m.ReserveFactor)
+	}
+	return nil
+}
+
+// BorrowRate returns the annual borrow rate at a utilization, which is clamped to [0, 1].
+func (m Model) BorrowRate(utilization float64) float64 {
+	u := max(0, min(1, utilization))
+	if u <= m.Kink {
+		if m.Kink == 0 {
+			return m.Base
+		}
+		return m.Base + m.Slope1*u/m.Kink
+	}
+	return m.Base + m.Slope1 + m.Slope2*(u-m.Kink)/(1-m.Kink)
+}
+
+// SupplyRate returns the annual rate suppliers earn at a utilization: the borrow rate, paid on the utilized part
+// of supply, less the reserve factor.
+func (m Model) SupplyRate(utilization float64) float64 {
+	u := max(0, min(1, utilization))
+	return m.BorrowRate(u) * u * (1 - m.ReserveFactor)
+}
+
+// Utilization returns the part of an asset's supply which is borrowed, in [0, 1]. Zero if nothing is supplied or
+// borrowed, and 1 if borrows exceed supply.
+func Utilization(supplied, borrowed int64) float64 {
+	if borrowed <= 0 {
+		return 0
+	}
+	if supplied <= borrowed {
+		return 1
+	}
+	return float64(borrowed) / float64(supplied)
+}
+
+// ModuleUtilization returns the utilization of an asset's supply to the module.
+func ModuleUtilization(module *types.Module, assetID string) float64 {
+	return Utilization(module.Supplied.AmountOf(assetID), module.Borrowed.AmountOf(assetID))
+}
+
+// Models are the interest rate models of assets, by asset ID.
+type Models map[string]Model
+
+// Validate all the models.
+func (ms Models) Validate() error {
+	for assetID, m := range ms {
+		if err := m.Validate(); err != nil {
+			return errors.Wrap(errors.InvalidDataErr, err, "asset "+assetID)
+		}
+	}
+	return nil
+}
+
+// Rates returns an asset's annual borrow and supply rates, at the utilization of its supply to the module.
+// Error if the asset has no model.
+func (ms Models) Rates(module *types.Module, assetID string) (borrow, supply float64, err error) {
+	m, ok := ms[assetID]
+	if !ok {
+		return 0, 0, errors.NewAssetNotFound(assetID)
+	}
+	u := ModuleUtilization(module, assetID)
+	return m.BorrowRate(u), m.SupplyRate(u), nil
+}
@@ -0,0 +1,72 @@
+package rates_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/rates"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func TestModel(t *testing.T) {
+	m := rates.Model{Base: 0.02, Slope1: 0.04, Kink: 0.8, Slope2: 0.75}
+	require.NoError(t, m.Validate())
+
+	for _, tt := range []struct {
+		utilization, borrow, supply float64
+	}{
+		{0, 0.02, 0},
+		{0.4, 0.04, 0.016},
+		{0.8, 0.06, 0.048},
+		{0.9, 0.435, 0.3915},
+		{1, 0.81, 0.81},
+		// clamped
+		{-1, 0.02, 0},
+		{2, 0.81, 0.81},
+	} {
+		require.InDelta(t, tt.borrow, m.BorrowRate(tt.utilization), 1e-12, tt.utilization)
+		require.InDelta(t, tt.supply, m.SupplyRate(tt.utilization), 1e-12, tt.utilization)
+	}
+
+	// a kink at one has no second slope, and at zero the first slope applies at once
+	require.InDelta(t, 0.435, rates.Model{Base: 0.02, Slope1: 0.04, Slope2: 0.75}.BorrowRate(0.5), 1e-12)
+	require.InDelta(t, 0.04, rates.Model{Base: 0.02, Slope1: 0.04, Kink: 1, Slope2: 0.75}.BorrowRate(0.5), 1e-12)
+
+	require.Error(t, rates.Model{Base: -0.01}.Validate())
+	require.Error(t, rates.Model{Kink: 1.5}.Validate())
+	require.Error(t, rates.Model{Slope2: math.NaN()}.Validate())
+	require.Error(t, rates.Models{consts.StableID: {Kink: 2}}.Validate())
+}
+
+func TestUtilization(t *testing.T) {
+	require.Equal(t, 0.0, rates.Utilization(0, 0))
+	require.Equal(t, 0.0, rates.Utilization(100, 0))
+	require.Equal(t, 0.25, rates.Utilization(100, 25))
+	require.Equal(t, 1.0, rates.Utilization(100, 100))
+	require.Equal(t, 1.0, rates.Utilization(0, 25))
+}
+
+func TestModels_Rates(t *testing.T) {
+	require := require.New(t)
+	models := rates.Models{
+		consts.StableID: {Base: 0.02, Slope1: 0.04, Kink: 0.8, Slope2: 0.75, ReserveFactor: 0.1},
+	}
+	require.NoError(models.Validate())
+
+	module := types.InitialModule()
+	module.Supplied = types.NewBalances(consts.StableID, 1_000_000)
+	module.Borrowed = types.NewBalances(consts.StableID, 400_000)
+	borrow, supply, err := models.Rates(module, consts.StableID)
+	require.NoError(err)
+	require.InDelta(0.04, borrow, 1e-12)
+	// suppliers earn the borrow rate on the utilized part of supply, less the reserve factor
+	require.InDelta(0.0144, supply, 1e-12)
+
+	_, _, err = models.Rates(module, consts.BondID)
+	require.True(errors.Is(err, errors.NotFoundError))
+	require.Error(rates.Models{consts.StableID: {ReserveFactor: 1.5}}.Validate())
+}
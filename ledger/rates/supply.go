@@ -0,0 +1,106 @@
+package rates
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/dora-network/dora-service-utils/ledger/types"
+)
+
+// Suppliers earn borrowers' interest through the module's supply index of each asset, rather than being credited
+// on every accrual: the index grows by the interest suppliers earn, in proportion to what they supply, and each
+// user's supply is an indexed balance at it, see types.IndexedBalance, which records where they were last
+// credited, so what they earned since is what their balance grew by.
+
+// distribute interest accrued on an asset, scaled by types.IndexScale, to its suppliers, growing the module's
+// supply index, and rebase the module's supply on what it supplies now.
+func distribute(
+	module *types.Module,
+	interest *types.AssetInterest,
+	assetID string,
+	accrued *big.Int,
+	reserveFactor float64,
+) {
+	supplies := indexed(interest.Supplies, assetID)
+	index := interest.SupplyIndex.Of(assetID)
+
+	// suppliers' part of the interest grows the supply index in proportion to their supply
+	share := new(big.Float).SetInt(accrued)
+	earned, _ := share.Mul(share, new(big.Float).SetFloat64(1-reserveFactor)).Int(nil)
+	if supplied := supplies.Value(index); supplied.Sign() > 0 && earned.Sign() > 0 {
+		index.Mul(index, earned.Add(earned, supplied))
+		index.Quo(index, supplied)
+	}
+
+	total := supplies.Interest(index)
+	interest.Earned = set(interest.Earned, assetID, total)
+	interest.Reserves = set(interest.Reserves, assetID, max(0, interest.Owed.AmountOf(assetID)-total))
+	interest.SupplyIndex[assetID] = index
+	supplies.Rebase(module.Supplied.AmountOf(assetID), index)
+	store(interest.Supplies, assetID, supplies)
+}
+
+// Credit a user with what they earned on their supply since they were last credited, at the module's supply
+// indices, adding it to their Earned interest, and rebase their supply on what they supply now. Returns the
+// earnings, rounded down. Users start earning when they are first credited, and must be credited before what
+// they supply changes.
+func Credit(p *types.Position, interest, moduleInterest *types.AssetInterest) *types.Balances {
+	earned := types.EmptyBalances()
+	for _, assetID := range accruing(p.Supplied.PositiveAssets(), interest.Supplies) {
+		index := moduleInterest.SupplyIndex.Of(assetID)
+		supplies := indexed(interest.Supplies, assetID)
+		total := supplies.Interest(index)
+		earned = set(earned, assetID, total-interest.Earned.AmountOf(assetID))
+		interest.Earned = set(interest.Earned, assetID, total)
+		supplies.Rebase(p.Supplied.AmountOf(assetID), index)
+		store(interest.Supplies, assetID, supplies)
+	}
+	return earned
+}
+
+// accruing returns the assets a user has a balance of, or has accrued interest on, sorted.
+func accruing(assetIDs []string, balances map[string]*types.IndexedBalance) []string {
+	for assetID := range balances {
+		assetIDs = append(assetIDs, assetID)
+	}
+	sort.Strings(assetIDs)
+	result := make([]string, 0, len(assetIDs))
+	for i, assetID := range assetIDs {
+		if i == 0 || assetID != assetIDs[i-1] {
+			result = append(result, assetID)
+		}
+	}
+	return result
+}
+
+// indexed returns a copy of an asset's indexed balance. Zero if it has none.
+func indexed(balances map[string]*types.IndexedBalance, assetID string) *types.IndexedBalance {
+	b := &types.IndexedBalance{Scaled: new(big.Int)}
+	if existing := balances[assetID]; existing != nil {
+		b.Principal = existing.Principal
+		if existing.Scaled != nil {
+			b.Scaled.Set(existing.Scaled)
+		}
+	}
+	return b
+}
+
+// store an asset's indexed balance, leaving zero balances out.
+func store(balances map[string]*types.IndexedBalance, assetID string, b *types.IndexedBalance) {
+	if b.IsZero() {
+		delete(balances, assetID)
+		return
+	}
+	balances[assetID] = b
+}
+
+// set an asset's amount in a copy of balances, leaving zero amounts out.
+func set(b *types.Balances, assetID string, amount int64) *types.Balances {
+	result := b.Copy()
+	if amount == 0 {
+		delete(result.Bals, assetID)
+	} else {
+		result.Bals[assetID] = amount
+	}
+	return result
+}
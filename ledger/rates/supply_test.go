@@ -0,0 +1,73 @@
+package rates_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/ledger/rates"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func TestCredit(t *testing.T) {
+	require := require.New(t)
+	models := rates.Models{
+		consts.StableID: {Base: 0.04, ReserveFactor: 0.1},
+		consts.BondID:   {Base: 0.1},
+	}
+	require.InDelta(0.0144, rates.Model{Base: 0.02, Slope1: 0.04, Kink: 0.8, ReserveFactor: 0.1}.SupplyRate(0.4), 1e-12)
+	start := time.Unix(1_700_000_000, 0)
+	year := time.Duration(rates.SecondsPerYear) * time.Second
+
+	one := types.InitialPosition(consts.UserIDOne)
+	one.Supplied = types.NewBalances(consts.StableID, 3_000_000)
+	two := types.InitialPosition(consts.UserIDTwo)
+	two.Supplied = types.NewBalances(consts.StableID, 1_000_000)
+	module := types.InitialModule()
+	module.Supplied = types.NewBalances(consts.StableID, 4_000_000)
+	module.Borrowed = types.NewBalances(consts.StableID, 400_000).AddAmount(consts.BondID, 1_000)
+
+	// suppliers start earning when they are first credited
+	moduleInterest := types.InitialAssetInterest(start)
+	oneInterest := types.InitialAssetInterest(start)
+	twoInterest := types.InitialAssetInterest(start)
+	require.NoError(models.AccrueModule(module, moduleInterest, start))
+	require.Equal(types.EmptyBalances(), rates.Credit(one, oneInterest, moduleInterest))
+	require.Equal(types.EmptyBalances(), rates.Credit(two, twoInterest, moduleInterest))
+
+	// a year at 4% is 16,324 stable of interest, 14,691 for suppliers and the rest reserved, and bond interest is
+	// all reserved, as nothing of it is supplied
+	require.NoError(models.AccrueModule(module, moduleInterest, start.Add(year)))
+	require.Equal(int64(16_324), moduleInterest.Owed.AmountOf(consts.StableID))
+	require.Equal(int64(14_691), moduleInterest.Earned.AmountOf(consts.StableID))
+	require.Equal(int64(1_633), moduleInterest.Reserves.AmountOf(consts.StableID))
+	require.Equal(moduleInterest.Owed.AmountOf(consts.BondID), moduleInterest.Reserves.AmountOf(consts.BondID))
+	require.Positive(moduleInterest.Reserves.AmountOf(consts.BondID))
+
+	// suppliers earn pro-rata, whenever they are credited
+	earned := rates.Credit(one, oneInterest, moduleInterest)
+	require.Equal(int64(11_018), earned.AmountOf(consts.StableID))
+	require.Equal(int64(11_018), oneInterest.Earned.AmountOf(consts.StableID))
+	require.Equal(int64(0), rates.Credit(one, oneInterest, moduleInterest).AmountOf(consts.StableID))
+
+	// and earn on what they earned before
+	require.NoError(models.AccrueModule(module, moduleInterest, start.Add(2*year)))
+	earned = rates.Credit(two, twoInterest, moduleInterest)
+	require.Greater(earned.AmountOf(consts.StableID), 2*int64(14_691)/4)
+	rates.Credit(one, oneInterest, moduleInterest)
+	require.InDelta(
+		moduleInterest.Earned.AmountOf(consts.StableID),
+		oneInterest.Earned.AmountOf(consts.StableID)+twoInterest.Earned.AmountOf(consts.StableID),
+		1,
+	)
+
+	// the index survives serialization at full precision
+	data, err := moduleInterest.MarshalBinary()
+	require.NoError(err)
+	decoded := new(types.AssetInterest)
+	require.NoError(decoded.UnmarshalBinary(data))
+	require.Equal(moduleInterest.SupplyIndex, decoded.SupplyIndex)
+	require.Equal(moduleInterest.Supplies, decoded.Supplies)
+}
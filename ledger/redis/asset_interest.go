@@ -0,0 +1,185 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/dora-network/dora-service-utils/ledger/rates"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/redis"
+	redisv9 "github.com/redis/go-redis/v9"
+)
+
+const assetInterestField = "interest"
+
+// UserAssetInterestKey is the key of a user's interest per asset. The module's total is under the user MODULE.
+func UserAssetInterestKey(userID string) string {
+	return fmt.Sprintf("interest:assets:users:%s", userID)
+}
+
+// GetAssetInterest returns users' interest per asset. Users who have not accrued any have initial interest, last
+// updated at the zero time.
+func GetAssetInterest(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	userIDs ...string,
+) (map[string]*types.AssetInterest, error) {
+	watch := redis.WatchKeys(UserAssetInterestKey, userIDs...)
+	var interests map[string]*types.AssetInterest
+	txFunc := func(tx *redisv9.Tx) error {
+		var err error
+		interests, err = getAssetInterestTx(ctx, tx, userIDs...)
+		return err
+	}
+	if err := redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		watch...,
+	); err != nil {
+		return nil, err
+	}
+	for _, userID := range userIDs {
+		if interests[userID] == nil {
+			interests[userID] = types.InitialAssetInterest(time.Time{})
+		}
+	}
+	return interests, nil
+}
+
+// SetAssetInterestCmd queues setting a user's interest per asset.
+func SetAssetInterestCmd(
+	ctx context.Context,
+	tx redis.Cmdable,
+	userID string,
+	interest *types.AssetInterest,
+) *redisv9.IntCmd {
+	return tx.HSet(ctx, UserAssetInterestKey(userID), assetInterestField, interest)
+}
+
+// AssetAccrual is the interest a user accrued per asset, in each asset's units, by one accrual.
+type AssetAccrual struct {
+	// Owed is the interest accrued on the user's borrows.
+	Owed *types.Balances `json:"owed"`
+	// Earned is the interest credited on the user's supply.
+	Earned *types.Balances `json:"earned"`
+}
+
+// AccrueAssetInterest accrues the module's interest per asset, compounding each asset's borrow and supply index
+// at the rates for the current utilization of its supply, see rates.Models.AccrueModule, and then accrues users'
+// interest on their borrows and supply at the indices, see rates.Models.AccrueUser. Interest is in each asset's
+// own units. The indices are stored at full precision, so interest does not depend on how often it accrues, but
+// users must be accrued before what they borrow or supply changes. Users start accruing when they first accrue.
+// Returns the interest each user accrued. Error if an asset has no model, or a user last accrued after now.
+func AccrueAssetInterest(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	models rates.Models,
+	userIDs []string,
+	opts ...AccrualOption,
+) (map[string]*AssetAccrual, error) {
+	config := newAccrualConfig(opts...)
+	watch := append(
+		[]string{ModulePositionKey(), UserAssetInterestKey(MODULE)},
+		redis.WatchKeys(UserAssetInterestKey, userIDs...)...,
+	)
+	watch = append(watch, GetUsersPositionKeys(userIDs...)...)
+
+	var accruals map[string]*AssetAccrual
+	txFunc := func(tx *redisv9.Tx) error {
+		now := config.clock.Now()
+		module := new(types.Module)
+		if err := GetModulePositionCmd(ctx, tx).Scan(module); err != nil {
+			if !errors.Is(err, redisv9.Nil) {
+				return err
+			}
+			module = types.InitialModule()
+		}
+		positions, err := getUsersPositionTx(ctx, tx, userIDs...)
+		if err != nil {
+			return err
+		}
+		interests, err := getAssetInterestTx(ctx, tx, append([]string{MODULE}, userIDs...)...)
+		if err != nil {
+			return err
+		}
+		moduleInterest := interests[MODULE]
+		if moduleInterest == nil {
+			moduleInterest = types.InitialAssetInterest(now)
+		}
+
+		if err := models.AccrueModule(module, moduleInterest, now); err != nil {
+			return backoff.Permanent(err)
+		}
+		accruals = make(map[string]*AssetAccrual)
+		for _, userID := range userIDs {
+			if interests[userID] == nil {
+				interests[userID] = types.InitialAssetInterest(now)
+			}
+			owed, earned, err := models.AccrueUser(positions[userID], interests[userID], moduleInterest, now)
+			if err != nil {
+				return backoff.Permanent(err)
+			}
+			accruals[userID] = &AssetAccrual{Owed: owed, Earned: earned}
+		}
+
+		_, err = tx.TxPipelined(
+			ctx, func(pipe redisv9.Pipeliner) error {
+				for _, userID := range userIDs {
+					SetAssetInterestCmd(ctx, pipe, userID, interests[userID])
+				}
+				SetAssetInterestCmd(ctx, pipe, MODULE, moduleInterest)
+				return nil
+			},
+		)
+		return err
+	}
+
+	if err := redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		watch...,
+	); err != nil {
+		return nil, err
+	}
+	return accruals, nil
+}
+
+// getAssetInterestTx returns the interest per asset of the users who have accrued any.
+func getAssetInterestTx(
+	ctx context.Context,
+	tx redis.Cmdable,
+	userIDs ...string,
+) (map[string]*types.AssetInterest, error) {
+	cmds, err := tx.TxPipelined(
+		ctx, func(pipe redisv9.Pipeliner) error {
+			for _, userID := range userIDs {
+				pipe.HGet(ctx, UserAssetInterestKey(userID), assetInterestField)
+			}
+			return nil
+		},
+	)
+	if err != nil && !errors.Is(err, redisv9.Nil) {
+		return nil, err
+	}
+	interests := make(map[string]*types.AssetInterest)
+	for i, cmd := range cmds {
+		interest := new(types.AssetInterest)
+		if err := cmd.(*redisv9.StringCmd).Scan(interest); err != nil {
+			if errors.Is(err, redisv9.Nil) {
+				continue
+			}
+			return nil, err
+		}
+		interests[userIDs[i]] = interest
+	}
+	return interests, nil
+}
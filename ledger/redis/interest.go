@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/dora-network/dora-service-utils/clock"
 	"github.com/dora-network/dora-service-utils/helpers"
 	"github.com/dora-network/dora-service-utils/ledger/types"
 	"github.com/dora-network/dora-service-utils/redis"
@@ -183,7 +184,35 @@ func setUserInterestTx(ctx context.Context, tx redis.Cmdable, userID string, int
 	return nil
 }
 
-func AccrueLendingInterest(ctx context.Context, rdb redis.Client, timeout time.Duration, userID string, assetData helpers.AssetData, flatRate float64) (*TxLendingInterestAccrual, error) {
+// AccrualOption configures interest accrual.
+type AccrualOption func(config *accrualConfig)
+
+type accrualConfig struct {
+	clock clock.Clock
+}
+
+func newAccrualConfig(opts ...AccrualOption) accrualConfig {
+	config := accrualConfig{clock: clock.System}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// WithClock accrues interest up to the time told by c, rather than the system time.
+func WithClock(c clock.Clock) AccrualOption {
+	return func(config *accrualConfig) {
+		config.clock = clock.OrSystem(c)
+	}
+}
+
+// AccrueLendingInterest accrues simple interest on the USD value of a user's borrows at a single flat rate.
+// Suppliers earn nothing from it, so the accrual's Earned is always zero.
+//
+// Deprecated: use AccrueAssetInterest, which accrues per-asset rates in the borrowed assets' units, and credits
+// suppliers through the module's supply index.
+func AccrueLendingInterest(ctx context.Context, rdb redis.Client, timeout time.Duration, userID string, assetData helpers.AssetData, flatRate float64, opts ...AccrualOption) (*TxLendingInterestAccrual, error) {
+	config := newAccrualConfig(opts...)
 	// this has to be calculated within one transaction, we don't want positions changing between reads etc.
 	// as this could lead to inconsistencies
 	watch := []string{
@@ -196,7 +225,7 @@ func AccrueLendingInterest(ctx context.Context, rdb redis.Client, timeout time.D
 	var accrualTransaction *TxLendingInterestAccrual
 
 	txFunc := func(tx *redisv9.Tx) error {
-		transaction, err := accrueLendingInterestTx(ctx, tx, userID, assetData, flatRate)
+		transaction, err := accrueLendingInterestTx(ctx, tx, userID, assetData, flatRate, config)
 		if err != nil {
 			return err
 		}
@@ -213,13 +242,24 @@ func AccrueLendingInterest(ctx context.Context, rdb redis.Client, timeout time.D
 	return accrualTransaction, nil
 }
 
+// AccrueAllLendingInterest is AccrueLendingInterest for many users in one transaction.
+//
+// Deprecated: use AccrueAssetInterest.
 func AccrueAllLendingInterest(ctx context.Context, rdb redis.Client, timeout time.Duration, assetData helpers.AssetData, flatRate float64, watch []string, users ...string) ([]TxLendingInterestAccrual, error) {
+	return AccrueAllLendingInterestWithOptions(ctx, rdb, timeout, assetData, flatRate, watch, users)
+}
+
+// AccrueAllLendingInterestWithOptions is AccrueAllLendingInterest with accrual options.
+//
+// Deprecated: use AccrueAssetInterest.
+func AccrueAllLendingInterestWithOptions(ctx context.Context, rdb redis.Client, timeout time.Duration, assetData helpers.AssetData, flatRate float64, watch []string, users []string, opts ...AccrualOption) ([]TxLendingInterestAccrual, error) {
+	config := newAccrualConfig(opts...)
 	watch = append(watch, UserInterestKey(MODULE), ModulePositionKey())
 	var accrualTransactions []TxLendingInterestAccrual
 
 	txFunc := func(tx *redisv9.Tx) error {
 		for _, userID := range users {
-			transaction, err := accrueLendingInterestTx(ctx, tx, userID, assetData, flatRate)
+			transaction, err := accrueLendingInterestTx(ctx, tx, userID, assetData, flatRate, config)
 			if err != nil {
 				return err
 			}
@@ -238,8 +278,8 @@ func AccrueAllLendingInterest(ctx context.Context, rdb redis.Client, timeout tim
 	return accrualTransactions, nil
 }
 
-func accrueLendingInterestTx(ctx context.Context, tx redis.Cmdable, userID string, assetData helpers.AssetData, flatRate float64) (*TxLendingInterestAccrual, error) {
-	now := time.Now()
+func accrueLendingInterestTx(ctx context.Context, tx redis.Cmdable, userID string, assetData helpers.AssetData, flatRate float64, config accrualConfig) (*TxLendingInterestAccrual, error) {
+	now := config.clock.Now()
 
 	// first get the module positions
 	var (
@@ -295,7 +335,7 @@ func accrueLendingInterestTx(ctx context.Context, tx redis.Cmdable, userID strin
 		userInterest = interest[0]
 	}
 
-	if userInterest.LastUpdated.After(time.Now()) {
+	if userInterest.LastUpdated.After(now) {
 		return nil, fmt.Errorf("last updated time is in the future")
 	}
 
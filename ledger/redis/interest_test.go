@@ -5,7 +5,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dora-network/dora-service-utils/helpers"
+	"github.com/dora-network/dora-service-utils/ledger/rates"
 	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/testing/fakeclock"
 	"github.com/dora-network/dora-service-utils/testing/integration"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -245,4 +248,88 @@ func TestUserInterest_Redis(t *testing.T) {
 		assert.Len(t, positions, 1)
 		assert.Equal(t, emptyPosition, positions[userID])
 	})
+
+	t.Run("should accrue interest up to the injected clock's time", func(tt *testing.T) {
+		userID := "clock-user"
+		from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		fc := fakeclock.New(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		position := types.InitialPosition(userID)
+		position.Owned = types.NewBalances("USD", -1_000_000)
+		require.NoError(tt, SetUsersPosition(ctx, rdb, time.Second, map[string]*types.Position{userID: position}))
+		require.NoError(
+			tt,
+			SetUserInterest(ctx, rdb, time.Second, map[string]*types.Interest{userID: {LastUpdated: from}}),
+		)
+
+		ad := helpers.AssetData{}
+		require.NoError(tt, ad.RegisterAsset("USD", 0, 0, 0, true, false, true, true, false, false, nil))
+		require.NoError(tt, ad.UpdatePrice("USD", 1))
+
+		accrual, err := AccrueLendingInterest(ctx, rdb, time.Second, userID, ad, 0.05, WithClock(fc))
+		require.NoError(tt, err)
+		assert.Equal(tt, from.Unix(), int64(accrual.FromUnixTime))
+		assert.Equal(tt, fc.Now().Unix(), int64(accrual.ToUnixTime))
+
+		// 2024 is a leap year, so 366 days elapse
+		years := float64(366*24*60*60) / secondsPerYear
+		want := uint64(years * 0.05 * 1_000_000)
+		interests, err := GetUserInterest(ctx, rdb, time.Second, userID)
+		require.NoError(tt, err)
+		require.Len(tt, interests, 1)
+		assert.Equal(tt, want, interests[0].Owed)
+
+		// a clock before the last update is rejected
+		fc.Set(from.Add(-time.Hour))
+		_, err = AccrueLendingInterest(ctx, rdb, time.Second, userID, ad, 0.05, WithClock(fc))
+		require.Error(tt, err)
+	})
+
+	t.Run("should accrue compound interest per asset at utilization-based rates", func(tt *testing.T) {
+		userID, supplierID := "asset-interest-user", "asset-interest-supplier"
+		from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		fc := fakeclock.New(from)
+		models := rates.Models{"USD": {Base: 0.02, Slope1: 0.04, Kink: 0.8, Slope2: 0.75, ReserveFactor: 0.1}}
+		users := []string{userID, supplierID}
+
+		position := types.InitialPosition(userID)
+		position.Owned = types.NewBalances("USD", -400_000)
+		supplier := types.InitialPosition(supplierID)
+		supplier.Supplied = types.NewBalances("USD", 1_000_000)
+		module := types.InitialModule()
+		module.Supplied = types.NewBalances("USD", 1_000_000)
+		module.Borrowed = types.NewBalances("USD", 400_000)
+		require.NoError(
+			tt,
+			SetUsersPosition(ctx, rdb, time.Second, map[string]*types.Position{userID: position, supplierID: supplier}),
+		)
+		require.NoError(tt, SetModulePosition(ctx, rdb, time.Second, module))
+
+		// the first accrual starts accruing
+		accruals, err := AccrueAssetInterest(ctx, rdb, time.Second, models, users, WithClock(fc))
+		require.NoError(tt, err)
+		assert.Equal(tt, types.EmptyBalances(), accruals[userID].Owed)
+		assert.Equal(tt, types.EmptyBalances(), accruals[supplierID].Earned)
+
+		// a year at 4% for 40% utilization, compounded, of which the supplier earns all but the 10% reserve
+		fc.Set(from.Add(time.Duration(rates.SecondsPerYear) * time.Second))
+		accruals, err = AccrueAssetInterest(ctx, rdb, time.Second, models, users, WithClock(fc))
+		require.NoError(tt, err)
+		assert.Equal(tt, int64(16_324), accruals[userID].Owed.AmountOf("USD"))
+		assert.Equal(tt, int64(14_691), accruals[supplierID].Earned.AmountOf("USD"))
+
+		interests, err := GetAssetInterest(ctx, rdb, time.Second, userID, supplierID, MODULE)
+		require.NoError(tt, err)
+		assert.Equal(tt, int64(16_324), interests[userID].Owed.AmountOf("USD"))
+		assert.Equal(tt, fc.Now().Unix(), interests[userID].LastUpdated.Unix())
+		assert.Equal(tt, int64(14_691), interests[supplierID].Earned.AmountOf("USD"))
+		assert.Equal(tt, int64(16_324), interests[MODULE].Owed.AmountOf("USD"))
+		assert.Equal(tt, int64(14_691), interests[MODULE].Earned.AmountOf("USD"))
+		assert.Equal(tt, int64(1_633), interests[MODULE].Reserves.AmountOf("USD"))
+
+		// a clock before the last update is rejected
+		fc.Set(from)
+		_, err = AccrueAssetInterest(ctx, rdb, time.Second, models, users, WithClock(fc))
+		require.Error(tt, err)
+	})
 }
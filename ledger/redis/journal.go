@@ -0,0 +1,147 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/redis"
+	redisv9 "github.com/redis/go-redis/v9"
+)
+
+const journalEntryField = "entry"
+
+// JournalStreamKey is the stream of journal entries, in the order they were applied.
+func JournalStreamKey() string {
+	return "ledger:journal"
+}
+
+// AppendJournalEntryCmd queues appending the entry to the journal. Redis assigns the entry's ID, which is the
+// command's result.
+func AppendJournalEntryCmd(ctx context.Context, tx redis.Cmdable, entry *types.JournalEntry) *redisv9.StringCmd {
+	return tx.XAdd(
+		ctx, &redisv9.XAddArgs{
+			Stream: JournalStreamKey(),
+			Values: map[string]any{journalEntryField: entry},
+		},
+	)
+}
+
+// ApplyJournalEntry applies the entry to the positions of the users it posts to, and to the module, and appends it
+// to the journal, atomically. Sets the entry's ID to its ID in the journal.
+func ApplyJournalEntry(ctx context.Context, rdb redis.Client, timeout time.Duration, entry *types.JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	userIDs := entry.UserIDs()
+	watch := GetUsersPositionKeys(userIDs...)
+	if entry.PostsToModule() {
+		watch = append(watch, ModulePositionKey())
+	}
+
+	var id string
+	txFunc := func(tx *redisv9.Tx) error {
+		positions, err := getUsersPositionTx(ctx, tx, userIDs...)
+		if err != nil {
+			return err
+		}
+		var module *types.Module
+		if entry.PostsToModule() {
+			module = new(types.Module)
+			if err := GetModulePositionCmd(ctx, tx).Scan(module); err != nil {
+				if !errors.Is(err, redisv9.Nil) {
+					return err
+				}
+				module = types.InitialModule()
+			}
+		}
+
+		if err := entry.Apply(positions, module); err != nil {
+			return backoff.Permanent(err)
+		}
+
+		var cmd *redisv9.StringCmd
+		if _, err := tx.TxPipelined(
+			ctx, func(pipe redisv9.Pipeliner) error {
+				SetUsersPositionCmd(ctx, pipe, positions)
+				if module != nil {
+					SetModulePositionCmd(ctx, pipe, module)
+				}
+				cmd = AppendJournalEntryCmd(ctx, pipe, entry)
+				return nil
+			},
+		); err != nil {
+			return err
+		}
+		id = cmd.Val()
+		return nil
+	}
+
+	if err := redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		watch...,
+	); err != nil {
+		return err
+	}
+
+	entry.ID = id
+	return nil
+}
+
+// ReadJournal returns up to count journal entries, oldest first, starting from the entry with ID start. Start is
+// "-" to read from the first entry, or "(" followed by the ID of the last entry read to read the entries after it.
+func ReadJournal(ctx context.Context, rdb redis.Cmdable, start string, count int64) ([]*types.JournalEntry, error) {
+	messages, err := rdb.XRangeN(ctx, JournalStreamKey(), start, "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*types.JournalEntry, len(messages))
+	for i, message := range messages {
+		value, ok := message.Values[journalEntryField].(string)
+		if !ok {
+			return nil, fmt.Errorf("journal entry %s has no %s field", message.ID, journalEntryField)
+		}
+		entry := new(types.JournalEntry)
+		if err := entry.UnmarshalBinary([]byte(value)); err != nil {
+			return nil, err
+		}
+		entry.ID = message.ID
+		entries[i] = entry
+	}
+	return entries, nil
+}
+
+// getUsersPositionTx reads the users' positions in a transaction. Users without a position have their initial
+// position.
+func getUsersPositionTx(ctx context.Context, tx redis.Cmdable, userIDs ...string) (map[string]*types.Position, error) {
+	cmds, err := GetUsersPositionCmd(ctx, tx, userIDs...)
+	if err != nil {
+		return nil, err
+	}
+	positions := make(map[string]*types.Position)
+	for _, cmd := range cmds {
+		res, err := cmd.(*redisv9.MapStringStringCmd).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range res {
+			p := new(types.Position)
+			if err := p.UnmarshalBinary([]byte(v)); err != nil {
+				return nil, err
+			}
+			positions[p.UserID] = p
+		}
+	}
+	for _, userID := range userIDs {
+		if _, ok := positions[userID]; !ok {
+			positions[userID] = types.InitialPosition(userID)
+		}
+	}
+	return positions, nil
+}
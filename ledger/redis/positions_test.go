@@ -143,4 +143,63 @@ func TestUserAndModulePosition_Redis(t *testing.T) {
 			})
 		},
 	)
+
+	t.Run(
+		"Should apply journal entries and read them back", func(tt *testing.T) {
+			entry, err := types.NewJournalEntry(
+				"supply", time.Now().Unix(),
+				types.Posting{Account: types.AccountExternal, AssetID: consts.BondID, Amount: -10},
+				types.Posting{Account: types.AccountModuleBalance, AssetID: consts.BondID, Amount: 10},
+				types.Posting{Account: types.AccountModuleSupplied, AssetID: consts.BondID, Amount: -10},
+				types.Posting{UserID: consts.UserIDTwo, Account: types.AccountSupplied, AssetID: consts.BondID, Amount: 10},
+			)
+			require.NoError(tt, err)
+			before, err := redis.GetModulePosition(ctx, rdb, time.Second)
+			require.NoError(tt, err)
+
+			require.NoError(tt, redis.ApplyJournalEntry(ctx, rdb, time.Second, entry))
+			require.NotEmpty(tt, entry.ID)
+
+			module, err := redis.GetModulePosition(ctx, rdb, time.Second)
+			require.NoError(tt, err)
+			assert.Equal(tt, before.Balance.AmountOf(consts.BondID)+10, module.Balance.AmountOf(consts.BondID))
+			assert.Equal(tt, before.Supplied.AmountOf(consts.BondID)+10, module.Supplied.AmountOf(consts.BondID))
+			positions, err := redis.GetUsersPosition(ctx, rdb, time.Second, consts.UserIDTwo)
+			require.NoError(tt, err)
+			assert.Equal(tt, int64(10), positions[consts.UserIDTwo].Supplied.AmountOf(consts.BondID))
+
+			// an entry which does not apply is not journaled
+			unbacked, err := types.NewJournalEntry(
+				"lock", time.Now().Unix(),
+				types.Posting{UserID: consts.UserIDTwo, Account: types.AccountAvailable, AssetID: consts.BondID, Amount: -1_000_000},
+				types.Posting{UserID: consts.UserIDTwo, Account: types.AccountLocked, AssetID: consts.BondID, Amount: 1_000_000},
+			)
+			require.NoError(tt, err)
+			require.Error(tt, redis.ApplyJournalEntry(ctx, rdb, time.Second, unbacked))
+
+			entries, err := redis.ReadJournal(ctx, rdb, "-", 10)
+			require.NoError(tt, err)
+			require.Len(tt, entries, 1)
+			assert.Equal(tt, entry, entries[0])
+			entries, err = redis.ReadJournal(ctx, rdb, "("+entry.ID, 10)
+			require.NoError(tt, err)
+			assert.Empty(tt, entries)
+		},
+	)
+
+	t.Run(
+		"Should reconcile the module with user positions", func(tt *testing.T) {
+			report, err := redis.ReconcileModule(ctx, rdb, time.Second, time.Now())
+			require.NoError(tt, err)
+			assert.Equal(tt, 2, report.Users)
+			positions, err := redis.GetUsersPosition(ctx, rdb, time.Second, consts.UserIDOne, consts.UserIDTwo)
+			require.NoError(tt, err)
+			supplied := positions[consts.UserIDOne].Supplied.AmountOf(consts.BondID) +
+				positions[consts.UserIDTwo].Supplied.AmountOf(consts.BondID)
+			assert.Equal(tt, supplied, report.Totals.Supplied.AmountOf(consts.BondID))
+			for _, d := range report.Discrepancies {
+				assert.Equal(tt, d.Module-d.Users, d.Difference)
+			}
+		},
+	)
 }
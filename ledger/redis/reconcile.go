@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/redis"
+	redisv9 "github.com/redis/go-redis/v9"
+)
+
+// ReconcileModule compares the module position with the aggregate of all users' positions, see
+// types.ReconcileModule. The module and positions are read from a single snapshot, so the report is consistent
+// even while they are being updated. To do so, it WATCHes the module and every user's position: any write to one of
+// them while they are read retries the read, so with many active users ReconcileModule may keep retrying until
+// timeout. Run it when writes are quiet, or with a timeout long enough to outlast them. ReconcileModule does not
+// modify anything.
+func ReconcileModule(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	now time.Time,
+) (*types.ModuleReconciliationReport, error) {
+	positionKeys, err := GetAllUsersPositionKeys(ctx, rdb)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := make([]string, len(positionKeys))
+	for i, key := range positionKeys {
+		userIDs[i] = strings.TrimPrefix(key, UserPositionKey(""))
+	}
+	watch := append([]string{ModulePositionKey()}, positionKeys...)
+
+	var report *types.ModuleReconciliationReport
+	txFunc := func(tx *redisv9.Tx) error {
+		module := new(types.Module)
+		if err := GetModulePositionCmd(ctx, tx).Scan(module); err != nil {
+			if !errors.Is(err, redisv9.Nil) {
+				return err
+			}
+			module = types.InitialModule()
+		}
+		positions, err := getUsersPositionTx(ctx, tx, userIDs...)
+		if err != nil {
+			return err
+		}
+		list := make([]*types.Position, 0, len(positions))
+		for _, p := range positions {
+			list = append(list, p)
+		}
+
+		report = types.ReconcileModule(module, list, now)
+		return nil
+	}
+
+	if err := redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		watch...,
+	); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
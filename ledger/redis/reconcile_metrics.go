@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/dora-network/dora-service-utils/ledger/types"
+)
+
+// ReconciliationGauges are Prometheus gauges of module reconciliation reports, see ReconcileModule.
+type ReconciliationGauges struct {
+	// Discrepancy is the size of each discrepancy, by asset and field. Reset by each report, so that
+	// discrepancies which have been resolved disappear.
+	Discrepancy *prometheus.GaugeVec
+	// Discrepancies is the number of discrepancies in the last report
+	Discrepancies prometheus.Gauge
+	// Users is the number of user positions checked by the last report
+	Users prometheus.Gauge
+	// LastRun is the time of the last report, in unix seconds
+	LastRun prometheus.Gauge
+}
+
+// NewReconciliationGauges returns the gauges, which must be registered, see ReconciliationGauges.Collectors.
+func NewReconciliationGauges(namespace string) *ReconciliationGauges {
+	return &ReconciliationGauges{
+		Discrepancy: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "ledger_reconciliation_discrepancy",
+				Help:      "Absolute difference between the module and the aggregate of user positions",
+			}, []string{"asset_id", "field"},
+		),
+		Discrepancies: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "ledger_reconciliation_discrepancies",
+				Help:      "Number of discrepancies found by the last ledger reconciliation",
+			},
+		),
+		Users: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "ledger_reconciliation_users",
+				Help:      "Number of user positions checked by the last ledger reconciliation",
+			},
+		),
+		LastRun: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "ledger_reconciliation_last_run_seconds",
+				Help:      "Unix time of the last ledger reconciliation",
+			},
+		),
+	}
+}
+
+// Collectors returns the gauges, for registering.
+func (g *ReconciliationGauges) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{g.Discrepancy, g.Discrepancies, g.Users, g.LastRun}
+}
+
+// Record sets the gauges from a report.
+func (g *ReconciliationGauges) Record(report *types.ModuleReconciliationReport) {
+	g.Discrepancy.Reset()
+	for _, d := range report.Discrepancies {
+		size := float64(d.Difference)
+		if size < 0 {
+			size = -size
+		}
+		g.Discrepancy.WithLabelValues(d.AssetID, d.Field).Set(size)
+	}
+	g.Discrepancies.Set(float64(len(report.Discrepancies)))
+	g.Users.Set(float64(report.Users))
+	g.LastRun.Set(float64(report.Time))
+}
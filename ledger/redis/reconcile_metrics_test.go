@@ -0,0 +1,49 @@
+package redis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/ledger/redis"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func TestReconciliationGauges(t *testing.T) {
+	require := require.New(t)
+	now := time.Unix(1_700_000_000, 0)
+
+	position, err := types.NewPosition(
+		consts.UserIDOne,
+		nil, nil,
+		types.NewBalances(consts.StableID, 1_000),
+		nil, nil, nil,
+		"", 0, 1,
+	)
+	require.NoError(err)
+	// the module forgot a supply of 50 stable
+	module, err := types.NewModule(
+		types.NewBalances(consts.StableID, 950),
+		types.NewBalances(consts.StableID, 950),
+		nil, nil, nil, nil,
+		0, 1,
+	)
+	require.NoError(err)
+	report := types.ReconcileModule(module, []*types.Position{position}, now)
+	require.Len(report.Discrepancies, 2)
+
+	gauges := redis.NewReconciliationGauges("test")
+	gauges.Record(report)
+	require.Equal(50.0, testutil.ToFloat64(gauges.Discrepancy.WithLabelValues(consts.StableID, types.ReconcileSupplied)))
+	require.Equal(2.0, testutil.ToFloat64(gauges.Discrepancies))
+	require.Equal(1.0, testutil.ToFloat64(gauges.Users))
+	require.Equal(float64(now.Unix()), testutil.ToFloat64(gauges.LastRun))
+
+	// resolved discrepancies disappear
+	gauges.Record(types.ReconcileModule(types.InitialModule(), nil, now))
+	require.Equal(0, testutil.CollectAndCount(gauges.Discrepancy))
+	require.Equal(0.0, testutil.ToFloat64(gauges.Discrepancies))
+}
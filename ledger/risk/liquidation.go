@@ -0,0 +1,206 @@
+package risk
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+)
+
+// LiquidationReason is the reason of liquidations' journal entries.
+const LiquidationReason = "liquidation"
+
+// Liquidation of a user by a liquidator, who repays part of the user's largest debt and seizes collateral worth
+// the repaid value plus the liquidation bonus.
+type Liquidation struct {
+	UserID     string `json:"user_id"`
+	Liquidator string `json:"liquidator"`
+	// Repaid is the debt the liquidator repays.
+	Repaid *types.Balance `json:"repaid"`
+	// Seized is the collateral the liquidator receives.
+	Seized *types.Balance `json:"seized"`
+	// Before and After are the health of the user's position before and after the liquidation.
+	Before *Health `json:"before"`
+	After  *Health `json:"after"`
+	// Entry posts the liquidation to the user's and liquidator's positions and the module, see Liquidate.
+	Entry *types.JournalEntry `json:"entry"`
+}
+
+// Plan the liquidation of a user by a liquidator at a time, without modifying their positions or the module.
+//
+// The liquidator repays the user's debt with the largest value, up to the close factor of it, and seizes the
+// user's collateral with the largest value, of the amount they have not locked, worth the repaid value plus the
+// liquidation bonus. If the user does not have enough of it, the liquidator repays less. Error
+// ErrLiquidationIneligible if the user is not liquidatable, ErrLiquidationLenZero if the user has no collateral
+// to seize or nothing to repay, or ErrInsufficientBalance if the liquidator does not have the debt to repay.
+func (e *Engine) Plan(user, liquidator *types.Position, module *types.Module, now time.Time) (*Liquidation, error) {
+	if user == nil || liquidator == nil || user.UserID == liquidator.UserID {
+		return nil, errors.New(errors.InvalidInputError, "liquidation needs a user and another user to liquidate them")
+	}
+	if module == nil {
+		return nil, errors.New(errors.InvalidInputError, "liquidation needs the module to repay debt to")
+	}
+	before, err := e.Health(user)
+	if err != nil {
+		return nil, err
+	}
+	if !before.Liquidatable() {
+		return nil, errors.Wrap(
+			errors.InvalidInputError,
+			errors.ErrLiquidationIneligible,
+			fmt.Sprintf("user %s has health factor %v", user.UserID, before.HealthFactor),
+		)
+	}
+
+	debtAsset, err := e.largest(user.Owned.NegativeAssets(), user.Debt, e.assetData.GetAssetValueInUSD)
+	if err != nil {
+		return nil, err
+	}
+	var collateral []string
+	for _, assetID := range user.Owned.PositiveAssets() {
+		lt, err := e.assetData.LiquidationThreshold(assetID)
+		if err != nil {
+			return nil, errors.Wrap(errors.InvalidDataErr, err, "Plan")
+		}
+		if lt > 0 && user.Available(assetID) > 0 {
+			collateral = append(collateral, assetID)
+		}
+	}
+	collateralAsset, err := e.largest(collateral, user.Available, e.assetData.GetCollateralValueInUSD)
+	if err != nil {
+		return nil, err
+	}
+	if debtAsset == "" || collateralAsset == "" {
+		return nil, errors.Wrap(
+			errors.InvalidInputError,
+			errors.ErrLiquidationLenZero,
+			"user "+user.UserID+" has no debt to repay or no collateral to seize",
+		)
+	}
+
+	repaid, seized, err := e.amounts(
+		debtAsset, user.Debt(debtAsset), collateralAsset, user.Available(collateralAsset),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if repaid <= 0 || seized <= 0 {
+		return nil, errors.Wrap(
+			errors.InvalidInputError,
+			errors.ErrLiquidationLenZero,
+			fmt.Sprintf("liquidating user %s repays %d %s for %d %s", user.UserID, repaid, debtAsset, seized, collateralAsset),
+		)
+	}
+	if liquidator.Available(debtAsset) < repaid {
+		return nil, errors.Wrap(
+			errors.InvalidInputError,
+			errors.ErrInsufficientBalance,
+			fmt.Sprintf("liquidator %s cannot repay %d %s", liquidator.UserID, repaid, debtAsset),
+		)
+	}
+
+	postings := []types.Posting{
+		{UserID: liquidator.UserID, Account: types.AccountOwned, AssetID: debtAsset, Amount: -repaid},
+		{UserID: user.UserID, Account: types.AccountOwned, AssetID: debtAsset, Amount: repaid},
+	}
+	postings = append(postings, types.RepayPostings(module, debtAsset, repaid)...)
+	postings = append(
+		postings,
+		types.Posting{UserID: user.UserID, Account: types.AccountOwned, AssetID: collateralAsset, Amount: -seized},
+		types.Posting{UserID: liquidator.UserID, Account: types.AccountOwned, AssetID: collateralAsset, Amount: seized},
+	)
+	// seized collateral repays any debt the liquidator owes of it, like a transfer
+	if owed := min(seized, liquidator.Debt(collateralAsset)); owed > 0 {
+		postings = append(postings, types.RepayPostings(module, collateralAsset, owed)...)
+	}
+	entry, err := types.NewJournalEntry(LiquidationReason, now.Unix(), postings...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the user's health after applying the entry to copies
+	userAfter := user.Copy()
+	positions := map[string]*types.Position{user.UserID: userAfter, liquidator.UserID: liquidator.Copy()}
+	if err := entry.Apply(positions, module.Copy()); err != nil {
+		return nil, err
+	}
+	after, err := e.Health(userAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Liquidation{
+		UserID:     user.UserID,
+		Liquidator: liquidator.UserID,
+		Repaid:     types.NewBalance(debtAsset, repaid),
+		Seized:     types.NewBalance(collateralAsset, seized),
+		Before:     before,
+		After:      after,
+		Entry:      entry,
+	}, nil
+}
+
+// Liquidate a user by a liquidator at a time, see Plan, applying the liquidation's journal entry to their positions
+// and the module. Either the liquidation succeeds or nothing is modified.
+func (e *Engine) Liquidate(user, liquidator *types.Position, module *types.Module, now time.Time) (*Liquidation, error) {
+	l, err := e.Plan(user, liquidator, module, now)
+	if err != nil {
+		return nil, err
+	}
+	positions := map[string]*types.Position{user.UserID: user, liquidator.UserID: liquidator}
+	if err := l.Entry.Apply(positions, module); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// amounts returns the amount of debt to repay, and of collateral to seize for it, given the user's debt and
+// collateral available to seize. They are valued as Health values them: the debt at its price, and the collateral
+// at its collateral price, see helpers.AssetData.CollateralPrice.
+func (e *Engine) amounts(debtAsset string, debt int64, collateralAsset string, available int64) (int64, int64, error) {
+	debtValue, err := e.assetData.GetAssetValueInUSD(1, debtAsset, 1)
+	if err != nil {
+		return 0, 0, errors.Wrap(errors.InvalidDataErr, err, "Plan")
+	}
+	collateralValue, err := e.assetData.GetCollateralValueInUSD(1, collateralAsset, 1)
+	if err != nil {
+		return 0, 0, errors.Wrap(errors.InvalidDataErr, err, "Plan")
+	}
+	if debtValue <= 0 || collateralValue <= 0 {
+		return 0, 0, errors.Data("Plan: %s or %s has no value", debtAsset, collateralAsset)
+	}
+	// collateral seized per unit of debt repaid
+	rate := debtValue * (1 + e.liquidationBonus) / collateralValue
+
+	repaid := max(1, int64(math.Floor(float64(debt)*e.closeFactor)))
+	seized := int64(math.Floor(float64(repaid) * rate))
+	if seized > available {
+		seized = available
+		repaid = min(repaid, int64(math.Floor(float64(seized)/rate)))
+	}
+	return repaid, seized, nil
+}
+
+// largest returns the asset whose amount has the largest value, valued by valueOf, breaking ties by asset ID.
+// Empty if there are no assets.
+func (e *Engine) largest(
+	assetIDs []string,
+	amountOf func(assetID string) int64,
+	valueOf func(amt int64, assetID string, multiplier float64) (float64, error),
+) (string, error) {
+	sort.Strings(assetIDs)
+	largest, largestValue := "", 0.0
+	for _, assetID := range assetIDs {
+		value, err := valueOf(amountOf(assetID), assetID, 1)
+		if err != nil {
+			return "", errors.Wrap(errors.InvalidDataErr, err, "Plan")
+		}
+		if largest == "" || value > largestValue {
+			largest, largestValue = assetID, value
+		}
+	}
+	return largest, nil
+}
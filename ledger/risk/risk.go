@@ -0,0 +1,140 @@
+// Package risk values users' positions against their borrows, to decide whether they may borrow more and whether
+// they can be liquidated, and plans their liquidations.
+package risk
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/helpers"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+)
+
+// Health of a position: the values of its collateral, weighted for borrowing and for liquidation, against the
+// value of its borrows. Values are in USD.
+type Health struct {
+	BorrowLimit          float64 `json:"borrow_limit"`
+	LiquidationThreshold float64 `json:"liquidation_threshold"`
+	BorrowedValue        float64 `json:"borrowed_value"`
+	// HealthFactor is LiquidationThreshold / BorrowedValue. Positive infinity if the position borrows nothing.
+	HealthFactor float64 `json:"health_factor"`
+}
+
+// Liquidatable returns true if the position borrows more than its liquidation threshold.
+func (h *Health) Liquidatable() bool {
+	return h.BorrowedValue > 0 && h.HealthFactor < 1
+}
+
+// UserHealth is the health of a user's position.
+type UserHealth struct {
+	UserID string `json:"user_id"`
+	Health
+}
+
+// Engine computes the health of positions from asset prices and parameters, and plans liquidations of positions
+// which are liquidatable. Engine implements types.RiskChecker.
+type Engine struct {
+	assetData *helpers.AssetData
+	// closeFactor is the largest part of a debt which one liquidation repays.
+	closeFactor float64
+	// liquidationBonus is the part of the repaid value which liquidators seize in collateral on top of it.
+	liquidationBonus float64
+}
+
+var _ types.RiskChecker = (*Engine)(nil)
+
+// NewEngine returns a risk engine valuing positions with assetData. Liquidations repay at most closeFactor of a
+// debt, which must be in (0, 1], and reward liquidators with liquidationBonus more collateral than they repay,
+// which must not be negative.
+func NewEngine(assetData *helpers.AssetData, closeFactor, liquidationBonus float64) (*Engine, error) {
+	if assetData == nil {
+		return nil, errors.New(errors.InvalidInputError, "risk engine needs asset data")
+	}
+	if math.IsNaN(closeFactor) || closeFactor <= 0 || closeFactor > 1 {
+		return nil, errors.Newf(errors.InvalidInputError, "invalid close factor %v", closeFactor)
+	}
+	if math.IsNaN(liquidationBonus) || math.IsInf(liquidationBonus, 0) || liquidationBonus < 0 {
+		return nil, errors.Newf(errors.InvalidInputError, "invalid liquidation bonus %v", liquidationBonus)
+	}
+	return &Engine{
+		assetData:        assetData,
+		closeFactor:      closeFactor,
+		liquidationBonus: liquidationBonus,
+	}, nil
+}
+
+// Health returns the health of a position. Error if an asset it owns or owes is not registered or has no price.
+func (e *Engine) Health(p *types.Position) (*Health, error) {
+	borrowLimit, err := e.assetData.ExactBorrowLimit(p)
+	if err != nil {
+		return nil, errors.Wrap(errors.InvalidDataErr, err, "Health: user "+p.UserID)
+	}
+	threshold, err := e.assetData.ExactLiquidationThreshold(p)
+	if err != nil {
+		return nil, errors.Wrap(errors.InvalidDataErr, err, "Health: user "+p.UserID)
+	}
+	borrowed, err := e.assetData.ExactBorrowedValue(p)
+	if err != nil {
+		return nil, errors.Wrap(errors.InvalidDataErr, err, "Health: user "+p.UserID)
+	}
+	h := &Health{
+		BorrowLimit:          borrowLimit,
+		LiquidationThreshold: threshold,
+		BorrowedValue:        borrowed,
+		HealthFactor:         math.Inf(1),
+	}
+	if borrowed > 0 {
+		h.HealthFactor = threshold / borrowed
+	}
+	return h, nil
+}
+
+// CheckBorrow returns errors.ErrBorrowLimit if the position would borrow more than its borrow limit, were it to
+// owe an amount more of an asset. Error if the asset cannot be borrowed.
+func (e *Engine) CheckBorrow(p *types.Position, assetID string, amount int64) error {
+	if !e.assetData.CanBorrow(assetID) {
+		return errors.Newf(errors.InvalidInputError, "asset %s cannot be borrowed", assetID)
+	}
+	after := p.Copy()
+	after.Owned = after.Owned.AddAmount(assetID, -after.Owned.AmountOf(assetID)-p.Debt(assetID)-amount)
+	h, err := e.Health(after)
+	if err != nil {
+		return err
+	}
+	if h.BorrowedValue > h.BorrowLimit {
+		return errors.Wrap(
+			errors.InvalidInputError,
+			errors.ErrBorrowLimit,
+			fmt.Sprintf(
+				"user %s borrowing %d %s would borrow %v over a limit of %v",
+				p.UserID, amount, assetID, h.BorrowedValue, h.BorrowLimit,
+			),
+		)
+	}
+	return nil
+}
+
+// Liquidatable returns the health of the positions which are liquidatable, least healthy first.
+func (e *Engine) Liquidatable(positions []*types.Position) ([]UserHealth, error) {
+	result := make([]UserHealth, 0)
+	for _, p := range positions {
+		h, err := e.Health(p)
+		if err != nil {
+			return nil, err
+		}
+		if h.Liquidatable() {
+			result = append(result, UserHealth{UserID: p.UserID, Health: *h})
+		}
+	}
+	sort.Slice(
+		result, func(i, j int) bool {
+			if result[i].HealthFactor != result[j].HealthFactor {
+				return result[i].HealthFactor < result[j].HealthFactor
+			}
+			return result[i].UserID < result[j].UserID
+		},
+	)
+	return result, nil
+}
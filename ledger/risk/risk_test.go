@@ -0,0 +1,177 @@
+package risk_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/helpers"
+	"github.com/dora-network/dora-service-utils/ledger/risk"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func testAssetData(t *testing.T) *helpers.AssetData {
+	ad := new(helpers.AssetData)
+	require.NoError(t, ad.RegisterAsset(consts.StableID, 6, 0.8, 0.9, true, false, true, true, false, false, nil))
+	require.NoError(t, ad.RegisterAsset(consts.BondID, 6, 0.5, 0.8, false, true, true, false, false, false, nil))
+	require.NoError(t, ad.UpdatePrice(consts.StableID, 1))
+	require.NoError(t, ad.UpdatePrice(consts.BondID, 1))
+	return ad
+}
+
+func TestNewEngine(t *testing.T) {
+	ad := testAssetData(t)
+	for _, tt := range []struct {
+		closeFactor, bonus float64
+		valid              bool
+	}{
+		{0.5, 0.1, true},
+		{1, 0, true},
+		{0, 0.1, false},
+		{1.5, 0.1, false},
+		{math.NaN(), 0.1, false},
+		{0.5, -0.1, false},
+		{0.5, math.Inf(1), false},
+	} {
+		_, err := risk.NewEngine(ad, tt.closeFactor, tt.bonus)
+		require.Equal(t, tt.valid, err == nil, tt)
+	}
+	_, err := risk.NewEngine(nil, 0.5, 0.1)
+	require.Error(t, err)
+}
+
+func TestEngine(t *testing.T) {
+	require := require.New(t)
+	ad := testAssetData(t)
+	engine, err := risk.NewEngine(ad, 0.5, 0.1)
+	require.NoError(err)
+	now := time.Unix(1_700_000_000, 0)
+
+	one := types.InitialPosition(consts.UserIDOne)
+	one.Owned = types.NewBalances(consts.BondID, 1_000)
+	two := types.InitialPosition(consts.UserIDTwo)
+	two.Owned = types.NewBalances(consts.StableID, 11_000)
+	module := types.InitialModule()
+	_, err = two.Supply(module, consts.StableID, 10_000, now)
+	require.NoError(err)
+
+	// borrow up to the borrow limit of 1,000 bonds at a collateral weight of 0.5
+	require.ErrorIs(engine.CheckBorrow(one, consts.StableID, 501), errors.ErrBorrowLimit)
+	require.Error(engine.CheckBorrow(one, consts.BondID, 1))
+	_, err = one.Borrow(module, engine, consts.StableID, 501, now)
+	require.ErrorIs(err, errors.ErrBorrowLimit)
+	_, err = one.Borrow(module, engine, consts.StableID, 500, now)
+	require.NoError(err)
+	_, err = one.Borrow(module, engine, consts.StableID, 1, now)
+	require.ErrorIs(err, errors.ErrBorrowLimit)
+
+	health, err := engine.Health(one)
+	require.NoError(err)
+	require.InDelta(0.0005, health.BorrowLimit, 1e-12)
+	require.InDelta(0.0008, health.LiquidationThreshold, 1e-12)
+	require.InDelta(0.0005, health.BorrowedValue, 1e-12)
+	require.InDelta(1.6, health.HealthFactor, 1e-9)
+	require.False(health.Liquidatable())
+	health, err = engine.Health(two)
+	require.NoError(err)
+	require.True(math.IsInf(health.HealthFactor, 1))
+
+	_, err = engine.Plan(one, two, module, now)
+	require.ErrorIs(err, errors.ErrLiquidationIneligible)
+
+	// the bond's price halves, so one borrows more than its liquidation threshold
+	require.NoError(ad.UpdatePrice(consts.BondID, 0.5))
+	liquidatable, err := engine.Liquidatable([]*types.Position{two, one})
+	require.NoError(err)
+	require.Len(liquidatable, 1)
+	require.Equal(consts.UserIDOne, liquidatable[0].UserID)
+	require.InDelta(0.8, liquidatable[0].HealthFactor, 1e-9)
+
+	// half the debt is repaid, for collateral worth 10% more
+	oneBefore, twoBefore, moduleBefore := one.Copy(), two.Copy(), module.Copy()
+	plan, err := engine.Plan(one, two, module, now)
+	require.NoError(err)
+	require.Equal(types.NewBalance(consts.StableID, int64(250)), plan.Repaid)
+	require.Equal(types.NewBalance(consts.BondID, int64(550)), plan.Seized)
+	require.InDelta(0.72, plan.After.HealthFactor, 1e-9)
+	require.Equal(risk.LiquidationReason, plan.Entry.Reason)
+	require.Equal(now.Unix(), plan.Entry.Time)
+	require.Equal(oneBefore, one)
+	require.Equal(twoBefore, two)
+	require.Equal(moduleBefore, module)
+
+	liquidation, err := engine.Liquidate(one, two, module, now)
+	require.NoError(err)
+	require.Equal(plan, liquidation)
+	require.Equal(int64(250), one.Debt(consts.StableID))
+	require.Equal(int64(450), one.Owned.AmountOf(consts.BondID))
+	require.Equal(int64(550), two.Owned.AmountOf(consts.BondID))
+	require.Equal(int64(750), two.Owned.AmountOf(consts.StableID))
+	require.Equal(int64(250), module.Borrowed.AmountOf(consts.StableID))
+	require.Equal(now.Unix(), one.LastUpdated)
+	report := types.ReconcileModule(module, []*types.Position{one, two}, now)
+	require.True(report.OK(), report.Discrepancies)
+}
+
+func TestEngine_PlanLimits(t *testing.T) {
+	require := require.New(t)
+	ad := testAssetData(t)
+	engine, err := risk.NewEngine(ad, 1, 0.1)
+	require.NoError(err)
+	now := time.Unix(1_700_000_000, 0)
+
+	one := types.InitialPosition(consts.UserIDOne)
+	one.Owned = types.NewBalances(consts.BondID, 1_000).AddAmount(consts.StableID, -500)
+	one.Locked = types.NewBalances(consts.BondID, 700)
+	two := types.InitialPosition(consts.UserIDTwo)
+	two.Owned = types.NewBalances(consts.StableID, 100)
+	module := types.InitialModule()
+	module.Virtual = types.NewBalances(consts.StableID, 500)
+	require.NoError(ad.UpdatePrice(consts.BondID, 0.5))
+
+	// locked collateral is not seized, so less is repaid
+	_, err = engine.Plan(one, two, module, now)
+	require.ErrorIs(err, errors.ErrInsufficientBalance)
+	two.Owned = types.NewBalances(consts.StableID, 1_000)
+	liquidation, err := engine.Liquidate(one, two, module, now)
+	require.NoError(err)
+	require.Equal(types.NewBalance(consts.StableID, int64(136)), liquidation.Repaid)
+	require.Equal(types.NewBalance(consts.BondID, int64(300)), liquidation.Seized)
+	require.Equal(int64(364), module.Virtual.AmountOf(consts.StableID))
+
+	// nothing is left to seize
+	_, err = engine.Plan(one, two, module, now)
+	require.ErrorIs(err, errors.ErrLiquidationLenZero)
+	_, err = engine.Plan(one, one, module, now)
+	require.Error(err)
+}
+
+func TestEngine_PlanTWAP(t *testing.T) {
+	require := require.New(t)
+	ad := testAssetData(t)
+	engine, err := risk.NewEngine(ad, 0.5, 0.1)
+	require.NoError(err)
+	now := time.Unix(1_700_000_000, 0)
+
+	one := types.InitialPosition(consts.UserIDOne)
+	one.Owned = types.NewBalances(consts.BondID, 1_000).AddAmount(consts.StableID, -500)
+	two := types.InitialPosition(consts.UserIDTwo)
+	two.Owned = types.NewBalances(consts.StableID, 1_000)
+	module := types.InitialModule()
+	module.Virtual = types.NewBalances(consts.StableID, 500)
+
+	// the bond's spot price is 1, but collateral is valued at its TWAP price of 0.5
+	require.NoError(ad.UpdateTWAPPrice(consts.BondID, 0.5))
+	ad.UseTWAPPrices(true)
+
+	// seized collateral is valued at the price health is, so the liquidator is paid the bonus and no more
+	plan, err := engine.Plan(one, two, module, now)
+	require.NoError(err)
+	require.InDelta(0.8, plan.Before.HealthFactor, 1e-9)
+	require.Equal(types.NewBalance(consts.StableID, int64(250)), plan.Repaid)
+	require.Equal(types.NewBalance(consts.BondID, int64(550)), plan.Seized)
+}
@@ -11,53 +11,217 @@ import (
 const (
 	CouponPrefix   = "Coupon_"
 	SnapshotPrefix = "Snapshot_"
+
+	// idSeparator joins the two halves of pool share, market, coupon and snapshot IDs.
+	idSeparator = "-"
 )
 
+// baseAssetIDChars matches any character not allowed in a base asset ID.
+var baseAssetIDChars = regexp.MustCompile("[^A-Za-z0-9_]")
+
+// AssetKind classifies the IDs which share the asset ID namespace.
+type AssetKind string
+
+const (
+	// AssetKindBase is a plain asset, such as a bond or a currency. Example: "Bond_A".
+	AssetKindBase AssetKind = "base"
+	// AssetKindPoolShare is the LP share of a pool, named after its base and quote assets. Example: "Bond_A-USD".
+	AssetKindPoolShare AssetKind = "pool_share"
+	// AssetKindCoupon is not an asset, but a Position.InterestSources or Module.DollarCouponFundSources entry
+	// referring to an asset's coupon period ending at a unix time. Example: "Bond_A-Coupon_123".
+	AssetKindCoupon AssetKind = "coupon"
+	// AssetKindSnapshot is not an asset, but a Module.TotalSupplySnapshots entry referring to an asset's
+	// total supply at a unix time. Example: "Bond_A-Snapshot_123".
+	AssetKindSnapshot AssetKind = "snapshot"
+)
+
+// AssetID is a parsed asset ID. Use ParseAssetID or one of the constructors to create one.
+type AssetID struct {
+	Kind AssetKind
+	// Base is the asset itself for base assets, the base asset of a pool share,
+	// or the asset a coupon or snapshot entry refers to.
+	Base string
+	// Quote is the quote asset of a pool share. Empty for other kinds.
+	Quote string
+	// Period is the unix time of a coupon or snapshot entry. Zero for other kinds.
+	Period int64
+}
+
+// NewBaseAssetID creates the AssetID of a plain asset.
+func NewBaseAssetID(id string) AssetID {
+	return AssetID{Kind: AssetKindBase, Base: id}
+}
+
+// NewPoolShareID creates the AssetID of the LP share of the pool between base and quote.
+func NewPoolShareID(base, quote string) AssetID {
+	return AssetID{Kind: AssetKindPoolShare, Base: base, Quote: quote}
+}
+
+// NewCouponID creates the InterestSources entry of an asset's coupon period ending at period.
+func NewCouponID(asset string, period int64) AssetID {
+	return AssetID{Kind: AssetKindCoupon, Base: asset, Period: period}
+}
+
+// NewSnapshotID creates the TotalSupplySnapshots entry of an asset's total supply at period.
+func NewSnapshotID(asset string, period int64) AssetID {
+	return AssetID{Kind: AssetKindSnapshot, Base: asset, Period: period}
+}
+
+// ParseAssetID classifies an ID from the asset ID namespace. The ID must be non-empty, contain only
+// alphanumeric characters and underscores, as well as at most one hyphen somewhere in the middle.
+// IDs with a hyphen are pool shares, unless the second half is a coupon or snapshot period.
+func ParseAssetID(id string) (AssetID, error) {
+	first, second, found := strings.Cut(id, idSeparator)
+	if err := validBaseAssetID(first); err != nil {
+		return AssetID{}, errors.Data("invalid asset ID: %s", id)
+	}
+	if !found {
+		return NewBaseAssetID(first), nil
+	}
+	if period, ok := parsePeriod(second, CouponPrefix); ok {
+		return NewCouponID(first, period), nil
+	}
+	if period, ok := parsePeriod(second, SnapshotPrefix); ok {
+		return NewSnapshotID(first, period), nil
+	}
+	share := NewPoolShareID(first, second)
+	if err := share.Validate(); err != nil {
+		return AssetID{}, errors.Data("invalid asset ID: %s", id)
+	}
+	return share, nil
+}
+
+// Validate the parts of an AssetID.
+func (a AssetID) Validate() error {
+	if err := validBaseAssetID(a.Base); err != nil {
+		return err
+	}
+	switch a.Kind {
+	case AssetKindBase:
+		if a.Quote != "" || a.Period != 0 {
+			return errors.Data("invalid base asset ID: %s", a.Base)
+		}
+	case AssetKindPoolShare:
+		if err := validBaseAssetID(a.Quote); err != nil {
+			return err
+		}
+		if a.Base == a.Quote {
+			// No asset can be paired with itself
+			return errors.Data("invalid pool share ID: %s paired with itself", a.Base)
+		}
+	case AssetKindCoupon, AssetKindSnapshot:
+		if a.Quote != "" || a.Period < 0 {
+			return errors.Data("invalid %s ID for %s", a.Kind, a.Base)
+		}
+	default:
+		return errors.Data("invalid asset kind: %s", a.Kind)
+	}
+	return nil
+}
+
+// String returns the ID in the form it is stored in Balances. Round-trips with ParseAssetID.
+func (a AssetID) String() string {
+	switch a.Kind {
+	case AssetKindPoolShare:
+		return a.Base + idSeparator + a.Quote
+	case AssetKindCoupon:
+		return a.Base + idSeparator + CouponPrefix + strconv.FormatInt(a.Period, 10)
+	case AssetKindSnapshot:
+		return a.Base + idSeparator + SnapshotPrefix + strconv.FormatInt(a.Period, 10)
+	default:
+		return a.Base
+	}
+}
+
+// IsBase returns true for plain assets.
+func (a AssetID) IsBase() bool {
+	return a.Kind == AssetKindBase
+}
+
+// IsPoolShare returns true for pool shares.
+func (a AssetID) IsPoolShare() bool {
+	return a.Kind == AssetKindPoolShare
+}
+
+// MarketID of a pool share. Error for other kinds.
+func (a AssetID) MarketID() (MarketID, error) {
+	if !a.IsPoolShare() {
+		return MarketID{}, errors.Data("%s is not a pool share", a.String())
+	}
+	return NewMarketID(a.Base, a.Quote), nil
+}
+
+// MarketID identifies a pair of base assets, such as an order book or the pool trading them.
+type MarketID struct {
+	Base  string
+	Quote string
+}
+
+// NewMarketID creates the MarketID of base traded against quote.
+func NewMarketID(base, quote string) MarketID {
+	return MarketID{Base: base, Quote: quote}
+}
+
+// ParseMarketID parses a <base>-<quote> ID where both halves are distinct base assets.
+func ParseMarketID(id string) (MarketID, error) {
+	a, err := ParseAssetID(id)
+	if err != nil {
+		return MarketID{}, err
+	}
+	return a.MarketID()
+}
+
+// Validate that both assets are distinct base assets.
+func (m MarketID) Validate() error {
+	return NewPoolShareID(m.Base, m.Quote).Validate()
+}
+
+// String returns the market's ID. Round-trips with ParseMarketID.
+func (m MarketID) String() string {
+	return m.Base + idSeparator + m.Quote
+}
+
+// PoolShareID returns the AssetID of the LP share of the pool trading this market.
+func (m MarketID) PoolShareID() AssetID {
+	return NewPoolShareID(m.Base, m.Quote)
+}
+
 // ValidAssetID checks that an asset ID contains only alphanumeric characters and underscores,
 // as well as at most one hyphen somewhere in the middle, and is non-empty.
 func ValidAssetID(id string) error {
+	_, err := ParseAssetID(id)
+	return err
+}
+
+// validBaseAssetID checks a single asset ID without a hyphen.
+func validBaseAssetID(id string) error {
+	if id == "" || baseAssetIDChars.MatchString(id) {
+		return errors.Data("invalid asset ID: %s", id)
+	}
 	if strings.HasPrefix(id, CouponPrefix) || strings.HasPrefix(id, SnapshotPrefix) {
 		// InterestSources entries do not start with coupon asset, they end with it.
 		// Individual asset IDs must not start with this prefix either, to prevent confusion.
 		// Same applies to total supply snapshots.
 		return errors.Data("invalid asset ID: %s", id)
 	}
-	re := regexp.MustCompile("[^A-Za-z0-9_-]")
-	trimmed := re.ReplaceAllLiteralString(id, "")
-	if id == "" ||
-		id != trimmed || // this checks whether the regexp removed any characters outside the accepted set
-		strings.HasPrefix(id, "-") ||
-		strings.HasSuffix(id, "-") ||
-		strings.Count(id, "-") > 1 {
-		return errors.Data("invalid asset ID: %s", id)
+	return nil
+}
+
+// parsePeriod parses <prefix><int64>. ok is false if s does not start with prefix or the period is invalid.
+func parsePeriod(s, prefix string) (period int64, ok bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return 0, false
 	}
-	split := strings.Split(id, "-")
-	if len(split) == 2 {
-		// ID contained a hyphen. It is either a pool share or an InterestSources entry.
-		s := split[1]
-		if strings.HasPrefix(s, CouponPrefix) {
-			// InterestSources entry rules
-			period := strings.TrimPrefix(s, CouponPrefix)
-			// Period must be a valid int64 (we don't care what it is, just that it is valid)
-			if _, err := strconv.ParseInt(period, 10, 64); err != nil {
-				return errors.Data("invalid asset ID: %s", id)
-			}
-		} else if strings.HasPrefix(s, SnapshotPrefix) {
-			// TotalSupplySnapshot entry rules
-			period := strings.TrimPrefix(s, SnapshotPrefix)
-			// Period must be a valid int64 (we don't care what it is, just that it is valid)
-			if _, err := strconv.ParseInt(period, 10, 64); err != nil {
-				return errors.Data("invalid asset ID: %s", id)
-			}
-		} else {
-			// Pool share rules
-			if split[0] == split[1] {
-				// No asset can be paired with itself
-				return errors.Data("invalid asset ID: %s", id)
-			}
-		}
+	// Period must be a valid int64 (we don't care what it is, just that it is valid)
+	digits := strings.TrimPrefix(s, prefix)
+	if strings.Trim(digits, "0123456789") != "" {
+		return 0, false // rejects signs, which are not allowed in asset IDs
 	}
-	return nil
+	period, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return period, true
 }
 
 // InterpretSpecialPrefix converts any balances in b which take the form
@@ -65,15 +229,18 @@ func ValidAssetID(id string) error {
 // Ignores balances that do not match the pattern.
 // For example, "Asset_A-Coupon_123":456 will map 123->456
 func (b *Balances) InterpretSpecialPrefix(asset, prefix string) map[int64]int64 {
-	fullPrefix := asset + "-" + prefix
+	var kind AssetKind
+	switch prefix {
+	case CouponPrefix:
+		kind = AssetKindCoupon
+	case SnapshotPrefix:
+		kind = AssetKindSnapshot
+	}
 	result := map[int64]int64{}
 	for id, amt := range b.Bals {
-		if strings.HasPrefix(id, fullPrefix) {
-			s := strings.TrimPrefix(id, fullPrefix)
-			n, err := strconv.ParseInt(s, 10, 64)
-			if err == nil {
-				result[n] = amt
-			}
+		parsed, err := ParseAssetID(id)
+		if err == nil && parsed.Kind == kind && parsed.Base == asset {
+			result[parsed.Period] = amt
 		}
 	}
 	return result
@@ -51,3 +51,37 @@ func TestAssetID(t *testing.T) {
 	require.Equal(int64(4), m[4])
 	require.Equal(int64(-1), m[5])
 }
+
+func TestParseAssetID(t *testing.T) {
+	require := require.New(t)
+
+	cases := map[string]AssetID{
+		"Bond_A":              NewBaseAssetID("Bond_A"),
+		"Bond_A-USD":          NewPoolShareID("Bond_A", "USD"),
+		"Bond_A-Coupon_123":   NewCouponID("Bond_A", 123),
+		"Bond_A-Snapshot_123": NewSnapshotID("Bond_A", 123),
+	}
+	for id, expected := range cases {
+		parsed, err := ParseAssetID(id)
+		require.NoError(err, id)
+		require.Equal(expected, parsed, id)
+		require.Equal(id, parsed.String(), id)
+		require.NoError(parsed.Validate(), id)
+	}
+
+	for _, id := range []string{"Bond_A-Coupon_-1", "Bond_A-Coupon_+1", "Bond_A-Coupon_abc", "Bond_A-Snapshot_"} {
+		_, err := ParseAssetID(id)
+		require.Error(err, id)
+	}
+
+	market, err := ParseMarketID("Bond_A-USD")
+	require.NoError(err)
+	require.Equal(NewMarketID("Bond_A", "USD"), market)
+	require.Equal(NewPoolShareID("Bond_A", "USD"), market.PoolShareID())
+	require.Equal("Bond_A-USD", market.String())
+
+	for _, id := range []string{"Bond_A", "Bond_A-Coupon_123", "Bond_A-Snapshot_123", "A-A"} {
+		_, err := ParseMarketID(id)
+		require.Error(err, id)
+	}
+}
@@ -0,0 +1,147 @@
+package types
+
+import (
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// IndexScale is the fixed-point scale of interest indices: an index of IndexScale is 1.
+var IndexScale = new(big.Int).Exp(big.NewInt(10), big.NewInt(27), nil)
+
+// Indices are fixed-point interest indices by asset ID, scaled by IndexScale. Indices start at 1 and grow by the
+// interest compounded on each unit of an asset since.
+type Indices map[string]*big.Int
+
+// Of returns a copy of an asset's index. IndexScale if it has none.
+func (ix Indices) Of(assetID string) *big.Int {
+	if i, ok := ix[assetID]; ok && i != nil {
+		return new(big.Int).Set(i)
+	}
+	return new(big.Int).Set(IndexScale)
+}
+
+// Copy creates a safe copy of the indices.
+func (ix Indices) Copy() Indices {
+	result := make(Indices, len(ix))
+	for assetID := range ix {
+		result[assetID] = ix.Of(assetID)
+	}
+	return result
+}
+
+// IndexedBalance is a balance which accrues interest through an index: its principal, on which interest accrues,
+// and its principal plus interest divided by the index, which the index multiplies back up as it grows. Its
+// interest is exact, however often the index is updated.
+type IndexedBalance struct {
+	// Principal is the balance, excluding interest, when it last changed.
+	Principal int64 `json:"principal"`
+	// Scaled is the principal plus interest, divided by the index, and scaled by IndexScale squared.
+	Scaled *big.Int `json:"scaled"`
+}
+
+// Value returns the principal plus interest at an index, scaled by IndexScale.
+func (b *IndexedBalance) Value(index *big.Int) *big.Int {
+	if b == nil || b.Scaled == nil {
+		return new(big.Int)
+	}
+	v := new(big.Int).Mul(b.Scaled, index)
+	return v.Quo(v, IndexScale)
+}
+
+// Interest returns the interest accrued on the principal at an index, rounded down.
+func (b *IndexedBalance) Interest(index *big.Int) int64 {
+	if b == nil {
+		return 0
+	}
+	v := b.Value(index)
+	v.Quo(v, IndexScale).Sub(v, big.NewInt(b.Principal))
+	if v.Sign() <= 0 {
+		return 0
+	}
+	if !v.IsInt64() {
+		return math.MaxInt64
+	}
+	return v.Int64()
+}
+
+// Rebase the balance onto a new principal at an index, keeping its interest.
+func (b *IndexedBalance) Rebase(principal int64, index *big.Int) {
+	if b.Scaled == nil {
+		b.Scaled = new(big.Int)
+	}
+	change := new(big.Int).Mul(big.NewInt(principal-b.Principal), IndexScale)
+	change.Mul(change, IndexScale).Quo(change, index)
+	b.Scaled.Add(b.Scaled, change)
+	if b.Scaled.Sign() < 0 {
+		b.Scaled.SetInt64(0)
+	}
+	b.Principal = principal
+}
+
+// IsZero returns true if the balance has neither principal nor interest.
+func (b *IndexedBalance) IsZero() bool {
+	return b == nil || (b.Principal == 0 && (b.Scaled == nil || b.Scaled.Sign() == 0))
+}
+
+// AssetInterest is the interest accrued by a user, or the module in total, per asset in each asset's own units,
+// unlike Interest which values it in USD.
+type AssetInterest struct {
+	// Owed is the interest accrued on borrows, in the borrowed assets.
+	Owed *Balances `json:"owed" redis:"owed"`
+	// Earned is the interest earned on supply, in the supplied assets.
+	Earned *Balances `json:"earned" redis:"earned"`
+	// Reserves is the module's part of borrowers' interest, which suppliers do not earn. Empty for users.
+	Reserves *Balances `json:"reserves" redis:"reserves"`
+	// BorrowIndex and SupplyIndex of the module compound each asset's borrow and supply interest. Empty for users.
+	BorrowIndex Indices `json:"borrow_index" redis:"borrow_index"`
+	SupplyIndex Indices `json:"supply_index" redis:"supply_index"`
+	// Borrows and Supplies are the balances which interest accrues on, by asset.
+	Borrows     map[string]*IndexedBalance `json:"borrows" redis:"borrows"`
+	Supplies    map[string]*IndexedBalance `json:"supplies" redis:"supplies"`
+	LastUpdated time.Time                  `json:"last_updated" redis:"last_updated"`
+}
+
+// InitialAssetInterest returns asset interest with nothing accrued, last updated at a time.
+func InitialAssetInterest(lastUpdated time.Time) *AssetInterest {
+	i := &AssetInterest{LastUpdated: lastUpdated}
+	i.Init()
+	return i
+}
+
+// Init sets nil balances and indices to empty ones.
+func (i *AssetInterest) Init() {
+	if i.Owed == nil {
+		i.Owed = EmptyBalances()
+	}
+	if i.Earned == nil {
+		i.Earned = EmptyBalances()
+	}
+	if i.Reserves == nil {
+		i.Reserves = EmptyBalances()
+	}
+	if i.BorrowIndex == nil {
+		i.BorrowIndex = Indices{}
+	}
+	if i.SupplyIndex == nil {
+		i.SupplyIndex = Indices{}
+	}
+	if i.Borrows == nil {
+		i.Borrows = map[string]*IndexedBalance{}
+	}
+	if i.Supplies == nil {
+		i.Supplies = map[string]*IndexedBalance{}
+	}
+}
+
+func (i *AssetInterest) MarshalBinary() ([]byte, error) {
+	return json.Marshal(i)
+}
+
+func (i *AssetInterest) UnmarshalBinary(data []byte) error {
+	err := json.Unmarshal(data, i)
+	i.Init()
+	return err
+}
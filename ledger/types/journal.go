@@ -0,0 +1,302 @@
+package types
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/goccy/go-json"
+
+	"github.com/dora-network/dora-service-utils/errors"
+)
+
+var errNoModule = errors.New(errors.InvalidInputError, "no module for module postings")
+
+// Account identifies the balance a journal posting moves assets in or out of.
+type Account string
+
+const (
+	// AccountOwned is a user's Position.Owned.
+	AccountOwned Account = "owned"
+	// AccountLocked is a user's Position.Locked. Locked assets are a subset of Owned, so locking posts to
+	// AccountLocked against AccountAvailable, leaving Owned unchanged.
+	AccountLocked Account = "locked"
+	// AccountAvailable is the part of a user's Owned balance which is not Locked. It is not stored.
+	AccountAvailable Account = "available"
+	// AccountSupplied is a user's Position.Supplied.
+	AccountSupplied Account = "supplied"
+	// AccountInactive is a user's Position.Inactive.
+	AccountInactive Account = "inactive"
+
+	// AccountModuleBalance is Module.Balance.
+	AccountModuleBalance Account = "module_balance"
+	// AccountModuleSupplied is Module.Supplied, which the module owes to suppliers. Credits increase it.
+	AccountModuleSupplied Account = "module_supplied"
+	// AccountModuleVirtual is Module.Virtual, which users owe for assets minted by virtual-borrowing. Minted assets
+	// come from outside the ledger, so virtual-borrowing posts to AccountModuleVirtual against AccountExternal.
+	AccountModuleVirtual Account = "module_virtual"
+	// AccountModuleBorrowed is Module.Borrowed.
+	AccountModuleBorrowed Account = "module_borrowed"
+	// AccountModuleCouponFunds is Module.CouponFunds.
+	AccountModuleCouponFunds Account = "module_coupon_funds"
+
+	// AccountExternal is outside the ledger, where deposits come from and withdrawals go. It is not stored.
+	AccountExternal Account = "external"
+)
+
+// IsUserAccount returns true if the account belongs to a user, rather than to the module or outside the ledger.
+func (a Account) IsUserAccount() bool {
+	switch a {
+	case AccountOwned, AccountLocked, AccountAvailable, AccountSupplied, AccountInactive:
+		return true
+	default:
+		return false
+	}
+}
+
+// Valid returns true if the account is one of the journal's accounts.
+func (a Account) Valid() bool {
+	switch a {
+	case AccountOwned, AccountLocked, AccountAvailable, AccountSupplied, AccountInactive,
+		AccountModuleBalance, AccountModuleSupplied, AccountModuleVirtual, AccountModuleBorrowed,
+		AccountModuleCouponFunds, AccountExternal:
+		return true
+	default:
+		return false
+	}
+}
+
+// Posting moves an amount of an asset in or out of one account. Amount is a debit when positive and a credit when
+// negative. Debits increase every stored balance except AccountModuleSupplied, which the module owes to suppliers,
+// so that every change to the ledger nets to zero.
+type Posting struct {
+	// UserID owns the account. Empty for the module's accounts and AccountExternal.
+	UserID  string  `json:"user_id,omitempty"`
+	Account Account `json:"account"`
+	AssetID string  `json:"asset_id"`
+	Amount  int64   `json:"amount"`
+}
+
+// Validate that the posting is to a valid account and asset, and moves a non-zero amount.
+func (p Posting) Validate() error {
+	if !p.Account.Valid() {
+		return errors.Data("posting to unknown account %q", p.Account)
+	}
+	if p.Account.IsUserAccount() && p.UserID == "" {
+		return errors.Data("posting to %s without a user ID", p.Account)
+	}
+	if !p.Account.IsUserAccount() && p.UserID != "" {
+		return errors.Data("posting to %s with user ID %s", p.Account, p.UserID)
+	}
+	if err := ValidAssetID(p.AssetID); err != nil {
+		return err
+	}
+	if p.Amount == 0 {
+		return errors.Data("zero posting to %s %s", p.Account, p.AssetID)
+	}
+	return nil
+}
+
+// JournalEntry is one change to the ledger: a set of postings which net to zero for every asset. Entries are
+// applied to positions and the module atomically, see JournalEntry.Apply, and appended to the journal, so that
+// every balance can be explained, and rebuilt, from the entries which made it.
+type JournalEntry struct {
+	// ID of the entry in the journal. Empty until the entry is appended.
+	ID string `json:"id,omitempty"`
+	// Reason the entry was made, such as "deposit" or "order_fill".
+	Reason string `json:"reason"`
+	// Unix time of the entry. Positions and the module it modifies are last updated at this time.
+	Time     int64     `json:"time"`
+	Postings []Posting `json:"postings"`
+}
+
+// NewJournalEntry returns a journal entry of the postings. Error if the entry is invalid, see JournalEntry.Validate.
+func NewJournalEntry(reason string, time int64, postings ...Posting) (*JournalEntry, error) {
+	e := &JournalEntry{
+		Reason:   reason,
+		Time:     time,
+		Postings: postings,
+	}
+	return e, e.Validate()
+}
+
+func (e *JournalEntry) MarshalBinary() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (e *JournalEntry) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, e)
+}
+
+// Validate that the entry has a reason and valid postings, which net to zero for every asset.
+// Error ErrUnbalancedJournalEntry if they do not.
+func (e *JournalEntry) Validate() error {
+	if e.Reason == "" {
+		return errors.Data("empty reason in JournalEntry")
+	}
+	if len(e.Postings) == 0 {
+		return errors.Data("no postings in JournalEntry")
+	}
+	// sums can overflow int64 before they net to zero
+	sums := make(map[string]*big.Int)
+	for _, posting := range e.Postings {
+		if err := posting.Validate(); err != nil {
+			return err
+		}
+		if sums[posting.AssetID] == nil {
+			sums[posting.AssetID] = new(big.Int)
+		}
+		sums[posting.AssetID].Add(sums[posting.AssetID], big.NewInt(posting.Amount))
+	}
+	for assetID, sum := range sums {
+		if sum.Sign() != 0 {
+			return errors.Wrap(
+				errors.InvalidInputError,
+				errors.ErrUnbalancedJournalEntry,
+				"postings of "+assetID+" net to "+sum.String(),
+			)
+		}
+	}
+	return nil
+}
+
+// UserIDs returns the IDs of the users whose accounts the entry posts to, sorted.
+func (e *JournalEntry) UserIDs() []string {
+	seen := make(map[string]bool)
+	userIDs := make([]string, 0)
+	for _, posting := range e.Postings {
+		if posting.UserID != "" && !seen[posting.UserID] {
+			seen[posting.UserID] = true
+			userIDs = append(userIDs, posting.UserID)
+		}
+	}
+	sort.Strings(userIDs)
+	return userIDs
+}
+
+// PostsToModule returns true if the entry posts to any of the module's accounts.
+func (e *JournalEntry) PostsToModule() bool {
+	for _, posting := range e.Postings {
+		if posting.Account != AccountExternal && !posting.Account.IsUserAccount() {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply the entry's postings to the positions of the users it posts to, and to the module, atomically: if the
+// entry is invalid, or any position or the module would be invalid afterwards, for example with more Locked than
+// Owned, nothing is modified. Positions must contain the position of every user the entry posts to, and module
+// may be nil if the entry does not post to it. Modified positions and module are last updated at the entry's
+// time, and their sequences updated.
+func (e *JournalEntry) Apply(positions map[string]*Position, module *Module) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	// apply to copies, so a failure leaves the originals untouched
+	updated := make(map[string]*Position)
+	var updatedModule *Module
+	for _, posting := range e.Postings {
+		switch {
+		case posting.UserID != "" && updated[posting.UserID] == nil:
+			position, ok := positions[posting.UserID]
+			if !ok || position == nil {
+				return errors.Newf(errors.InvalidInputError, "no position for user %s", posting.UserID)
+			}
+			updated[posting.UserID] = position.Copy()
+		case posting.UserID == "" && posting.Account != AccountExternal && updatedModule == nil:
+			if module == nil {
+				return errNoModule
+			}
+			updatedModule = module.Copy()
+		}
+	}
+
+	for _, posting := range e.Postings {
+		posting.apply(updated[posting.UserID], updatedModule)
+	}
+
+	for userID, position := range updated {
+		if err := position.Validate(); err != nil {
+			return errors.Wrap(errors.InvalidInputError, err, "user "+userID)
+		}
+		for assetID, locked := range position.Locked.Bals {
+			if locked > position.Owned.AmountOf(assetID) {
+				return errors.Wrap(
+					errors.InvalidInputError,
+					errors.ErrInsufficientBalance,
+					"user "+userID+" locks more "+assetID+" than it owns",
+				)
+			}
+		}
+	}
+	if updatedModule != nil {
+		if err := updatedModule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for userID, position := range updated {
+		if position.IsModified() {
+			position.LastUpdated = e.Time
+			position.UpdateSequence()
+		}
+		*positions[userID] = *position
+	}
+	if updatedModule != nil {
+		if updatedModule.IsModified() {
+			updatedModule.LastUpdated = e.Time
+			updatedModule.UpdateSequence()
+		}
+		*module = *updatedModule
+	}
+	return nil
+}
+
+// ReplayJournal applies entries to positions and the module in order, to rebuild them from the journal. Users
+// without a position start from their initial position, which is added to positions. Stops at the first entry
+// which does not apply.
+func ReplayJournal(entries []*JournalEntry, positions map[string]*Position, module *Module) error {
+	for _, entry := range entries {
+		for _, userID := range entry.UserIDs() {
+			if positions[userID] == nil {
+				positions[userID] = InitialPosition(userID)
+			}
+		}
+		if err := entry.Apply(positions, module); err != nil {
+			return errors.Wrap(errors.InvalidInputError, err, "journal entry "+entry.ID)
+		}
+		// each entry was persisted on its own, so the next one updates sequences again
+		for _, userID := range entry.UserIDs() {
+			positions[userID] = positions[userID].Snapshot()
+		}
+		if module != nil && entry.PostsToModule() {
+			*module = *module.Snapshot()
+		}
+	}
+	return nil
+}
+
+// apply the posting to its account's balance. Postings to accounts which are not stored have no effect.
+func (p Posting) apply(position *Position, module *Module) {
+	switch p.Account {
+	case AccountOwned:
+		position.Owned = position.Owned.AddAmount(p.AssetID, p.Amount)
+	case AccountLocked:
+		position.Locked = position.Locked.AddAmount(p.AssetID, p.Amount)
+	case AccountSupplied:
+		position.Supplied = position.Supplied.AddAmount(p.AssetID, p.Amount)
+	case AccountInactive:
+		position.Inactive = position.Inactive.AddAmount(p.AssetID, p.Amount)
+	case AccountModuleBalance:
+		module.Balance = module.Balance.AddAmount(p.AssetID, p.Amount)
+	case AccountModuleSupplied:
+		module.Supplied = module.Supplied.SubAmount(p.AssetID, p.Amount)
+	case AccountModuleVirtual:
+		module.Virtual = module.Virtual.AddAmount(p.AssetID, p.Amount)
+	case AccountModuleBorrowed:
+		module.Borrowed = module.Borrowed.AddAmount(p.AssetID, p.Amount)
+	case AccountModuleCouponFunds:
+		module.CouponFunds = module.CouponFunds.AddAmount(p.AssetID, p.Amount)
+	}
+}
@@ -0,0 +1,209 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func TestJournalEntry_Validate(t *testing.T) {
+	deposit := func(amount int64) []types.Posting {
+		return []types.Posting{
+			{Account: types.AccountExternal, AssetID: consts.StableID, Amount: -amount},
+			{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.StableID, Amount: amount},
+		}
+	}
+
+	_, err := types.NewJournalEntry("deposit", 1, deposit(100)...)
+	require.NoError(t, err)
+
+	for name, postings := range map[string][]types.Posting{
+		"no postings": nil,
+		"unbalanced": append(
+			deposit(100),
+			types.Posting{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.StableID, Amount: 1},
+		),
+		"balanced across assets only": {
+			{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.StableID, Amount: -100},
+			{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.BondID, Amount: 100},
+		},
+		"unknown account": {
+			{UserID: consts.UserIDOne, Account: "other", AssetID: consts.StableID, Amount: -100},
+			{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.StableID, Amount: 100},
+		},
+		"user account without user": {
+			{Account: types.AccountExternal, AssetID: consts.StableID, Amount: -100},
+			{Account: types.AccountOwned, AssetID: consts.StableID, Amount: 100},
+		},
+		"module account with user": {
+			{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.StableID, Amount: -100},
+			{UserID: consts.UserIDOne, Account: types.AccountModuleBalance, AssetID: consts.StableID, Amount: 100},
+		},
+		"zero posting": append(
+			deposit(100),
+			types.Posting{Account: types.AccountExternal, AssetID: consts.StableID},
+		),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := types.NewJournalEntry("test", 1, postings...)
+			require.Error(t, err)
+		})
+	}
+
+	_, err = types.NewJournalEntry("", 1, deposit(100)...)
+	require.Error(t, err)
+	_, err = types.NewJournalEntry("deposit", 1, deposit(100)[:1]...)
+	require.ErrorIs(t, err, errors.ErrUnbalancedJournalEntry)
+}
+
+func TestJournalEntry_Apply(t *testing.T) {
+	require := require.New(t)
+
+	positions := map[string]*types.Position{
+		consts.UserIDOne: types.InitialPosition(consts.UserIDOne),
+		consts.UserIDTwo: types.InitialPosition(consts.UserIDTwo),
+	}
+	module := types.InitialModule()
+	apply := func(reason string, postings ...types.Posting) error {
+		entry, err := types.NewJournalEntry(reason, 100, postings...)
+		require.NoError(err)
+		return entry.Apply(positions, module)
+	}
+
+	// deposit, then supply to the module
+	require.NoError(apply(
+		"deposit",
+		types.Posting{Account: types.AccountExternal, AssetID: consts.StableID, Amount: -1_000},
+		types.Posting{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.StableID, Amount: 1_000},
+	))
+	require.NoError(apply(
+		"supply",
+		types.Posting{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.StableID, Amount: -400},
+		types.Posting{UserID: consts.UserIDOne, Account: types.AccountSupplied, AssetID: consts.StableID, Amount: 400},
+		types.Posting{Account: types.AccountModuleBalance, AssetID: consts.StableID, Amount: 400},
+		types.Posting{Account: types.AccountModuleSupplied, AssetID: consts.StableID, Amount: -400},
+	))
+	// lock for an order, leaving Owned unchanged
+	require.NoError(apply(
+		"lock",
+		types.Posting{UserID: consts.UserIDOne, Account: types.AccountAvailable, AssetID: consts.StableID, Amount: -500},
+		types.Posting{UserID: consts.UserIDOne, Account: types.AccountLocked, AssetID: consts.StableID, Amount: 500},
+	))
+
+	one := positions[consts.UserIDOne]
+	require.Equal(int64(600), one.Owned.AmountOf(consts.StableID))
+	require.Equal(int64(500), one.Locked.AmountOf(consts.StableID))
+	require.Equal(int64(400), one.Supplied.AmountOf(consts.StableID))
+	require.Equal(uint64(1), one.Sequence)
+	require.Equal(int64(100), one.LastUpdated)
+	require.Equal(int64(400), module.Balance.AmountOf(consts.StableID))
+	require.Equal(int64(400), module.Supplied.AmountOf(consts.StableID))
+	require.Equal(uint64(1), module.Sequence)
+	// user two was not posted to
+	require.Equal(types.InitialPosition(consts.UserIDTwo), positions[consts.UserIDTwo])
+
+	// nothing is modified if any position would be invalid
+	before := one.Copy()
+	moduleBefore := module.Copy()
+	err := apply(
+		"transfer",
+		types.Posting{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.StableID, Amount: -200},
+		types.Posting{UserID: consts.UserIDTwo, Account: types.AccountOwned, AssetID: consts.StableID, Amount: 200},
+	)
+	require.ErrorIs(err, errors.ErrInsufficientBalance)
+	err = apply(
+		"withdraw supply",
+		types.Posting{UserID: consts.UserIDOne, Account: types.AccountSupplied, AssetID: consts.StableID, Amount: -500},
+		types.Posting{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.StableID, Amount: 500},
+		types.Posting{Account: types.AccountModuleBalance, AssetID: consts.StableID, Amount: -500},
+		types.Posting{Account: types.AccountModuleSupplied, AssetID: consts.StableID, Amount: 500},
+	)
+	require.Error(err)
+	require.Equal(before, one)
+	require.Equal(moduleBefore, module)
+	require.Equal(types.InitialPosition(consts.UserIDTwo), positions[consts.UserIDTwo])
+
+	entry, err := types.NewJournalEntry(
+		"deposit", 100,
+		types.Posting{Account: types.AccountExternal, AssetID: consts.StableID, Amount: -1},
+		types.Posting{UserID: "user3", Account: types.AccountOwned, AssetID: consts.StableID, Amount: 1},
+	)
+	require.NoError(err)
+	require.Error(entry.Apply(positions, module))
+}
+
+func TestJournalEntry_ApplyVirtual(t *testing.T) {
+	require := require.New(t)
+
+	positions := map[string]*types.Position{consts.UserIDOne: types.InitialPosition(consts.UserIDOne)}
+	module := types.InitialModule()
+	apply := func(reason string, postings ...types.Posting) error {
+		entry, err := types.NewJournalEntry(reason, 100, postings...)
+		require.NoError(err)
+		return entry.Apply(positions, module)
+	}
+
+	// virtual-borrow and withdraw bonds minted from outside the ledger
+	require.NoError(apply(
+		"borrow",
+		types.Posting{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.BondID, Amount: -300},
+		types.Posting{Account: types.AccountExternal, AssetID: consts.BondID, Amount: 300},
+		types.Posting{Account: types.AccountModuleVirtual, AssetID: consts.BondID, Amount: 300},
+		types.Posting{Account: types.AccountExternal, AssetID: consts.BondID, Amount: -300},
+	))
+	one := positions[consts.UserIDOne]
+	require.Equal(int64(-300), one.Owned.AmountOf(consts.BondID))
+	require.Equal(int64(300), module.Virtual.AmountOf(consts.BondID))
+
+	// repaying burns what was minted
+	require.NoError(apply(
+		"repay",
+		types.Posting{Account: types.AccountExternal, AssetID: consts.BondID, Amount: -100},
+		types.Posting{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.BondID, Amount: 100},
+		types.Posting{Account: types.AccountModuleVirtual, AssetID: consts.BondID, Amount: -100},
+		types.Posting{Account: types.AccountExternal, AssetID: consts.BondID, Amount: 100},
+	))
+	require.Equal(int64(-200), one.Owned.AmountOf(consts.BondID))
+	require.Equal(int64(200), module.Virtual.AmountOf(consts.BondID))
+
+	// more than was minted cannot be repaid
+	require.Error(apply(
+		"repay",
+		types.Posting{Account: types.AccountModuleVirtual, AssetID: consts.BondID, Amount: -300},
+		types.Posting{Account: types.AccountExternal, AssetID: consts.BondID, Amount: 300},
+	))
+	require.Equal(int64(200), module.Virtual.AmountOf(consts.BondID))
+}
+
+func TestReplayJournal(t *testing.T) {
+	require := require.New(t)
+
+	var entries []*types.JournalEntry
+	for _, userID := range []string{consts.UserIDOne, consts.UserIDTwo} {
+		entry, err := types.NewJournalEntry(
+			"deposit", 100,
+			types.Posting{Account: types.AccountExternal, AssetID: consts.BondID, Amount: -10},
+			types.Posting{UserID: userID, Account: types.AccountOwned, AssetID: consts.BondID, Amount: 10},
+		)
+		require.NoError(err)
+		entries = append(entries, entry)
+	}
+	entry, err := types.NewJournalEntry(
+		"transfer", 200,
+		types.Posting{UserID: consts.UserIDOne, Account: types.AccountOwned, AssetID: consts.BondID, Amount: -3},
+		types.Posting{UserID: consts.UserIDTwo, Account: types.AccountOwned, AssetID: consts.BondID, Amount: 3},
+	)
+	require.NoError(err)
+	entries = append(entries, entry)
+
+	positions := map[string]*types.Position{}
+	require.NoError(types.ReplayJournal(entries, positions, nil))
+	require.Equal(int64(7), positions[consts.UserIDOne].Owned.AmountOf(consts.BondID))
+	require.Equal(int64(13), positions[consts.UserIDTwo].Owned.AmountOf(consts.BondID))
+	require.Equal(int64(200), positions[consts.UserIDTwo].LastUpdated)
+	require.Equal(uint64(2), positions[consts.UserIDOne].Sequence)
+}
@@ -40,6 +40,9 @@ type Module struct {
 	// Also note that a negative value (-1) indicates that supply has not yet been tracked for a coupon period.
 	// -1 Is used for in-progress periods, and also periods where supply was actually zero, unknown, or invalid.
 	TotalSupplySnapshots *Balances `json:"total_supply_snapshots" redis:"total_supply_snapshots"`
+	// Tracks the coupon periods whose coupons have been paid, by the same keys as DollarCouponFundSources, with
+	// the unix time each was paid at. A coupon is paid once, see coupons.Processor.
+	PaidCoupons *Balances `json:"paid_coupons" redis:"paid_coupons"`
 
 	// Tracking fields - see position.go
 	LastUpdated      int64  `json:"last_updated" redis:"last_updated"`
@@ -83,6 +86,9 @@ func (m *Module) Init() {
 	if m.TotalSupplySnapshots == nil {
 		m.TotalSupplySnapshots = EmptyBalances()
 	}
+	if m.PaidCoupons == nil {
+		m.PaidCoupons = EmptyBalances()
+	}
 	// Store original state. No-op if already stored.
 	if m.original == "" {
 		j, err := json.Marshal(m)
@@ -167,6 +173,9 @@ func (m *Module) Validate() error {
 			return errors.Data("module Total Supply Snapshots: must be > 0 or == -1 (%d %s)", amt, id)
 		}
 	}
+	if err := m.PaidCoupons.Validate(false); err != nil {
+		return errors.Wrap(errors.InvalidInputError, err, "module Paid Coupons")
+	}
 	if m.original == "" {
 		return errors.NewInternal("module position not initialized")
 	}
@@ -189,6 +198,13 @@ func (m *Module) NextSequence() uint64 {
 	return m.originalSequence + 1
 }
 
+// UpdateSequence module.Sequence if module has been modified. no-op if unmodified or sequence already updated.
+func (m *Module) UpdateSequence() {
+	if m.IsModified() {
+		m.Sequence = m.NextSequence()
+	}
+}
+
 // Copy entire module, including original and isModified data.
 func (m *Module) Copy() *Module {
 	j, _ := json.Marshal(m)
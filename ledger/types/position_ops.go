@@ -0,0 +1,280 @@
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dora-network/dora-service-utils/errors"
+)
+
+// RiskChecker decides whether users may borrow, see Position.Borrow.
+type RiskChecker interface {
+	// CheckBorrow returns errors.ErrBorrowLimit if the position may not borrow an amount more of an asset.
+	// It must not modify the position.
+	CheckBorrow(p *Position, assetID string, amount int64) error
+}
+
+// Available returns the amount of an asset the user owns and has not locked. Negative if they owe it.
+func (p *Position) Available(assetID string) int64 {
+	return p.Owned.AmountOf(assetID) - p.Locked.AmountOf(assetID)
+}
+
+// Debt returns the amount of an asset the user owes, which is their negative Owned balance, as a positive amount.
+func (p *Position) Debt(assetID string) int64 {
+	return max(0, -p.Owned.AmountOf(assetID))
+}
+
+// Reasons of the journal entries made by the operations below.
+const (
+	LockReason     = "lock"
+	UnlockReason   = "unlock"
+	SupplyReason   = "supply"
+	WithdrawReason = "withdraw"
+	BorrowReason   = "borrow"
+	RepayReason    = "repay"
+	TransferReason = "transfer"
+)
+
+// The operations below change positions at a time through a balanced journal entry, see JournalEntry.Apply, and so
+// keep the module in sync with them. Each returns its entry, for appending to the journal, and either succeeds or
+// leaves the positions and module unmodified.
+
+// Lock an amount of an asset the user owns, as the input to an order. Error ErrInsufficientBalance if the user
+// does not have the amount available.
+func (p *Position) Lock(assetID string, amount int64, now time.Time) (*JournalEntry, error) {
+	if err := validOperation(assetID, amount); err != nil {
+		return nil, err
+	}
+	if p.Available(assetID) < amount {
+		return nil, insufficientBalance(p.UserID, "lock", assetID, amount)
+	}
+	return p.post(
+		nil, nil, LockReason, now,
+		Posting{UserID: p.UserID, Account: AccountAvailable, AssetID: assetID, Amount: -amount},
+		Posting{UserID: p.UserID, Account: AccountLocked, AssetID: assetID, Amount: amount},
+	)
+}
+
+// Unlock an amount of an asset the user has locked. Error ErrInsufficientBalance if the user has not locked it.
+func (p *Position) Unlock(assetID string, amount int64, now time.Time) (*JournalEntry, error) {
+	if err := validOperation(assetID, amount); err != nil {
+		return nil, err
+	}
+	if p.Locked.AmountOf(assetID) < amount {
+		return nil, insufficientBalance(p.UserID, "unlock", assetID, amount)
+	}
+	return p.post(
+		nil, nil, UnlockReason, now,
+		Posting{UserID: p.UserID, Account: AccountLocked, AssetID: assetID, Amount: -amount},
+		Posting{UserID: p.UserID, Account: AccountAvailable, AssetID: assetID, Amount: amount},
+	)
+}
+
+// Supply an amount of an asset the user owns to the module, which lends it to borrowers. Error
+// ErrInsufficientBalance if the user does not have the amount available.
+func (p *Position) Supply(module *Module, assetID string, amount int64, now time.Time) (*JournalEntry, error) {
+	if err := validOperation(assetID, amount); err != nil {
+		return nil, err
+	}
+	if p.Available(assetID) < amount {
+		return nil, insufficientBalance(p.UserID, "supply", assetID, amount)
+	}
+	return p.post(
+		nil, module, SupplyReason, now,
+		Posting{UserID: p.UserID, Account: AccountOwned, AssetID: assetID, Amount: -amount},
+		Posting{UserID: p.UserID, Account: AccountSupplied, AssetID: assetID, Amount: amount},
+		Posting{Account: AccountModuleBalance, AssetID: assetID, Amount: amount},
+		Posting{Account: AccountModuleSupplied, AssetID: assetID, Amount: -amount},
+	)
+}
+
+// Withdraw an amount of an asset the user has supplied from the module. Error ErrInsufficientBalance if the user
+// has not supplied the amount, or the module has lent too much of it to pay it back.
+func (p *Position) Withdraw(module *Module, assetID string, amount int64, now time.Time) (*JournalEntry, error) {
+	if err := validOperation(assetID, amount); err != nil {
+		return nil, err
+	}
+	if module == nil {
+		return nil, errNoModule
+	}
+	if p.Supplied.AmountOf(assetID) < amount {
+		return nil, insufficientBalance(p.UserID, "withdraw", assetID, amount)
+	}
+	if module.Balance.AmountOf(assetID) < amount {
+		return nil, insufficientBalance("module", "pay out", assetID, amount)
+	}
+	return p.post(
+		nil, module, WithdrawReason, now,
+		Posting{UserID: p.UserID, Account: AccountSupplied, AssetID: assetID, Amount: -amount},
+		Posting{UserID: p.UserID, Account: AccountOwned, AssetID: assetID, Amount: amount},
+		Posting{Account: AccountModuleBalance, AssetID: assetID, Amount: -amount},
+		Posting{Account: AccountModuleSupplied, AssetID: assetID, Amount: amount},
+	)
+}
+
+// Borrow pays an amount of an asset out of the ledger, such as for a withdrawal, borrowing whatever the user does
+// not own from the module's supply. The user owes the borrowed amount, as a negative Owned balance, until they
+// repay it. Error ErrBorrowLimit if risk does not allow the borrow, or ErrInsufficientBalance if the module does
+// not have enough supply to lend, or the user would owe assets they have locked.
+func (p *Position) Borrow(
+	module *Module,
+	risk RiskChecker,
+	assetID string,
+	amount int64,
+	now time.Time,
+) (*JournalEntry, error) {
+	if err := validOperation(assetID, amount); err != nil {
+		return nil, err
+	}
+	if module == nil {
+		return nil, errNoModule
+	}
+	if p.Locked.AmountOf(assetID) > 0 && p.Available(assetID) < amount {
+		return nil, insufficientBalance(p.UserID, "borrow locked", assetID, amount)
+	}
+	borrowed := amount - max(0, p.Owned.AmountOf(assetID))
+	postings := []Posting{
+		{UserID: p.UserID, Account: AccountOwned, AssetID: assetID, Amount: -amount},
+		{Account: AccountExternal, AssetID: assetID, Amount: amount},
+	}
+	if borrowed > 0 {
+		if risk == nil {
+			return nil, errors.New(errors.InvalidInputError, "no risk checker to borrow with")
+		}
+		if err := risk.CheckBorrow(p, assetID, borrowed); err != nil {
+			return nil, err
+		}
+		if module.Balance.AmountOf(assetID) < borrowed {
+			return nil, insufficientBalance("module", "lend", assetID, borrowed)
+		}
+		postings = append(
+			postings,
+			Posting{Account: AccountModuleBalance, AssetID: assetID, Amount: -borrowed},
+			Posting{Account: AccountModuleBorrowed, AssetID: assetID, Amount: borrowed},
+		)
+	}
+	return p.post(nil, module, BorrowReason, now, postings...)
+}
+
+// Repay an amount of an asset the user owes, paid into the ledger, such as by a deposit. Error ErrRepayExceedsDebt
+// if the user owes less than the amount.
+func (p *Position) Repay(module *Module, assetID string, amount int64, now time.Time) (*JournalEntry, error) {
+	if err := validOperation(assetID, amount); err != nil {
+		return nil, err
+	}
+	if module == nil {
+		return nil, errNoModule
+	}
+	if p.Debt(assetID) < amount {
+		return nil, errors.Wrap(
+			errors.InvalidInputError,
+			errors.ErrRepayExceedsDebt,
+			fmt.Sprintf("user %s repays %d %s, owing %d", p.UserID, amount, assetID, p.Debt(assetID)),
+		)
+	}
+	postings := append(
+		[]Posting{
+			{Account: AccountExternal, AssetID: assetID, Amount: -amount},
+			{UserID: p.UserID, Account: AccountOwned, AssetID: assetID, Amount: amount},
+		},
+		RepayPostings(module, assetID, amount)...,
+	)
+	return p.post(nil, module, RepayReason, now, postings...)
+}
+
+// Transfer an amount of an asset the user has available to another user. If the recipient owes the asset, the
+// amount repays their debt first, so module may only be nil if they do not. Error ErrInsufficientBalance if the
+// user does not have the amount available.
+func (p *Position) Transfer(
+	to *Position,
+	module *Module,
+	assetID string,
+	amount int64,
+	now time.Time,
+) (*JournalEntry, error) {
+	if err := validOperation(assetID, amount); err != nil {
+		return nil, err
+	}
+	if to == nil || to.UserID == p.UserID {
+		return nil, errors.New(errors.InvalidInputError, "transfer needs another user to transfer to")
+	}
+	if p.Available(assetID) < amount {
+		return nil, insufficientBalance(p.UserID, "transfer", assetID, amount)
+	}
+	postings := []Posting{
+		{UserID: p.UserID, Account: AccountOwned, AssetID: assetID, Amount: -amount},
+		{UserID: to.UserID, Account: AccountOwned, AssetID: assetID, Amount: amount},
+	}
+	if repaid := min(amount, to.Debt(assetID)); repaid > 0 {
+		if module == nil {
+			return nil, errNoModule
+		}
+		postings = append(postings, RepayPostings(module, assetID, repaid)...)
+	}
+	return p.post(to, module, TransferReason, now, postings...)
+}
+
+// post applies a journal entry of balanced postings to the position, to another position if to is not nil, and
+// to the module, and returns the entry.
+func (p *Position) post(
+	to *Position,
+	module *Module,
+	reason string,
+	now time.Time,
+	postings ...Posting,
+) (*JournalEntry, error) {
+	entry, err := NewJournalEntry(reason, now.Unix(), postings...)
+	if err != nil {
+		return nil, err
+	}
+	positions := map[string]*Position{p.UserID: p}
+	if to != nil {
+		positions[to.UserID] = to
+	}
+	if err = entry.Apply(positions, module); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// RepayPostings returns the module's postings for an amount of debt being repaid: repaid borrows go back to the
+// module's Balance, and once borrows from supply are repaid, the rest repays virtual borrows, whose minted assets
+// leave the ledger.
+func RepayPostings(module *Module, assetID string, amount int64) []Posting {
+	var postings []Posting
+	borrowed := min(amount, max(0, module.Borrowed.AmountOf(assetID)))
+	if borrowed > 0 {
+		postings = append(
+			postings,
+			Posting{Account: AccountModuleBorrowed, AssetID: assetID, Amount: -borrowed},
+			Posting{Account: AccountModuleBalance, AssetID: assetID, Amount: borrowed},
+		)
+	}
+	if virtual := amount - borrowed; virtual > 0 {
+		postings = append(
+			postings,
+			Posting{Account: AccountModuleVirtual, AssetID: assetID, Amount: -virtual},
+			Posting{Account: AccountExternal, AssetID: assetID, Amount: virtual},
+		)
+	}
+	return postings
+}
+
+// validOperation validates an operation's asset and amount, which must be positive.
+func validOperation(assetID string, amount int64) error {
+	if err := ValidAssetID(assetID); err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return errors.ErrAmountMustBePositive
+	}
+	return nil
+}
+
+func insufficientBalance(userID, operation, assetID string, amount int64) error {
+	return errors.Wrap(
+		errors.InvalidInputError,
+		errors.ErrInsufficientBalance,
+		fmt.Sprintf("%s cannot %s %d %s", userID, operation, amount, assetID),
+	)
+}
@@ -0,0 +1,141 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+// borrowLimit allows borrowing up to a limit of each asset.
+type borrowLimit int64
+
+func (l borrowLimit) CheckBorrow(p *types.Position, assetID string, amount int64) error {
+	if p.Debt(assetID)+amount > int64(l) {
+		return errors.ErrBorrowLimit
+	}
+	return nil
+}
+
+// failed returns the error of an operation which is expected to fail.
+func failed(_ *types.JournalEntry, err error) error {
+	return err
+}
+
+func TestPosition_Operations(t *testing.T) {
+	require := require.New(t)
+	now := time.Unix(1_700_000_000, 0)
+
+	one := types.InitialPosition(consts.UserIDOne)
+	one.Owned = types.NewBalances(consts.StableID, 1_000)
+	two := types.InitialPosition(consts.UserIDTwo)
+	two.Owned = types.NewBalances(consts.StableID, 500)
+	module := types.InitialModule()
+	oneBefore, twoBefore := one.Copy(), two.Copy()
+	reconciled := func() {
+		report := types.ReconcileModule(module, []*types.Position{one, two}, now)
+		require.True(report.OK(), report.Discrepancies)
+	}
+	var entries []*types.JournalEntry
+	post := func(entry *types.JournalEntry, err error) {
+		require.NoError(err)
+		require.Equal(now.Unix(), entry.Time)
+		entries = append(entries, entry)
+	}
+
+	// lock and unlock
+	post(one.Lock(consts.StableID, 300, now))
+	require.Equal(int64(700), one.Available(consts.StableID))
+	require.ErrorIs(failed(one.Lock(consts.StableID, 701, now)), errors.ErrInsufficientBalance)
+	require.ErrorIs(failed(one.Unlock(consts.StableID, 301, now)), errors.ErrInsufficientBalance)
+	post(one.Unlock(consts.StableID, 100, now))
+	require.Equal(int64(200), one.Locked.AmountOf(consts.StableID))
+	require.Equal(int64(1_000), one.Owned.AmountOf(consts.StableID))
+
+	// supply and withdraw
+	require.ErrorIs(failed(one.Supply(module, consts.StableID, 801, now)), errors.ErrInsufficientBalance)
+	post(one.Supply(module, consts.StableID, 800, now))
+	post(two.Supply(module, consts.StableID, 500, now))
+	require.Equal(int64(200), one.Owned.AmountOf(consts.StableID))
+	require.Equal(int64(1_300), module.Balance.AmountOf(consts.StableID))
+	reconciled()
+	require.ErrorIs(failed(two.Withdraw(module, consts.StableID, 501, now)), errors.ErrInsufficientBalance)
+	post(two.Withdraw(module, consts.StableID, 100, now))
+	reconciled()
+
+	// borrow against the limit, and from the module's supply
+	risk := borrowLimit(1_000)
+	require.ErrorIs(failed(two.Borrow(module, risk, consts.StableID, 1_101, now)), errors.ErrBorrowLimit)
+	post(two.Borrow(module, risk, consts.StableID, 600, now))
+	require.Equal(int64(500), two.Debt(consts.StableID))
+	require.Equal(int64(500), module.Borrowed.AmountOf(consts.StableID))
+	reconciled()
+	// the module has lent too much to pay back all of one's supply
+	require.ErrorIs(failed(one.Withdraw(module, consts.StableID, 800, now)), errors.ErrInsufficientBalance)
+	// the locked amount cannot be borrowed against
+	require.ErrorIs(failed(one.Borrow(module, risk, consts.StableID, 1, now)), errors.ErrInsufficientBalance)
+
+	// repay, directly and by transfer
+	require.ErrorIs(failed(two.Repay(module, consts.StableID, 501, now)), errors.ErrRepayExceedsDebt)
+	post(two.Repay(module, consts.StableID, 300, now))
+	post(one.Unlock(consts.StableID, 200, now))
+	post(one.Transfer(two, module, consts.StableID, 150, now))
+	require.Equal(int64(50), two.Debt(consts.StableID))
+	require.Equal(int64(50), one.Owned.AmountOf(consts.StableID))
+	reconciled()
+	require.ErrorIs(failed(one.Transfer(two, module, consts.StableID, 51, now)), errors.ErrInsufficientBalance)
+	require.Error(failed(one.Transfer(one, module, consts.StableID, 1, now)))
+
+	// the entries explain every change, so replaying them rebuilds the positions and module
+	require.Equal(types.TransferReason, entries[len(entries)-1].Reason)
+	require.Equal(now.Unix(), one.LastUpdated)
+	positions := map[string]*types.Position{one.UserID: oneBefore, two.UserID: twoBefore}
+	replayed := types.InitialModule()
+	require.NoError(types.ReplayJournal(entries, positions, replayed))
+	for _, p := range []*types.Position{one, two} {
+		require.Equal(p.Owned, positions[p.UserID].Owned)
+		require.Equal(p.Locked, positions[p.UserID].Locked)
+		require.Equal(p.Supplied, positions[p.UserID].Supplied)
+	}
+	require.Equal(module.Balance, replayed.Balance)
+	require.Equal(module.Supplied, replayed.Supplied)
+	require.Equal(module.Borrowed, replayed.Borrowed)
+}
+
+func TestPosition_OperationsAtomic(t *testing.T) {
+	require := require.New(t)
+
+	one := types.InitialPosition(consts.UserIDOne)
+	one.Owned = types.NewBalances(consts.StableID, 100)
+	two := types.InitialPosition(consts.UserIDTwo)
+	two.Owned = types.NewBalances(consts.StableID, -50)
+	module := types.InitialModule()
+	oneBefore, twoBefore := one.Copy(), two.Copy()
+	now := time.Unix(1_700_000_000, 0)
+	post := func(_ *types.JournalEntry, err error) {
+		require.NoError(err)
+	}
+
+	// the recipient's debt cannot be repaid without the module
+	require.Error(failed(one.Transfer(two, nil, consts.StableID, 100, now)))
+	// the module's Borrowed and Virtual would not cover the debt, so the module's Virtual would be negative
+	require.Error(failed(one.Transfer(two, module, consts.StableID, 100, now)))
+	require.Error(failed(one.Supply(nil, consts.StableID, 10, now)))
+	require.ErrorIs(failed(one.Lock(consts.StableID, 0, now)), errors.ErrAmountMustBePositive)
+	require.Equal(oneBefore, one)
+	require.Equal(twoBefore, two)
+	require.Equal(types.InitialModule(), module)
+
+	// virtual borrows are repaid once borrows from supply are
+	module.Borrowed = types.NewBalances(consts.StableID, 20)
+	module.Virtual = types.NewBalances(consts.StableID, 30)
+	post(one.Transfer(two, module, consts.StableID, 100, now))
+	require.Equal(int64(50), two.Owned.AmountOf(consts.StableID))
+	require.Equal(int64(0), module.Borrowed.AmountOf(consts.StableID))
+	require.Equal(int64(0), module.Virtual.AmountOf(consts.StableID))
+	require.Equal(int64(20), module.Balance.AmountOf(consts.StableID))
+}
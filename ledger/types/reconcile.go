@@ -0,0 +1,126 @@
+package types
+
+import (
+	"sort"
+	"time"
+)
+
+// Module fields which ReconcileModule compares with the aggregate of users' positions.
+const (
+	// ReconcileSupplied compares Module.Supplied with users' Supplied balances.
+	ReconcileSupplied = "supplied"
+	// ReconcileBorrowed compares Module.Borrowed and Module.Virtual with users' negative Owned balances.
+	ReconcileBorrowed = "borrowed"
+	// ReconcileBalance compares Module.Balance with users' Supplied balances less their borrows which are not
+	// Virtual.
+	ReconcileBalance = "balance"
+)
+
+// PositionTotals aggregates the balances of many users' positions, per asset.
+type PositionTotals struct {
+	// OwnedPositive is the sum of positive Owned balances
+	OwnedPositive *Balances `json:"owned_positive"`
+	// OwnedNegative is the sum of negative Owned balances, which are borrows, as positive amounts
+	OwnedNegative *Balances `json:"owned_negative"`
+	Supplied      *Balances `json:"supplied"`
+	// Locked and InterestSources have no module counterpart, so are reported but not reconciled
+	Locked          *Balances `json:"locked"`
+	InterestSources *Balances `json:"interest_sources"`
+}
+
+// AggregatePositions sums the positions' balances per asset.
+func AggregatePositions(positions []*Position) *PositionTotals {
+	totals := &PositionTotals{
+		OwnedPositive:   EmptyBalances(),
+		OwnedNegative:   EmptyBalances(),
+		Supplied:        EmptyBalances(),
+		Locked:          EmptyBalances(),
+		InterestSources: EmptyBalances(),
+	}
+	for _, p := range positions {
+		totals.OwnedPositive = totals.OwnedPositive.AddBals(p.Owned.Positive())
+		totals.OwnedNegative = totals.OwnedNegative.AddBals(p.Owned.Negative())
+		totals.Supplied = totals.Supplied.AddBals(p.Supplied)
+		totals.Locked = totals.Locked.AddBals(p.Locked)
+		totals.InterestSources = totals.InterestSources.AddBals(p.InterestSources)
+	}
+	return totals
+}
+
+// ModuleDiscrepancy is one asset of one module field which does not match the aggregate of users' positions.
+type ModuleDiscrepancy struct {
+	AssetID string `json:"asset_id"`
+	// Field compared, such as ReconcileSupplied
+	Field string `json:"field"`
+	// Module is the module's amount, and Users the amount expected from users' positions
+	Module int64 `json:"module"`
+	Users  int64 `json:"users"`
+	// Difference is Module - Users
+	Difference int64 `json:"difference"`
+}
+
+// ModuleReconciliationReport describes the discrepancies found by ReconcileModule.
+type ModuleReconciliationReport struct {
+	// Time the module was checked at, in unix seconds
+	Time int64 `json:"time"`
+	// Number of user positions checked
+	Users  int             `json:"users"`
+	Totals *PositionTotals `json:"totals"`
+	// Discrepancies sorted by asset and field
+	Discrepancies []ModuleDiscrepancy `json:"discrepancies"`
+}
+
+// OK returns true if the report found no discrepancies.
+func (r *ModuleReconciliationReport) OK() bool {
+	return len(r.Discrepancies) == 0
+}
+
+// ReconcileModule compares the module's Supplied, Borrowed and Balance with the aggregate of all users' positions,
+// per asset. Positions must be all users' positions, or the module will appear to differ from them.
+// ReconcileModule does not modify anything.
+func ReconcileModule(module *Module, positions []*Position, now time.Time) *ModuleReconciliationReport {
+	totals := AggregatePositions(positions)
+	report := &ModuleReconciliationReport{
+		Time:   now.Unix(),
+		Users:  len(positions),
+		Totals: totals,
+	}
+	compare := func(assetID, field string, moduleAmount, usersAmount int64) {
+		if moduleAmount != usersAmount {
+			report.Discrepancies = append(
+				report.Discrepancies, ModuleDiscrepancy{
+					AssetID:    assetID,
+					Field:      field,
+					Module:     moduleAmount,
+					Users:      usersAmount,
+					Difference: moduleAmount - usersAmount,
+				},
+			)
+		}
+	}
+
+	assetIDs := make(map[string]bool)
+	for _, bals := range []*Balances{
+		module.Balance, module.Supplied, module.Borrowed, module.Virtual,
+		totals.OwnedNegative, totals.Supplied,
+	} {
+		for _, assetID := range bals.AssetIDs() {
+			assetIDs[assetID] = true
+		}
+	}
+	sorted := make([]string, 0, len(assetIDs))
+	for assetID := range assetIDs {
+		sorted = append(sorted, assetID)
+	}
+	sort.Strings(sorted)
+
+	for _, assetID := range sorted {
+		supplied := totals.Supplied.AmountOf(assetID)
+		borrowed := totals.OwnedNegative.AmountOf(assetID)
+		virtual := module.Virtual.AmountOf(assetID)
+		compare(assetID, ReconcileBalance, module.Balance.AmountOf(assetID), supplied-(borrowed-virtual))
+		compare(assetID, ReconcileBorrowed, module.Borrowed.AmountOf(assetID)+virtual, borrowed)
+		compare(assetID, ReconcileSupplied, module.Supplied.AmountOf(assetID), supplied)
+	}
+	return report
+}
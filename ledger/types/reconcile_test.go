@@ -0,0 +1,69 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func TestReconcileModule(t *testing.T) {
+	require := require.New(t)
+	now := time.Unix(1_700_000_000, 0)
+
+	one, err := types.NewPosition(
+		consts.UserIDOne,
+		types.NewBalances(consts.StableID, 600).AddAmount(consts.BondID, -5),
+		types.NewBalances(consts.StableID, 100),
+		types.NewBalances(consts.StableID, 1_000),
+		nil, nil,
+		types.NewBalances("bond1-Coupon_123456", 7),
+		"", 0, 1,
+	)
+	require.NoError(err)
+	two, err := types.NewPosition(
+		consts.UserIDTwo,
+		types.NewBalances(consts.StableID, -300),
+		nil,
+		types.NewBalances(consts.BondID, 20),
+		nil, nil, nil,
+		"", 0, 1,
+	)
+	require.NoError(err)
+	positions := []*types.Position{one, two}
+
+	// 300 stable borrowed from supply, and 5 bonds virtually borrowed
+	module, err := types.NewModule(
+		types.NewBalances(consts.StableID, 700).AddAmount(consts.BondID, 20),
+		types.NewBalances(consts.StableID, 1_000).AddAmount(consts.BondID, 20),
+		types.NewBalances(consts.StableID, 300),
+		types.NewBalances(consts.BondID, 5),
+		nil, nil,
+		0, 1,
+	)
+	require.NoError(err)
+
+	report := types.ReconcileModule(module, positions, now)
+	require.True(report.OK(), report.Discrepancies)
+	require.Equal(2, report.Users)
+	require.Equal(int64(600), report.Totals.OwnedPositive.AmountOf(consts.StableID))
+	require.Equal(int64(300), report.Totals.OwnedNegative.AmountOf(consts.StableID))
+	require.Equal(int64(100), report.Totals.Locked.AmountOf(consts.StableID))
+	require.Equal(int64(7), report.Totals.InterestSources.AmountOf("bond1-Coupon_123456"))
+
+	// the module forgot a supply of 50 stable
+	module.Supplied = module.Supplied.SubAmount(consts.StableID, 50)
+	module.Balance = module.Balance.SubAmount(consts.StableID, 50)
+	report = types.ReconcileModule(module, positions, now)
+	require.False(report.OK())
+	require.Equal(
+		[]types.ModuleDiscrepancy{
+			{AssetID: consts.StableID, Field: types.ReconcileBalance, Module: 650, Users: 700, Difference: -50},
+			{AssetID: consts.StableID, Field: types.ReconcileSupplied, Module: 950, Users: 1_000, Difference: -50},
+		},
+		report.Discrepancies,
+	)
+}
@@ -1,7 +1,11 @@
 package decimal
 
 import (
+	gmath "math"
+
 	"github.com/govalues/decimal"
+
+	"github.com/dora-network/dora-service-utils/errors"
 )
 
 func EQ(a, b decimal.Decimal) bool {
@@ -23,3 +27,31 @@ func GTE(a, b decimal.Decimal) bool {
 func LTE(a, b decimal.Decimal) bool {
 	return a.Cmp(b) <= 0
 }
+
+// FromUint64 converts an integer amount to a decimal. Error if the amount does not fit in 19 digits.
+func FromUint64(u uint64) (decimal.Decimal, error) {
+	if u > gmath.MaxInt64 {
+		return decimal.Decimal{}, errors.Data("amount %d is too large for decimal", u)
+	}
+	return decimal.New(int64(u), 0)
+}
+
+// FloorUint64 rounds d towards negative infinity and converts it to an integer amount.
+// Error if the result is negative or does not fit in an int64.
+func FloorUint64(d decimal.Decimal) (uint64, error) {
+	return toUint64(d.Floor(0))
+}
+
+// CeilUint64 rounds d towards positive infinity and converts it to an integer amount.
+// Error if the result is negative or does not fit in an int64.
+func CeilUint64(d decimal.Decimal) (uint64, error) {
+	return toUint64(d.Ceil(0))
+}
+
+func toUint64(d decimal.Decimal) (uint64, error) {
+	whole, _, ok := d.Int64(0)
+	if !ok || whole < 0 {
+		return 0, errors.Data("decimal %s is not a valid amount", d)
+	}
+	return uint64(whole), nil
+}
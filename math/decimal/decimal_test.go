@@ -50,3 +50,23 @@ func TestDecimalComparisons(t *testing.T) {
 		},
 	)
 }
+
+func TestDecimalAmounts(t *testing.T) {
+	d, err := mdecimal.FromUint64(12)
+	assert.NoError(t, err)
+	assert.True(t, mdecimal.EQ(decimal.MustParse("12"), d))
+	_, err = mdecimal.FromUint64(1 << 63)
+	assert.Error(t, err)
+
+	u, err := mdecimal.FloorUint64(decimal.MustParse("1.9"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), u)
+	u, err = mdecimal.CeilUint64(decimal.MustParse("1.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), u)
+	u, err = mdecimal.CeilUint64(decimal.MustParse("2"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), u)
+	_, err = mdecimal.FloorUint64(decimal.MustParse("-0.5"))
+	assert.Error(t, err)
+}
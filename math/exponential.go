@@ -2,6 +2,9 @@ package math
 
 import "math/big"
 
+// expPrec is the least precision, in bits, of Exponential's result.
+const expPrec = 256
+
 // ApproxExponential is the taylor series expansion of e^x centered around x=0, truncated
 // to the cubic term. It can be used with great accuracy to determine e^x when x is very small.
 // Note that e^x = 1 + x/1! + x^2/2! + x^3 / 3! + ...
@@ -14,3 +17,33 @@ func ApproxExponential(x *big.Float) *big.Float {
 	)
 	return sum // approximated e^x
 }
+
+// Exponential returns e^x to the precision of x, or at least 256 bits. Unlike ApproxExponential, it is accurate
+// for any x: x is halved until the taylor series converges quickly, and the series' sum squared back up, as
+// e^x = (e^(x/2^n))^(2^n).
+func Exponential(x *big.Float) *big.Float {
+	prec := max(x.Prec(), expPrec)
+	// guard bits for the precision lost by squaring
+	work := prec + 64
+	r := new(big.Float).SetPrec(work).Set(x)
+	halvings := 0
+	if exp := r.MantExp(nil); r.Sign() != 0 && exp > -8 {
+		halvings = exp + 8
+		r.SetMantExp(r, -halvings)
+	}
+
+	sum := new(big.Float).SetPrec(work).SetInt64(1)
+	term := new(big.Float).SetPrec(work).SetInt64(1)
+	for i := int64(1); ; i++ {
+		term.Mul(term, r)
+		term.Quo(term, new(big.Float).SetPrec(work).SetInt64(i))
+		if term.Sign() == 0 || term.MantExp(nil) < sum.MantExp(nil)-int(work) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	for range halvings {
+		sum.Mul(sum, sum)
+	}
+	return sum.SetPrec(prec)
+}
@@ -440,3 +440,35 @@ func TestExecutedPrice(t *testing.T) {
 		)
 	}
 }
+
+func TestExponential(t *testing.T) {
+	tcs := []struct {
+		title string
+		x     float64
+		exp   string
+	}{
+		{"zero", 0, "1"},
+		{"one", 1, "2.71828182845904523536028747135266249775724709369995"},
+		// of the float64 nearest 0.0001
+		{"small", 0.0001, "1.00010000500016667083820932089928323199219754546927823914969"},
+		{"negative", -2.5, "0.0820849986238987951695286744671598078378041210154366488457584"},
+		{"large", 50, "5184705528587072464087.45332293348538482746910058384640190406"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(
+			tc.title, func(t *testing.T) {
+				want, ok := new(big.Float).SetPrec(256).SetString(tc.exp)
+				require.True(t, ok)
+				got := math.Exponential(big.NewFloat(tc.x))
+				// relative error
+				diff := new(big.Float).Quo(new(big.Float).Sub(got, want), want)
+				require.Less(t, new(big.Float).Abs(diff).Cmp(big.NewFloat(1e-40)), 0, got.Text('g', 50))
+			},
+		)
+	}
+
+	// the three-term series is not accurate beyond small x
+	approx := math.ApproxExponential(big.NewFloat(1))
+	require.NotEqual(t, 0, new(big.Float).Sub(approx, math.Exponential(big.NewFloat(1))).Sign())
+}
@@ -0,0 +1,338 @@
+package orderbook
+
+import (
+	"sort"
+
+	"github.com/goccy/go-json"
+	"github.com/govalues/decimal"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/math"
+)
+
+// LevelAction describes how a price level changed between two depth sequences.
+type LevelAction string
+
+const (
+	LevelAdded   LevelAction = "added"
+	LevelChanged LevelAction = "changed"
+	LevelRemoved LevelAction = "removed"
+)
+
+// PriceLevel is the total amount resting at a single price on one side of an order book.
+type PriceLevel struct {
+	Price  decimal.Decimal `json:"price"`
+	Amount uint64          `json:"amount"`
+}
+
+// LevelChange is a single entry of a DepthUpdate. Amount is the new total at the price level,
+// and is zero when the level was removed.
+type LevelChange struct {
+	Side   Side            `json:"side"`
+	Price  decimal.Decimal `json:"price"`
+	Amount uint64          `json:"amount"`
+	Action LevelAction     `json:"action"`
+}
+
+// DepthSnapshot is the full level-2 state of an order book at a given sequence.
+// Bids are sorted by descending price and asks by ascending price.
+type DepthSnapshot struct {
+	OrderBookID string       `json:"order_book_id"`
+	Sequence    uint64       `json:"sequence"`
+	Bids        []PriceLevel `json:"bids"`
+	Asks        []PriceLevel `json:"asks"`
+}
+
+func (s *DepthSnapshot) MarshalBinary() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+func (s *DepthSnapshot) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, s)
+}
+
+// DepthUpdate contains the level changes which move an order book from Sequence-1 to Sequence.
+type DepthUpdate struct {
+	OrderBookID string        `json:"order_book_id"`
+	Sequence    uint64        `json:"sequence"`
+	Changes     []LevelChange `json:"changes"`
+}
+
+func (u *DepthUpdate) MarshalBinary() ([]byte, error) {
+	return json.Marshal(u)
+}
+
+func (u *DepthUpdate) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, u)
+}
+
+// levelKey identifies a price level. Prices are trimmed so that 1.5 and 1.50 share a level,
+// and stored levels always hold the trimmed price.
+type levelKey struct {
+	side  Side
+	price string
+}
+
+func newLevelKey(side Side, price decimal.Decimal) levelKey {
+	return levelKey{side: side, price: price.Trim(0).String()}
+}
+
+// Depth aggregates resting order amounts into price levels for one order book, and produces
+// snapshots and incremental updates for consumers. Depth is not safe for concurrent use.
+type Depth struct {
+	orderBookID string
+	sequence    uint64
+	levels      map[levelKey]PriceLevel
+	// amounts of each level modified since the last Flush, as they were before the first modification
+	pending map[levelKey]uint64
+}
+
+// NewDepth creates an empty Depth for an order book, starting at sequence 0.
+func NewDepth(orderBookID string) *Depth {
+	return &Depth{
+		orderBookID: orderBookID,
+		levels:      map[levelKey]PriceLevel{},
+		pending:     map[levelKey]uint64{},
+	}
+}
+
+// Sequence of the last flushed update.
+func (d *Depth) Sequence() uint64 {
+	return d.sequence
+}
+
+// Add an amount to the level at price on one side of the book, creating the level if necessary.
+func (d *Depth) Add(side Side, price decimal.Decimal, amount uint64) error {
+	if err := validateLevel(side, price, amount); err != nil {
+		return err
+	}
+	key := newLevelKey(side, price)
+	current := d.levels[key].Amount
+	total, err := math.CheckedAddU64(current, amount)
+	if err != nil {
+		return err
+	}
+	d.set(key, price, current, total)
+	return nil
+}
+
+// Remove an amount from the level at price on one side of the book. The level is removed once empty.
+// Error if the level holds less than amount.
+func (d *Depth) Remove(side Side, price decimal.Decimal, amount uint64) error {
+	if err := validateLevel(side, price, amount); err != nil {
+		return err
+	}
+	key := newLevelKey(side, price)
+	current := d.levels[key].Amount
+	total, err := math.CheckedSubU64(current, amount)
+	if err != nil {
+		return errors.Data("cannot remove %d from %s level %s holding %d", amount, side, key.price, current)
+	}
+	d.set(key, price, current, total)
+	return nil
+}
+
+// Flush returns the changes made since the previous Flush as a DepthUpdate with the next sequence number.
+// Returns nil if no level has changed, in which case the sequence is not incremented.
+func (d *Depth) Flush() *DepthUpdate {
+	changes := make([]LevelChange, 0, len(d.pending))
+	for key, before := range d.pending {
+		level, ok := d.levels[key]
+		var action LevelAction
+		switch {
+		case before == 0 && ok:
+			action = LevelAdded
+		case before > 0 && !ok:
+			action = LevelRemoved
+		case ok && level.Amount != before:
+			action = LevelChanged
+		default:
+			continue // level returned to its original amount
+		}
+		price, err := decimal.Parse(key.price)
+		if err != nil {
+			continue // keys are always created from valid decimals
+		}
+		changes = append(changes, LevelChange{Side: key.side, Price: price, Amount: level.Amount, Action: action})
+	}
+	d.pending = map[levelKey]uint64{}
+	if len(changes) == 0 {
+		return nil
+	}
+	sortChanges(changes)
+	d.sequence++
+	return &DepthUpdate{
+		OrderBookID: d.orderBookID,
+		Sequence:    d.sequence,
+		Changes:     changes,
+	}
+}
+
+// Snapshot of the book as of the last flushed sequence. Changes which have not been flushed yet are excluded,
+// so that applying the next update to this snapshot always yields the current state.
+func (d *Depth) Snapshot() *DepthSnapshot {
+	levels := make(map[levelKey]PriceLevel, len(d.levels))
+	for key, level := range d.levels {
+		levels[key] = level
+	}
+	for key, before := range d.pending {
+		if before == 0 {
+			delete(levels, key)
+			continue
+		}
+		price, err := decimal.Parse(key.price)
+		if err != nil {
+			continue
+		}
+		levels[key] = PriceLevel{Price: price, Amount: before}
+	}
+	return newDepthSnapshot(d.orderBookID, d.sequence, levels)
+}
+
+func (d *Depth) set(key levelKey, price decimal.Decimal, before, after uint64) {
+	if _, ok := d.pending[key]; !ok {
+		d.pending[key] = before
+	}
+	if after == 0 {
+		delete(d.levels, key)
+		return
+	}
+	d.levels[key] = PriceLevel{Price: price.Trim(0), Amount: after}
+}
+
+// DepthBook reconstructs an order book's depth on the consumer side from a DepthSnapshot followed by
+// contiguous DepthUpdates. DepthBook is not safe for concurrent use.
+type DepthBook struct {
+	orderBookID string
+	sequence    uint64
+	levels      map[levelKey]PriceLevel
+	synced      bool
+}
+
+// NewDepthBook creates a DepthBook which must be initialised with ApplySnapshot before updates are accepted.
+func NewDepthBook(orderBookID string) *DepthBook {
+	return &DepthBook{
+		orderBookID: orderBookID,
+		levels:      map[levelKey]PriceLevel{},
+	}
+}
+
+// Sequence of the last snapshot or update applied.
+func (b *DepthBook) Sequence() uint64 {
+	return b.sequence
+}
+
+// NeedsResync returns true if the book has not been initialised, or a sequence gap was detected.
+// A fresh snapshot must be applied before further updates are accepted.
+func (b *DepthBook) NeedsResync() bool {
+	return !b.synced
+}
+
+// ApplySnapshot replaces the contents of the book. Snapshots older than the book's current sequence are
+// ignored unless the book needs a resync.
+func (b *DepthBook) ApplySnapshot(s *DepthSnapshot) error {
+	if s == nil || s.OrderBookID != b.orderBookID {
+		return errors.ErrInvalidInput
+	}
+	if b.synced && s.Sequence < b.sequence {
+		return nil
+	}
+	levels := map[levelKey]PriceLevel{}
+	for side, sideLevels := range map[Side][]PriceLevel{Buy: s.Bids, Sell: s.Asks} {
+		for _, level := range sideLevels {
+			if err := validateLevel(side, level.Price, level.Amount); err != nil {
+				return err
+			}
+			levels[newLevelKey(side, level.Price)] = PriceLevel{Price: level.Price.Trim(0), Amount: level.Amount}
+		}
+	}
+	b.levels = levels
+	b.sequence = s.Sequence
+	b.synced = true
+	return nil
+}
+
+// ApplyUpdate applies an incremental update. Updates at or below the current sequence are ignored.
+// If the update does not immediately follow the current sequence, the book is marked as needing a resync and
+// ErrDepthSequenceGap is returned. While a resync is needed, updates return ErrDepthResyncRequired.
+func (b *DepthBook) ApplyUpdate(u *DepthUpdate) error {
+	if u == nil || u.OrderBookID != b.orderBookID {
+		return errors.ErrInvalidInput
+	}
+	if !b.synced {
+		return errors.ErrDepthResyncRequired
+	}
+	if u.Sequence <= b.sequence {
+		return nil
+	}
+	if u.Sequence != b.sequence+1 {
+		b.synced = false
+		return errors.ErrDepthSequenceGap
+	}
+	for _, c := range u.Changes {
+		if c.Side != Buy && c.Side != Sell {
+			return errors.ErrInvalidInput
+		}
+		key := newLevelKey(c.Side, c.Price)
+		if c.Action == LevelRemoved || c.Amount == 0 {
+			delete(b.levels, key)
+			continue
+		}
+		b.levels[key] = PriceLevel{Price: c.Price.Trim(0), Amount: c.Amount}
+	}
+	b.sequence = u.Sequence
+	return nil
+}
+
+// Snapshot of the book's current state.
+func (b *DepthBook) Snapshot() *DepthSnapshot {
+	return newDepthSnapshot(b.orderBookID, b.sequence, b.levels)
+}
+
+func validateLevel(side Side, price decimal.Decimal, amount uint64) error {
+	if side != Buy && side != Sell {
+		return errors.ErrInvalidInput
+	}
+	if !price.IsPos() {
+		return errors.ErrPriceMustBePositive
+	}
+	if amount == 0 {
+		return errors.ErrAmountCannotBeZero
+	}
+	return nil
+}
+
+func newDepthSnapshot(orderBookID string, sequence uint64, levels map[levelKey]PriceLevel) *DepthSnapshot {
+	s := &DepthSnapshot{
+		OrderBookID: orderBookID,
+		Sequence:    sequence,
+		Bids:        []PriceLevel{},
+		Asks:        []PriceLevel{},
+	}
+	for key, level := range levels {
+		if key.side == Buy {
+			s.Bids = append(s.Bids, level)
+		} else {
+			s.Asks = append(s.Asks, level)
+		}
+	}
+	// buyer prices are sorted descending, seller prices ascending
+	sort.Slice(s.Bids, func(i, j int) bool { return s.Bids[i].Price.Cmp(s.Bids[j].Price) > 0 })
+	sort.Slice(s.Asks, func(i, j int) bool { return s.Asks[i].Price.Cmp(s.Asks[j].Price) < 0 })
+	return s
+}
+
+// sortChanges orders changes by side, then by price in book order, so updates are deterministic.
+func sortChanges(changes []LevelChange) {
+	sort.Slice(
+		changes, func(i, j int) bool {
+			if changes[i].Side != changes[j].Side {
+				return changes[i].Side == Buy
+			}
+			if changes[i].Side == Buy {
+				return changes[i].Price.Cmp(changes[j].Price) > 0
+			}
+			return changes[i].Price.Cmp(changes[j].Price) < 0
+		},
+	)
+}
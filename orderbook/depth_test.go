@@ -0,0 +1,98 @@
+package orderbook_test
+
+import (
+	"testing"
+
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/orderbook"
+)
+
+func TestDepth(t *testing.T) {
+	require := require.New(t)
+	id := orderbook.ID("bond1", "stable1")
+	depth := orderbook.NewDepth(id)
+
+	require.NoError(depth.Add(orderbook.Buy, decimal.MustParse("10"), 100))
+	require.NoError(depth.Add(orderbook.Buy, decimal.MustParse("11"), 50))
+	require.NoError(depth.Add(orderbook.Sell, decimal.MustParse("12"), 70))
+	require.Empty(depth.Snapshot().Bids)
+
+	update := depth.Flush()
+	require.NotNil(update)
+	require.Equal(uint64(1), update.Sequence)
+	require.Equal(
+		[]orderbook.LevelChange{
+			{Side: orderbook.Buy, Price: decimal.MustParse("11"), Amount: 50, Action: orderbook.LevelAdded},
+			{Side: orderbook.Buy, Price: decimal.MustParse("10"), Amount: 100, Action: orderbook.LevelAdded},
+			{Side: orderbook.Sell, Price: decimal.MustParse("12"), Amount: 70, Action: orderbook.LevelAdded},
+		},
+		update.Changes,
+	)
+	require.Nil(depth.Flush())
+
+	snapshot := depth.Snapshot()
+	require.Equal(uint64(1), snapshot.Sequence)
+	require.Len(snapshot.Bids, 2)
+	require.Equal(decimal.MustParse("11"), snapshot.Bids[0].Price)
+	require.Len(snapshot.Asks, 1)
+
+	// 10.00 and 10 are the same level
+	require.NoError(depth.Add(orderbook.Buy, decimal.MustParse("10.00"), 5))
+	require.NoError(depth.Remove(orderbook.Buy, decimal.MustParse("11"), 50))
+	require.NoError(depth.Add(orderbook.Sell, decimal.MustParse("13"), 1))
+	require.NoError(depth.Remove(orderbook.Sell, decimal.MustParse("13"), 1))
+	require.Error(depth.Remove(orderbook.Sell, decimal.MustParse("12"), 71))
+	require.ErrorIs(depth.Add(orderbook.Sell, decimal.Zero, 1), errors.ErrPriceMustBePositive)
+
+	// unflushed changes are not part of the snapshot
+	require.Equal(snapshot, depth.Snapshot())
+
+	update = depth.Flush()
+	require.Equal(uint64(2), update.Sequence)
+	require.Equal(
+		[]orderbook.LevelChange{
+			{Side: orderbook.Buy, Price: decimal.MustParse("11"), Amount: 0, Action: orderbook.LevelRemoved},
+			{Side: orderbook.Buy, Price: decimal.MustParse("10"), Amount: 105, Action: orderbook.LevelChanged},
+		},
+		update.Changes,
+	)
+
+	// a consumer which applies the first snapshot and the update ends up with the producer's state
+	book := orderbook.NewDepthBook(id)
+	require.True(book.NeedsResync())
+	require.ErrorIs(book.ApplyUpdate(update), errors.ErrDepthResyncRequired)
+	require.NoError(book.ApplySnapshot(snapshot))
+	require.NoError(book.ApplyUpdate(update))
+	require.NoError(book.ApplyUpdate(update)) // duplicates are ignored
+	require.Equal(depth.Snapshot(), book.Snapshot())
+}
+
+func TestDepthBook_SequenceGap(t *testing.T) {
+	require := require.New(t)
+	id := orderbook.ID("bond1", "stable1")
+	depth := orderbook.NewDepth(id)
+	book := orderbook.NewDepthBook(id)
+	require.NoError(book.ApplySnapshot(depth.Snapshot()))
+
+	require.NoError(depth.Add(orderbook.Sell, decimal.MustParse("1.5"), 10))
+	first := depth.Flush()
+	require.NoError(depth.Add(orderbook.Sell, decimal.MustParse("1.5"), 10))
+	second := depth.Flush()
+
+	// first update is lost
+	require.ErrorIs(book.ApplyUpdate(second), errors.ErrDepthSequenceGap)
+	require.True(book.NeedsResync())
+	require.ErrorIs(book.ApplyUpdate(first), errors.ErrDepthResyncRequired)
+
+	// resync from a fresh snapshot
+	require.NoError(book.ApplySnapshot(depth.Snapshot()))
+	require.False(book.NeedsResync())
+	require.Equal(uint64(2), book.Sequence())
+	require.Equal([]orderbook.PriceLevel{{Price: decimal.MustParse("1.5"), Amount: 20}}, book.Snapshot().Asks)
+
+	// updates for another order book are rejected
+	require.Error(book.ApplyUpdate(&orderbook.DepthUpdate{OrderBookID: "other", Sequence: 3}))
+}
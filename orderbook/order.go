@@ -0,0 +1,324 @@
+package orderbook
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/govalues/decimal"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/math"
+)
+
+type OrderType string
+
+const (
+	Market OrderType = "market"
+	Limit  OrderType = "limit"
+)
+
+// Valid returns true for supported order types.
+func (t OrderType) Valid() bool {
+	return t == Market || t == Limit
+}
+
+type OrderStatus string
+
+const (
+	StatusNew             OrderStatus = "new"
+	StatusOpen            OrderStatus = "open"
+	StatusPartiallyFilled OrderStatus = "partially_filled"
+	StatusFilled          OrderStatus = "filled"
+	StatusCancelled       OrderStatus = "cancelled"
+	StatusRejected        OrderStatus = "rejected"
+	StatusExpired         OrderStatus = "expired"
+)
+
+// transitions lists the statuses an order can move to from each status.
+// Statuses missing from the map are terminal.
+var transitions = map[OrderStatus][]OrderStatus{
+	StatusNew:             {StatusOpen, StatusRejected},
+	StatusOpen:            {StatusPartiallyFilled, StatusFilled, StatusCancelled, StatusExpired},
+	StatusPartiallyFilled: {StatusPartiallyFilled, StatusFilled, StatusCancelled, StatusExpired},
+}
+
+// CanTransition returns true if an order in status from may move to status to.
+func (s OrderStatus) CanTransition(to OrderStatus) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Terminal returns true if an order in this status can no longer change.
+func (s OrderStatus) Terminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// Order is the order model shared by every order-handling service.
+// Orders must only change status through their methods, which enforce the order lifecycle:
+//
+//	new -> open -> partially filled -> filled
+//	new -> rejected
+//	open, partially filled -> cancelled, expired
+type Order struct {
+	OrderID     string    `json:"order_id"`
+	UserID      string    `json:"user_id"`
+	OrderBookID string    `json:"order_book_id"`
+	Side        Side      `json:"side"`
+	Type        OrderType `json:"type"`
+	// Sell orders have AssetIn = base and AssetOut = quote, buy orders the other way around.
+	AssetIn  string `json:"asset_in"`
+	AssetOut string `json:"asset_out"`
+	// Amount of AssetIn to trade. Filled is the part of Amount which was already traded.
+	Amount uint64 `json:"amount"`
+	Filled uint64 `json:"filled"`
+	// Price is the limit price of limit orders, zero for market orders.
+	Price decimal.Decimal `json:"price"`
+	// Leverage of the order, zero if the order is not leveraged.
+	Leverage decimal.Decimal `json:"leverage"`
+	Status   OrderStatus     `json:"status"`
+	// ExpiresAt is the unix time after which an order can be expired, zero if the order does not expire.
+	ExpiresAt int64 `json:"expires_at"`
+	CreatedAt int64 `json:"created_at"`
+	UpdatedAt int64 `json:"updated_at"`
+	// Sequence is incremented on every change, so consumers of status events can order them.
+	Sequence uint64 `json:"sequence"`
+}
+
+// NewOrder creates an order in status new. The order is not validated until it is opened.
+func NewOrder(
+	orderID, userID string,
+	side Side,
+	orderType OrderType,
+	base, quote string,
+	amount uint64,
+	price decimal.Decimal,
+	at time.Time,
+) *Order {
+	o := &Order{
+		OrderID:     orderID,
+		UserID:      userID,
+		OrderBookID: ID(base, quote),
+		Side:        side,
+		Type:        orderType,
+		AssetIn:     base,
+		AssetOut:    quote,
+		Amount:      amount,
+		Price:       price,
+		Status:      StatusNew,
+		CreatedAt:   at.Unix(),
+		UpdatedAt:   at.Unix(),
+	}
+	if side == Buy {
+		o.AssetIn, o.AssetOut = quote, base
+	}
+	return o
+}
+
+func (o *Order) MarshalBinary() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+func (o *Order) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, o)
+}
+
+// Remaining amount of the order which has not been filled yet.
+func (o *Order) Remaining() uint64 {
+	if o.Filled > o.Amount {
+		return 0
+	}
+	return o.Amount - o.Filled
+}
+
+// Validate the order's contents, regardless of its status.
+func (o *Order) Validate() error {
+	if o.UserID == "" {
+		return errors.ErrOrderMissingUserID
+	}
+	if !o.Type.Valid() {
+		return errors.ErrInvalidOrderType
+	}
+	base := GetBaseFromOrderBookID(o.OrderBookID)
+	quote := GetQuoteFromOrderBookID(o.OrderBookID)
+	if base == "" || quote == "" {
+		return errors.ErrOrderBookIDAssetMismatch
+	}
+	switch o.Side {
+	case Sell:
+		if o.AssetIn != base {
+			return errors.ErrInvalidInAssetSell
+		}
+		if o.AssetOut != quote {
+			return errors.ErrInvalidOutAssetSell
+		}
+	case Buy:
+		if o.AssetIn != quote {
+			return errors.ErrInvalidInAssetBuy
+		}
+		if o.AssetOut != base {
+			return errors.ErrInvalidOutAssetBuy
+		}
+	default:
+		return errors.Data("invalid order side: %s", o.Side)
+	}
+	if o.Amount == 0 {
+		return errors.ErrAmountCannotBeZero
+	}
+	if o.Filled > o.Amount {
+		return errors.ErrOrderFillExceedsAmount
+	}
+	if o.Type == Limit && !o.Price.IsPos() {
+		return errors.ErrInvalidLimitPrice
+	}
+	if o.Leverage.IsNeg() {
+		return errors.Data("order leverage cannot be negative")
+	}
+	return nil
+}
+
+// Open a new order after validating it.
+func (o *Order) Open(at time.Time) (*OrderStatusEvent, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	return o.transition(StatusOpen, 0, "", at)
+}
+
+// Reject a new order, for example because it failed validation or the user cannot afford it.
+func (o *Order) Reject(reason string, at time.Time) (*OrderStatusEvent, error) {
+	return o.transition(StatusRejected, 0, reason, at)
+}
+
+// Fill part of an open order. The order becomes filled once nothing remains.
+func (o *Order) Fill(amount uint64, at time.Time) (*OrderStatusEvent, error) {
+	if amount == 0 {
+		return nil, errors.ErrAmountCannotBeZero
+	}
+	filled, err := math.CheckedAddU64(o.Filled, amount)
+	if err != nil {
+		return nil, err
+	}
+	if filled > o.Amount {
+		return nil, errors.ErrOrderFillExceedsAmount
+	}
+	status := StatusPartiallyFilled
+	if filled == o.Amount {
+		status = StatusFilled
+	}
+	return o.transition(status, filled, "", at)
+}
+
+// Cancel the remainder of an open order.
+func (o *Order) Cancel(reason string, at time.Time) (*OrderStatusEvent, error) {
+	return o.transition(StatusCancelled, o.Filled, reason, at)
+}
+
+// Expire the remainder of an open order. Error if the order does not expire or has not expired yet.
+func (o *Order) Expire(at time.Time) (*OrderStatusEvent, error) {
+	if o.ExpiresAt == 0 || at.Unix() < o.ExpiresAt {
+		return nil, errors.Data("order %s has not expired", o.OrderID)
+	}
+	return o.transition(StatusExpired, o.Filled, "", at)
+}
+
+// Amend an open order's amount, price and expiry to those of amended. The order type, assets and
+// leverage cannot be changed, and the amount cannot be lowered to or below the filled amount.
+// The order's status is unchanged, but an event is still returned so consumers see the new terms.
+func (o *Order) Amend(amended Order, at time.Time) (*OrderStatusEvent, error) {
+	if o.Status != StatusOpen && o.Status != StatusPartiallyFilled {
+		return nil, errors.Data("%w: cannot amend %s order", errors.ErrInvalidOrderTransition, o.Status)
+	}
+	if amended.OrderID != o.OrderID {
+		return nil, errors.Wrap(
+			errors.InvalidInputError,
+			errors.ErrInvalidInput,
+			fmt.Sprintf("amended order %s is not order %s", amended.OrderID, o.OrderID),
+		)
+	}
+	if amended.Type != o.Type {
+		return nil, errors.ErrCannotChangeOrderType
+	}
+	if amended.OrderBookID != o.OrderBookID ||
+		amended.Side != o.Side ||
+		amended.AssetIn != o.AssetIn ||
+		amended.AssetOut != o.AssetOut {
+		return nil, errors.ErrOrderAmendCannotChangeAssets
+	}
+	if amended.Leverage.Cmp(o.Leverage) != 0 {
+		return nil, errors.ErrOrderAmendCannotChangeLeverage
+	}
+	if amended.Amount <= o.Filled {
+		return nil, errors.Data(
+			"%w: amount %d, filled %d", errors.ErrOrderAmendAmountNotAboveFilled, amended.Amount, o.Filled,
+		)
+	}
+
+	// Validate a copy, so a failed amend leaves the order untouched
+	updated := *o
+	updated.Amount = amended.Amount
+	updated.Price = amended.Price
+	updated.ExpiresAt = amended.ExpiresAt
+	if err := updated.Validate(); err != nil {
+		return nil, err
+	}
+	*o = updated
+	return o.event(o.Status, "", at), nil
+}
+
+// transition moves the order to status to, or returns an error leaving the order unchanged.
+func (o *Order) transition(to OrderStatus, filled uint64, reason string, at time.Time) (*OrderStatusEvent, error) {
+	if !o.Status.CanTransition(to) {
+		return nil, errors.Data("%w: %s to %s", errors.ErrInvalidOrderTransition, o.Status, to)
+	}
+	previous := o.Status
+	o.Status = to
+	o.Filled = filled
+	return o.event(previous, reason, at), nil
+}
+
+func (o *Order) event(previous OrderStatus, reason string, at time.Time) *OrderStatusEvent {
+	o.Sequence++
+	o.UpdatedAt = at.Unix()
+	return &OrderStatusEvent{
+		OrderID:        o.OrderID,
+		UserID:         o.UserID,
+		OrderBookID:    o.OrderBookID,
+		Status:         o.Status,
+		PreviousStatus: previous,
+		Amount:         o.Amount,
+		Filled:         o.Filled,
+		Price:          o.Price,
+		Reason:         reason,
+		Sequence:       o.Sequence,
+		Timestamp:      o.UpdatedAt,
+	}
+}
+
+// OrderStatusEvent is published on the order status topic whenever an order changes.
+type OrderStatusEvent struct {
+	OrderID        string          `json:"order_id"`
+	UserID         string          `json:"user_id"`
+	OrderBookID    string          `json:"order_book_id"`
+	Status         OrderStatus     `json:"status"`
+	PreviousStatus OrderStatus     `json:"previous_status"`
+	Amount         uint64          `json:"amount"`
+	Filled         uint64          `json:"filled"`
+	Price          decimal.Decimal `json:"price"`
+	Reason         string          `json:"reason,omitempty"`
+	// Sequence of the order after the change. Events with a lower sequence are stale.
+	Sequence  uint64 `json:"sequence"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func (e *OrderStatusEvent) MarshalBinary() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (e *OrderStatusEvent) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, e)
+}
@@ -0,0 +1,144 @@
+package orderbook_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/orderbook"
+)
+
+func TestOrder_Lifecycle(t *testing.T) {
+	require := require.New(t)
+	at := time.Date(2024, 8, 12, 20, 0, 0, 0, time.UTC)
+
+	o := orderbook.NewOrder(
+		"order1", "user1", orderbook.Buy, orderbook.Limit, "bond1", "stable1", 100, decimal.MustParse("0.98"), at,
+	)
+	require.Equal("stable1", o.AssetIn)
+	require.Equal("bond1", o.AssetOut)
+	require.Equal(orderbook.StatusNew, o.Status)
+
+	// cannot fill before opening
+	_, err := o.Fill(10, at)
+	require.ErrorIs(err, errors.ErrInvalidOrderTransition)
+
+	ev, err := o.Open(at)
+	require.NoError(err)
+	require.Equal(orderbook.StatusOpen, ev.Status)
+	require.Equal(orderbook.StatusNew, ev.PreviousStatus)
+	require.Equal(uint64(1), ev.Sequence)
+
+	ev, err = o.Fill(40, at.Add(time.Second))
+	require.NoError(err)
+	require.Equal(orderbook.StatusPartiallyFilled, ev.Status)
+	require.Equal(uint64(40), ev.Filled)
+	require.Equal(uint64(60), o.Remaining())
+
+	_, err = o.Fill(61, at.Add(time.Second))
+	require.ErrorIs(err, errors.ErrOrderFillExceedsAmount)
+	require.Equal(uint64(40), o.Filled)
+
+	ev, err = o.Fill(60, at.Add(2*time.Second))
+	require.NoError(err)
+	require.Equal(orderbook.StatusFilled, ev.Status)
+	require.Equal(uint64(3), ev.Sequence)
+	require.True(o.Status.Terminal())
+
+	_, err = o.Cancel("too late", at.Add(3*time.Second))
+	require.ErrorIs(err, errors.ErrInvalidOrderTransition)
+	require.Equal(uint64(3), o.Sequence)
+}
+
+func TestOrder_RejectCancelExpire(t *testing.T) {
+	require := require.New(t)
+	at := time.Date(2024, 8, 12, 20, 0, 0, 0, time.UTC)
+
+	invalid := orderbook.NewOrder("order1", "", orderbook.Sell, orderbook.Market, "bond1", "stable1", 100, decimal.Zero, at)
+	_, err := invalid.Open(at)
+	require.ErrorIs(err, errors.ErrOrderMissingUserID)
+	ev, err := invalid.Reject("missing user", at)
+	require.NoError(err)
+	require.Equal(orderbook.StatusRejected, ev.Status)
+	require.Equal("missing user", ev.Reason)
+
+	o := orderbook.NewOrder("order2", "user1", orderbook.Sell, orderbook.Market, "bond1", "stable1", 100, decimal.Zero, at)
+	_, err = o.Open(at)
+	require.NoError(err)
+	_, err = o.Reject("cannot reject open orders", at)
+	require.ErrorIs(err, errors.ErrInvalidOrderTransition)
+	ev, err = o.Cancel("user request", at)
+	require.NoError(err)
+	require.Equal(orderbook.StatusCancelled, ev.Status)
+
+	o = orderbook.NewOrder("order3", "user1", orderbook.Sell, orderbook.Market, "bond1", "stable1", 100, decimal.Zero, at)
+	o.ExpiresAt = at.Add(time.Hour).Unix()
+	_, err = o.Open(at)
+	require.NoError(err)
+	_, err = o.Expire(at)
+	require.Error(err)
+	ev, err = o.Expire(at.Add(time.Hour))
+	require.NoError(err)
+	require.Equal(orderbook.StatusExpired, ev.Status)
+}
+
+func TestOrder_Amend(t *testing.T) {
+	require := require.New(t)
+	at := time.Date(2024, 8, 12, 20, 0, 0, 0, time.UTC)
+
+	o := orderbook.NewOrder(
+		"order1", "user1", orderbook.Sell, orderbook.Limit, "bond1", "stable1", 100, decimal.MustParse("1.01"), at,
+	)
+	_, err := o.Amend(*o, at)
+	require.ErrorIs(err, errors.ErrInvalidOrderTransition)
+
+	_, err = o.Open(at)
+	require.NoError(err)
+	_, err = o.Fill(30, at)
+	require.NoError(err)
+
+	amended := *o
+	amended.Type = orderbook.Market
+	_, err = o.Amend(amended, at)
+	require.ErrorIs(err, errors.ErrCannotChangeOrderType)
+
+	amended = *o
+	amended.AssetIn, amended.AssetOut = amended.AssetOut, amended.AssetIn
+	_, err = o.Amend(amended, at)
+	require.ErrorIs(err, errors.ErrOrderAmendCannotChangeAssets)
+
+	amended = *o
+	amended.Leverage = decimal.MustParse("2")
+	_, err = o.Amend(amended, at)
+	require.ErrorIs(err, errors.ErrOrderAmendCannotChangeLeverage)
+
+	amended = *o
+	amended.OrderID = "order2"
+	_, err = o.Amend(amended, at)
+	require.ErrorIs(err, errors.ErrInvalidInput)
+
+	amended = *o
+	amended.Amount = 30
+	_, err = o.Amend(amended, at)
+	require.ErrorIs(err, errors.ErrOrderAmendAmountNotAboveFilled)
+
+	amended = *o
+	amended.Price = decimal.Zero
+	_, err = o.Amend(amended, at)
+	require.ErrorIs(err, errors.ErrInvalidLimitPrice)
+	require.Equal(decimal.MustParse("1.01"), o.Price)
+
+	amended = *o
+	amended.Amount = 50
+	amended.Price = decimal.MustParse("1.02")
+	ev, err := o.Amend(amended, at.Add(time.Second))
+	require.NoError(err)
+	require.Equal(orderbook.StatusPartiallyFilled, ev.Status)
+	require.Equal(orderbook.StatusPartiallyFilled, ev.PreviousStatus)
+	require.Equal(uint64(50), ev.Amount)
+	require.Equal(uint64(20), o.Remaining())
+	require.Equal(decimal.MustParse("1.02"), o.Price)
+}
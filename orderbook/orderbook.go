@@ -1,12 +1,11 @@
 package orderbook
 
 import (
-	"fmt"
-	"strings"
+	"github.com/dora-network/dora-service-utils/ledger/types"
 )
 
 func ID(baseID, quoteID string) string {
-	return fmt.Sprintf("%s-%s", baseID, quoteID)
+	return types.NewMarketID(baseID, quoteID).String()
 }
 
 type Side string
@@ -16,18 +15,20 @@ const (
 	Sell Side = "sell"
 )
 
+// GetBaseFromOrderBookID returns the base asset of an order book, or an empty string if the ID is not a valid market.
 func GetBaseFromOrderBookID(orderBookID string) string {
-	assets := strings.Split(orderBookID, "-")
-	if len(assets) != 2 {
+	market, err := types.ParseMarketID(orderBookID)
+	if err != nil {
 		return ""
 	}
-	return assets[0]
+	return market.Base
 }
 
+// GetQuoteFromOrderBookID returns the quote asset of an order book, or an empty string if the ID is not a valid market.
 func GetQuoteFromOrderBookID(orderBookID string) string {
-	assets := strings.Split(orderBookID, "-")
-	if len(assets) != 2 {
+	market, err := types.ParseMarketID(orderBookID)
+	if err != nil {
 		return ""
 	}
-	return assets[1]
+	return market.Quote
 }
@@ -0,0 +1,23 @@
+package orderbook_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/orderbook"
+)
+
+func TestOrderBookID(t *testing.T) {
+	require := require.New(t)
+
+	id := orderbook.ID("Bond_A", "USD")
+	require.Equal("Bond_A-USD", id)
+	require.Equal("Bond_A", orderbook.GetBaseFromOrderBookID(id))
+	require.Equal("USD", orderbook.GetQuoteFromOrderBookID(id))
+
+	for _, invalid := range []string{"Bond_A", "Bond_A-Coupon_123", "Bond_A-USD-EUR", "USD-USD"} {
+		require.Empty(orderbook.GetBaseFromOrderBookID(invalid), invalid)
+		require.Empty(orderbook.GetQuoteFromOrderBookID(invalid), invalid)
+	}
+}
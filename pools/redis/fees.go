@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	redisv9 "github.com/redis/go-redis/v9"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	lredis "github.com/dora-network/dora-service-utils/ledger/redis"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/redis"
+)
+
+// PoolFeeCheckpointsKey is the pool's fee checkpoints, see types.FeeCheckpoints.
+func PoolFeeCheckpointsKey(poolID string) string {
+	return fmt.Sprintf("pools:%s:fee_checkpoints", poolID)
+}
+
+// ClaimFees pays a pool's collected fees to the users who own its shares, atomically, adding each user's part to
+// their Owned balances, see Pool.ClaimFees. Users are only paid the fees collected since they last claimed, which
+// the pool's fee checkpoints record. Fees on shares held by the module, which back supplied shares, stay
+// collected in the pool. Returns the base and quote fees paid to each user. The pool's price is recorded for TWAP
+// at now.
+func ClaimFees(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	poolID string,
+	now time.Time,
+) (map[string][]ltypes.Amount, error) {
+	positionKeys, userIDs, err := getAllUserIDs(ctx, rdb)
+	if err != nil {
+		return nil, err
+	}
+	watch := append(
+		[]string{PoolKey(poolID), PoolTWAPKey(poolID), PoolFeeCheckpointsKey(poolID)},
+		positionKeys...,
+	)
+
+	var claims map[string][]ltypes.Amount
+	txFunc := func(tx *redisv9.Tx) error {
+		pool := new(types.Pool)
+		if err := GetPoolCmd(ctx, tx, poolID).Scan(pool); err != nil {
+			return err
+		}
+		if pool.PoolID == "" {
+			return backoff.Permanent(errors.ErrPoolNotFound)
+		}
+		positions, holders, err := getShareHolders(ctx, tx, poolID, userIDs)
+		if err != nil {
+			return err
+		}
+		checkpoints := new(types.FeeCheckpoints)
+		if err := tx.Get(ctx, PoolFeeCheckpointsKey(poolID)).Scan(checkpoints); err != nil &&
+			!stderrors.Is(err, redisv9.Nil) {
+			return err
+		}
+		previous, err := GetLastPriceObservation(ctx, tx, poolID)
+		if err != nil {
+			return err
+		}
+
+		c, err := pool.ClaimFees(checkpoints, holders)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		modified := make(map[string]*ltypes.Position)
+		for userID, p := range positions {
+			for _, fee := range c[userID] {
+				if fee.IsZero() {
+					continue
+				}
+				p.Owned = p.Owned.AddAmount(fee.AssetID, int64(fee.Amount))
+			}
+			if p.IsModified() {
+				p.LastUpdated = now.Unix()
+				p.UpdateSequence()
+				modified[userID] = p
+			}
+		}
+
+		if _, err = tx.TxPipelined(
+			ctx, func(pipe redisv9.Pipeliner) error {
+				lredis.SetUsersPositionCmd(ctx, pipe, modified)
+				pipe.Set(ctx, PoolFeeCheckpointsKey(poolID), checkpoints, 0)
+				// the reserves do not change, so neither does the pool's price, but observing it keeps the
+				// pool's TWAP as current as its sequence
+				return UpdatePoolBalanceCmd(ctx, pipe, pool, previous, now)
+			},
+		); err != nil {
+			return err
+		}
+		claims = c
+		return nil
+	}
+
+	if err := redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		watch...,
+	); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,219 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	redisv9 "github.com/redis/go-redis/v9"
+
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/redis"
+)
+
+// scanCount is the number of keys BackfillPoolIndex asks each SCAN for.
+const scanCount = 1000
+
+// PoolIndexKey is the set of all pools' IDs.
+func PoolIndexKey() string {
+	return "pool_index:all"
+}
+
+// PoolAssetIndexKey is the set of the IDs of the pools which have an asset as their base or quote.
+func PoolAssetIndexKey(assetID string) string {
+	return fmt.Sprintf("pool_index:asset:%s", assetID)
+}
+
+// PoolKindIndexKey is the set of the IDs of the pools of a kind, such as types.PoolKindProduct.
+func PoolKindIndexKey(kind types.PoolKind) string {
+	return fmt.Sprintf("pool_index:kind:%s", kind)
+}
+
+// PoolMaturityIndexKey is the sorted set of yield pools' IDs, scored by maturity.
+func PoolMaturityIndexKey() string {
+	return "pool_index:maturity"
+}
+
+// IndexPoolCmd queues adding the pool to the pool indexes. Indexing a pool again has no effect, since only
+// fields which never change are indexed.
+func IndexPoolCmd(ctx context.Context, tx redis.Cmdable, pool *types.Pool) {
+	tx.SAdd(ctx, PoolIndexKey(), pool.PoolID)
+	tx.SAdd(ctx, PoolAssetIndexKey(pool.BaseAsset), pool.PoolID)
+	tx.SAdd(ctx, PoolAssetIndexKey(pool.QuoteAsset), pool.PoolID)
+	tx.SAdd(ctx, PoolKindIndexKey(pool.Kind()), pool.PoolID)
+	if pool.Kind() == types.PoolKindYield {
+		tx.ZAdd(ctx, PoolMaturityIndexKey(), redisv9.Z{Score: float64(pool.MaturityAt), Member: pool.PoolID})
+	}
+}
+
+// ListPools returns all pools, sorted by ID.
+func ListPools(ctx context.Context, rdb redis.Client, timeout time.Duration) ([]*types.Pool, error) {
+	return getIndexedPools(ctx, rdb, timeout, []string{PoolIndexKey()}, func(tx redis.Cmdable) ([]string, error) {
+		return tx.SMembers(ctx, PoolIndexKey()).Result()
+	})
+}
+
+// ListPoolsOfKind returns the pools of a kind, such as types.PoolKindProduct, sorted by ID.
+func ListPoolsOfKind(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	kind types.PoolKind,
+) ([]*types.Pool, error) {
+	key := PoolKindIndexKey(kind)
+	return getIndexedPools(ctx, rdb, timeout, []string{key}, func(tx redis.Cmdable) ([]string, error) {
+		return tx.SMembers(ctx, key).Result()
+	})
+}
+
+// PoolsForAsset returns the pools which have an asset as their base or quote, sorted by ID.
+func PoolsForAsset(ctx context.Context, rdb redis.Client, timeout time.Duration, assetID string) ([]*types.Pool, error) {
+	key := PoolAssetIndexKey(assetID)
+	return getIndexedPools(ctx, rdb, timeout, []string{key}, func(tx redis.Cmdable) ([]string, error) {
+		return tx.SMembers(ctx, key).Result()
+	})
+}
+
+// PoolsForPair returns the pools between two assets, either way round, sorted by ID.
+func PoolsForPair(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	assetA, assetB string,
+) ([]*types.Pool, error) {
+	keys := []string{PoolAssetIndexKey(assetA), PoolAssetIndexKey(assetB)}
+	return getIndexedPools(ctx, rdb, timeout, keys, func(tx redis.Cmdable) ([]string, error) {
+		return tx.SInter(ctx, keys...).Result()
+	})
+}
+
+// PoolsMaturingBefore returns the yield pools which mature before a time, sorted by maturity.
+func PoolsMaturingBefore(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	before time.Time,
+) ([]*types.Pool, error) {
+	key := PoolMaturityIndexKey()
+	pools, err := getIndexedPools(ctx, rdb, timeout, []string{key}, func(tx redis.Cmdable) ([]string, error) {
+		return tx.ZRangeByScore(
+			ctx, key, &redisv9.ZRangeBy{Min: "-inf", Max: "(" + strconv.FormatInt(before.Unix(), 10)},
+		).Result()
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(pools, func(i, j int) bool { return pools[i].MaturityAt < pools[j].MaturityAt })
+	return pools, nil
+}
+
+// BackfillPoolIndex adds all pools stored in Redis to the pool indexes, for pools created before the indexes
+// existed. Pools are found with SCAN, so Redis is not blocked while they are listed. It is safe to run more than
+// once, and while pools are being created. Returns the number of pools indexed.
+func BackfillPoolIndex(ctx context.Context, rdb redis.Client, timeout time.Duration) (int, error) {
+	var poolIDs []string
+	seen := make(map[string]bool)
+	iter := rdb.Scan(ctx, 0, PoolKey("*"), scanCount).Iterator()
+	for iter.Next(ctx) {
+		// other keys, such as PoolTWAPKey, share the pools prefix, and SCAN may return a key more than once
+		poolID := strings.TrimPrefix(iter.Val(), PoolKey(""))
+		if !strings.Contains(poolID, ":") && !seen[poolID] {
+			seen[poolID] = true
+			poolIDs = append(poolIDs, poolID)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, err
+	}
+
+	indexed := 0
+	for _, poolID := range poolIDs {
+		txFunc := func(tx *redisv9.Tx) error {
+			pool := new(types.Pool)
+			if err := GetPoolCmd(ctx, tx, poolID).Scan(pool); err != nil {
+				return err
+			}
+			if pool.PoolID == "" {
+				// deleted since the keys were listed
+				return nil
+			}
+			if _, err := tx.TxPipelined(
+				ctx, func(pipe redisv9.Pipeliner) error {
+					IndexPoolCmd(ctx, pipe, pool)
+					return nil
+				},
+			); err != nil {
+				return err
+			}
+			indexed++
+			return nil
+		}
+		if err := redis.TryTransaction(
+			ctx,
+			rdb,
+			txFunc,
+			backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+			PoolKey(poolID),
+		); err != nil {
+			return indexed, err
+		}
+	}
+	return indexed, nil
+}
+
+// getIndexedPools reads pool IDs from an index, and then the pools, in one transaction watching the index keys.
+// Pools are returned sorted by ID; IDs of pools which no longer exist are skipped.
+func getIndexedPools(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	watch []string,
+	getIDs func(tx redis.Cmdable) ([]string, error),
+) ([]*types.Pool, error) {
+	var pools []*types.Pool
+	txFunc := func(tx *redisv9.Tx) error {
+		poolIDs, err := getIDs(tx)
+		if err != nil {
+			return err
+		}
+		sort.Strings(poolIDs)
+		cmds := make([]*redisv9.SliceCmd, len(poolIDs))
+		if _, err = tx.Pipelined(
+			ctx, func(pipe redisv9.Pipeliner) error {
+				for i, poolID := range poolIDs {
+					cmds[i] = GetPoolCmd(ctx, pipe, poolID)
+				}
+				return nil
+			},
+		); err != nil {
+			return err
+		}
+		pools = make([]*types.Pool, 0, len(poolIDs))
+		for _, cmd := range cmds {
+			pool := new(types.Pool)
+			if err := cmd.Scan(pool); err != nil {
+				return err
+			}
+			if pool.PoolID != "" {
+				pools = append(pools, pool)
+			}
+		}
+		return nil
+	}
+
+	if err := redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		watch...,
+	); err != nil {
+		return nil, err
+	}
+
+	return pools, nil
+}
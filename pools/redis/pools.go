@@ -2,11 +2,13 @@ package redis
 
 import (
 	"context"
-	"errors"
+	stderrors "errors"
 	"fmt"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/dora-network/dora-service-utils/clock"
+	"github.com/dora-network/dora-service-utils/errors"
 	"github.com/dora-network/dora-service-utils/orderbook"
 	"github.com/dora-network/dora-service-utils/pools/types"
 	"github.com/dora-network/dora-service-utils/redis"
@@ -29,12 +31,38 @@ var poolKeys = []string{
 	"initial_assets_ratio",
 	"display_name",
 	"sequence",
+	"settled_at",
+	"pool_kind",
+	"weight_base",
+	"amplification",
 }
 
 func PoolKey(poolID string) string {
 	return fmt.Sprintf("pools:%s", poolID)
 }
 
+// PoolOption configures writing pools.
+type PoolOption func(config *poolConfig)
+
+type poolConfig struct {
+	clock clock.Clock
+}
+
+func newPoolConfig(opts ...PoolOption) poolConfig {
+	config := poolConfig{clock: clock.System}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// WithClock records pools' prices, and executes swaps, at the time told by c, rather than the system time.
+func WithClock(c clock.Clock) PoolOption {
+	return func(config *poolConfig) {
+		config.clock = clock.OrSystem(c)
+	}
+}
+
 func GetPools(ctx context.Context, rdb redis.Client, timeout time.Duration, poolIDs []string) ([]*types.Pool, error) {
 	pools := make([]*types.Pool, 0)
 	watch := make([]string, 0)
@@ -86,7 +114,7 @@ func GetPool(ctx context.Context, rdb redis.Client, timeout time.Duration, poolI
 	f := func(tx *redisv9.Tx) error {
 		err := tx.HMGet(ctx, watch, poolKeys...).Scan(pool)
 		if err != nil {
-			if errors.Is(err, redisv9.Nil) {
+			if stderrors.Is(err, redisv9.Nil) {
 				return nil
 			}
 			return err
@@ -130,31 +158,32 @@ func GetPoolCmd(ctx context.Context, tx redis.Cmdable, poolID string) *redisv9.S
 	return tx.HMGet(ctx, watch, poolKeys...)
 }
 
-func UpdatePool(ctx context.Context, rdb redis.Client, pool *types.Pool, timeout time.Duration, poolID string) error {
+// UpdatePool writes the pool, records its price for TWAP, and adds it to the pool indexes, see IndexPoolCmd. The
+// pool is written under its own ID, which poolID must be.
+func UpdatePool(
+	ctx context.Context,
+	rdb redis.Client,
+	pool *types.Pool,
+	timeout time.Duration,
+	poolID string,
+	opts ...PoolOption,
+) error {
+	if pool.PoolID != poolID {
+		return errors.Data("UpdatePool: pool %s is not pool %s", pool.PoolID, poolID)
+	}
+	config := newPoolConfig(opts...)
 	txFunc := func(tx *redisv9.Tx) error {
-		return tx.HSet(
-			ctx, PoolKey(poolID),
-			// We have to set each field individually rather than just passing the struct
-			// which would be easier, because when serializing the struct, go-redis uses the
-			// MarshalBinary method for the decimal.Decimal type (fee factor), but when
-			// deserializing, it uses UnmarshalText which is expecting a number expressed
-			// as a string. This causes the deserialization to fail
-			"pool_id", pool.PoolID,
-			"base_asset", pool.BaseAsset,
-			"quote_asset", pool.QuoteAsset,
-			"is_product_pool", pool.IsProductPool,
-			"amount_shares", pool.AmountShares,
-			"amount_base", pool.AmountBase,
-			"amount_quote", pool.AmountQuote,
-			"fee_factor", pool.FeeFactor.String(),
-			"created_at", pool.CreatedAt,
-			"maturity_at", pool.MaturityAt,
-			"fees_collected_base", pool.FeesCollectedBase,
-			"fees_collected_quote", pool.FeesCollectedQuote,
-			"initial_assets_ratio", pool.InitialAssetsRatio.String(),
-			"display_name", pool.DisplayName,
-			"sequence", pool.Sequence,
-		).Err()
+		previous, err := GetLastPriceObservation(ctx, tx, poolID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(
+			ctx, func(pipe redisv9.Pipeliner) error {
+				IndexPoolCmd(ctx, pipe, pool)
+				return UpdatePoolCmd(ctx, pipe, pool, previous, config.clock.Now())
+			},
+		)
+		return err
 	}
 
 	return redis.TryTransaction(
@@ -163,15 +192,20 @@ func UpdatePool(ctx context.Context, rdb redis.Client, pool *types.Pool, timeout
 		txFunc,
 		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
 		PoolKey(poolID),
+		PoolTWAPKey(poolID),
 	)
 }
 
+// UpdatePoolCmd queues writing the pool, and recording its price at a specific time for TWAP, following its
+// previous observation, see RecordPriceCmd.
 func UpdatePoolCmd(
 	ctx context.Context,
 	tx redis.Cmdable,
 	pool *types.Pool,
-) *redisv9.IntCmd {
-	return tx.HSet(
+	previous *types.PriceObservation,
+	now time.Time,
+) error {
+	tx.HSet(
 		ctx, PoolKey(pool.PoolID),
 		// We have to set each field individually rather than just passing the struct
 		// which would be easier, because when serializing the struct, go-redis uses the
@@ -193,30 +227,53 @@ func UpdatePoolCmd(
 		"initial_assets_ratio", pool.InitialAssetsRatio.String(),
 		"display_name", pool.DisplayName,
 		"sequence", pool.Sequence,
+		"settled_at", pool.SettledAt,
+		"pool_kind", string(pool.PoolKind),
+		"weight_base", pool.WeightBase.String(),
+		"amplification", pool.Amplification,
 	)
+	return RecordPriceCmd(ctx, tx, pool, previous, now)
 }
 
+// UpdatePoolBalance writes the pool's amounts, and records its price for TWAP.
 func UpdatePoolBalance(
 	ctx context.Context,
 	rdb redis.Client,
 	poolID string, amountShares, amountBase, amountQuote, feesCollectedBase, feesCollectedQuote, sequence uint64,
 	timeout time.Duration,
+	opts ...PoolOption,
 ) error {
+	config := newPoolConfig(opts...)
 	txFunc := func(tx *redisv9.Tx) error {
-		return tx.HSet(
-			ctx, PoolKey(poolID),
-			// We have to set each field individually rather than just passing the struct
-			// which would be easier, because when serializing the struct, go-redis uses the
-			// MarshalBinary method for the decimal.Decimal type (fee factor), but when
-			// deserializing, it uses UnmarshalText which is expecting a number expressed
-			// as a string. This causes the deserialization to fail
-			"amount_shares", amountShares,
-			"amount_base", amountBase,
-			"amount_quote", amountQuote,
-			"fees_collected_base", feesCollectedBase,
-			"fees_collected_quote", feesCollectedQuote,
-			"sequence", sequence,
-		).Err()
+		// the whole pool is needed to price it
+		pool := new(types.Pool)
+		if err := GetPoolCmd(ctx, tx, poolID).Scan(pool); err != nil {
+			return err
+		}
+		previous, err := GetLastPriceObservation(ctx, tx, poolID)
+		if err != nil {
+			return err
+		}
+		// balances written before the pool itself are written under poolID, but cannot be priced
+		priced := pool.PoolID != ""
+		pool.PoolID = poolID
+		pool.AmountShares = amountShares
+		pool.AmountBase = amountBase
+		pool.AmountQuote = amountQuote
+		pool.FeesCollectedBase = feesCollectedBase
+		pool.FeesCollectedQuote = feesCollectedQuote
+		pool.Sequence = sequence
+
+		_, err = tx.TxPipelined(
+			ctx, func(pipe redisv9.Pipeliner) error {
+				if !priced {
+					writePoolBalanceCmd(ctx, pipe, pool)
+					return nil
+				}
+				return UpdatePoolBalanceCmd(ctx, pipe, pool, previous, config.clock.Now())
+			},
+		)
+		return err
 	}
 
 	return redis.TryTransaction(
@@ -225,33 +282,70 @@ func UpdatePoolBalance(
 		txFunc,
 		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
 		PoolKey(poolID),
+		PoolTWAPKey(poolID),
 	)
 }
 
+// UpdatePoolBalanceCmd queues writing the pool's amounts and sequence, and recording its price at a specific time
+// for TWAP, following its previous observation, see RecordPriceCmd. The pool's other fields are not written.
 func UpdatePoolBalanceCmd(
 	ctx context.Context,
 	tx redis.Cmdable,
-	poolID string,
-	amountShares, amountBase, amountQuote, feesCollectedBase, feesCollectedQuote, sequence uint64,
-) *redisv9.IntCmd {
+	pool *types.Pool,
+	previous *types.PriceObservation,
+	now time.Time,
+) error {
+	writePoolBalanceCmd(ctx, tx, pool)
+	return RecordPriceCmd(ctx, tx, pool, previous, now)
+}
+
+func writePoolBalanceCmd(ctx context.Context, tx redis.Cmdable, pool *types.Pool) *redisv9.IntCmd {
 	return tx.HSet(
-		ctx, PoolKey(poolID),
+		ctx, PoolKey(pool.PoolID),
 		// We have to set each field individually rather than just passing the struct
 		// which would be easier, because when serializing the struct, go-redis uses the
 		// MarshalBinary method for the decimal.Decimal type (fee factor), but when
 		// deserializing, it uses UnmarshalText which is expecting a number expressed
 		// as a string. This causes the deserialization to fail
-		"amount_shares", amountShares,
-		"amount_base", amountBase,
-		"amount_quote", amountQuote,
-		"fees_collected_base", feesCollectedBase,
-		"fees_collected_quote", feesCollectedQuote,
-		"sequence", sequence,
+		"amount_shares", pool.AmountShares,
+		"amount_base", pool.AmountBase,
+		"amount_quote", pool.AmountQuote,
+		"fees_collected_base", pool.FeesCollectedBase,
+		"fees_collected_quote", pool.FeesCollectedQuote,
+		"sequence", pool.Sequence,
 	)
 }
 
-func CreatePool(ctx context.Context, rdb redis.Client, pool *types.Pool, timeout time.Duration) error {
+// CreatePool writes the pool, records its price for TWAP, and adds it to the pool indexes, see IndexPoolCmd.
+// Error if the pool is invalid, see types.Pool.Validate.
+func CreatePool(ctx context.Context, rdb redis.Client, pool *types.Pool, timeout time.Duration, opts ...PoolOption) error {
+	config := newPoolConfig(opts...)
 	poolID := orderbook.ID(pool.BaseAsset, pool.QuoteAsset)
 	pool.PoolID = poolID
-	return UpdatePool(ctx, rdb, pool, timeout, poolID)
+	if err := pool.Validate(); err != nil {
+		return err
+	}
+
+	txFunc := func(tx *redisv9.Tx) error {
+		previous, err := GetLastPriceObservation(ctx, tx, poolID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(
+			ctx, func(pipe redisv9.Pipeliner) error {
+				IndexPoolCmd(ctx, pipe, pool)
+				return UpdatePoolCmd(ctx, pipe, pool, previous, config.clock.Now())
+			},
+		)
+		return err
+	}
+
+	return redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		PoolKey(poolID),
+		PoolTWAPKey(poolID),
+	)
 }
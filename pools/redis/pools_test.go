@@ -5,6 +5,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/helpers"
+	lredis "github.com/dora-network/dora-service-utils/ledger/redis"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
 	"github.com/dora-network/dora-service-utils/pools/redis"
 
 	"github.com/dora-network/dora-service-utils/orderbook"
@@ -13,7 +17,9 @@ import (
 	"github.com/dora-network/dora-service-utils/pools/types"
 	"github.com/govalues/decimal"
 
+	"github.com/dora-network/dora-service-utils/testing/fakeclock"
 	"github.com/dora-network/dora-service-utils/testing/integration"
+	redisv9 "github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/require"
 )
 
@@ -237,4 +243,462 @@ func TestPools(t *testing.T) {
 			assert.Equal(tt, initial.DisplayName, got.DisplayName)
 		},
 	)
+
+	t.Run(
+		"Should execute a swap against the expected pool sequence", func(tt *testing.T) {
+			pool := types.Pool{
+				PoolID:        "swapbase-swapquote",
+				BaseAsset:     "swapbase",
+				QuoteAsset:    "swapquote",
+				IsProductPool: true,
+				AmountShares:  2000000,
+				AmountBase:    1000000,
+				AmountQuote:   1000000,
+				FeeFactor:     decimal.MustNew(1, 2),
+				Sequence:      5,
+			}
+			require.NoError(tt, redis.CreatePool(ctx, rdb, &pool, time.Second))
+
+			in := ltypes.NewBalance("swapbase", int64(1000))
+			_, err := redis.ExecuteSwap(ctx, rdb, time.Second, pool.PoolID, 4, in, nil, time.Time{})
+			require.ErrorIs(tt, err, errors.ErrPoolSequenceMismatch)
+
+			receipt, err := redis.ExecuteSwap(ctx, rdb, time.Second, pool.PoolID, 5, in, nil, time.Time{})
+			require.NoError(tt, err)
+			require.Equal(tt, uint64(6), receipt.Sequence)
+
+			got, err := redis.GetPool(ctx, rdb, time.Second, pool.PoolID)
+			require.NoError(tt, err)
+			assert.Equal(tt, uint64(6), got.Sequence)
+			assert.Equal(tt, pool.AmountBase+in.Amount-receipt.Fee.Amount, got.AmountBase)
+			assert.Equal(tt, pool.AmountQuote-receipt.AmountOut.Amount, got.AmountQuote)
+			assert.Equal(tt, receipt.Fee.Amount, got.FeesCollectedBase)
+		},
+	)
+
+	t.Run(
+		"Should report pools whose shares differ from the shares held by users", func(tt *testing.T) {
+			balanced := types.Pool{
+				BaseAsset:     "recbase",
+				QuoteAsset:    "recquote",
+				IsProductPool: true,
+				AmountShares:  1000,
+				AmountBase:    500,
+				AmountQuote:   500,
+				FeeFactor:     decimal.MustNew(1, 2),
+			}
+			require.NoError(tt, redis.CreatePool(ctx, rdb, &balanced, time.Second))
+			unbalanced := types.Pool{
+				BaseAsset:     "recbase2",
+				QuoteAsset:    "recquote2",
+				IsProductPool: true,
+				AmountShares:  1000,
+				AmountBase:    500,
+				AmountQuote:   500,
+				FeeFactor:     decimal.MustNew(1, 2),
+			}
+			require.NoError(tt, redis.CreatePool(ctx, rdb, &unbalanced, time.Second))
+
+			user1 := ltypes.InitialPosition("rec-user1")
+			user1.Owned = ltypes.NewBalances(balanced.PoolID, 600).AddAmount(unbalanced.PoolID, 999)
+			user1.Supplied = ltypes.NewBalances(balanced.PoolID, 300)
+			user2 := ltypes.InitialPosition("rec-user2")
+			user2.Owned = ltypes.NewBalances(balanced.PoolID, 100)
+			require.NoError(
+				tt,
+				lredis.SetUsersPosition(
+					ctx,
+					rdb,
+					time.Second,
+					map[string]*ltypes.Position{user1.UserID: user1, user2.UserID: user2},
+				),
+			)
+
+			report, err := redis.ReconcilePools(
+				ctx,
+				rdb,
+				time.Second,
+				[]string{balanced.PoolID, unbalanced.PoolID, "missing-pool"},
+				time.Now(),
+			)
+			require.NoError(tt, err)
+			assert.False(tt, report.OK())
+			assert.Equal(tt, 3, report.Pools)
+			assert.Equal(tt, 2, report.Users)
+			assert.Equal(tt, []string{"missing-pool"}, report.MissingPools)
+			assert.Empty(tt, report.Violations)
+			assert.Equal(
+				tt,
+				[]redis.PoolShareDiscrepancy{{PoolID: unbalanced.PoolID, PoolShares: 1000, OwnedShares: 999}},
+				report.Discrepancies,
+			)
+		},
+	)
+
+	t.Run(
+		"Should record pool prices for TWAP", func(tt *testing.T) {
+			pool := types.Pool{
+				BaseAsset:     "twapbase",
+				QuoteAsset:    "twapquote",
+				IsProductPool: true,
+				AmountShares:  2000000,
+				AmountBase:    1000000,
+				AmountQuote:   1000000,
+				FeeFactor:     decimal.MustNew(1, 2),
+			}
+			clk := fakeclock.New(time.Unix(1_700_000_000, 0))
+			require.NoError(tt, redis.CreatePool(ctx, rdb, &pool, time.Second, redis.WithClock(clk)))
+
+			clk.Advance(10 * time.Second)
+			in := ltypes.NewBalance("twapquote", int64(100000))
+			_, err := redis.ExecuteSwap(
+				ctx, rdb, time.Second, pool.PoolID, 0, in, nil, time.Time{}, redis.WithClock(clk),
+			)
+			require.NoError(tt, err)
+			// claiming fees observes the pool too, at the time it is told
+			_, err = redis.ClaimFees(ctx, rdb, time.Second, pool.PoolID, clk.Now().Add(10*time.Second))
+			require.NoError(tt, err)
+
+			got, err := redis.GetPool(ctx, rdb, time.Second, pool.PoolID)
+			require.NoError(tt, err)
+			price, err := got.Price()
+			require.NoError(tt, err)
+
+			observations, err := redis.GetPriceObservations(ctx, rdb, time.Second, pool.PoolID)
+			require.NoError(tt, err)
+			require.Len(tt, observations, 3)
+			for i, o := range observations {
+				assert.Equal(tt, int64(1_700_000_000+10*i), o.Time)
+			}
+			last := observations[len(observations)-1]
+			assert.Equal(tt, price, last.Price)
+
+			// the last price holds until the pool changes again
+			at := time.Unix(last.Time, 0).Add(time.Minute)
+			twap, err := redis.TWAPAt(ctx, rdb, time.Second, pool.PoolID, 30*time.Second, at)
+			require.NoError(tt, err)
+			assert.InDelta(tt, price, twap, 1e-12)
+
+			_, err = redis.TWAPAt(ctx, rdb, time.Second, pool.PoolID, time.Hour, at)
+			require.ErrorIs(tt, err, errors.ErrNotEnoughPriceHistory)
+		},
+	)
+
+	t.Run(
+		"Should record pool prices when queueing pool writes", func(tt *testing.T) {
+			pool := types.Pool{
+				PoolID:        "cmdbase-cmdquote",
+				BaseAsset:     "cmdbase",
+				QuoteAsset:    "cmdquote",
+				IsProductPool: true,
+				AmountShares:  2000000,
+				AmountBase:    1000000,
+				AmountQuote:   1000000,
+				FeeFactor:     decimal.MustNew(1, 2),
+			}
+			now := time.Unix(1_700_000_000, 0)
+			_, err := rdb.TxPipelined(
+				ctx, func(pipe redisv9.Pipeliner) error {
+					return redis.UpdatePoolCmd(ctx, pipe, &pool, nil, now)
+				},
+			)
+			require.NoError(tt, err)
+
+			previous, err := redis.GetLastPriceObservation(ctx, rdb, pool.PoolID)
+			require.NoError(tt, err)
+			require.NotNil(tt, previous)
+			pool.AmountBase = 900000
+			pool.AmountQuote = 1100000
+			pool.Sequence++
+			_, err = rdb.TxPipelined(
+				ctx, func(pipe redisv9.Pipeliner) error {
+					return redis.UpdatePoolBalanceCmd(ctx, pipe, &pool, previous, now.Add(time.Second))
+				},
+			)
+			require.NoError(tt, err)
+
+			observations, err := redis.GetPriceObservations(ctx, rdb, time.Second, pool.PoolID)
+			require.NoError(tt, err)
+			require.Len(tt, observations, 2)
+			price, err := pool.PriceAt(now)
+			require.NoError(tt, err)
+			assert.Equal(tt, price, observations[1].Price)
+
+			// an empty pool has no price, and is written without being observed
+			pool.AmountBase, pool.AmountQuote = 0, 0
+			pool.Sequence++
+			_, err = rdb.TxPipelined(
+				ctx, func(pipe redisv9.Pipeliner) error {
+					return redis.UpdatePoolBalanceCmd(ctx, pipe, &pool, &observations[1], now.Add(2*time.Second))
+				},
+			)
+			require.NoError(tt, err)
+			observations, err = redis.GetPriceObservations(ctx, rdb, time.Second, pool.PoolID)
+			require.NoError(tt, err)
+			require.Len(tt, observations, 2)
+
+			require.Error(tt, redis.UpdatePool(ctx, rdb, &pool, time.Second, "other-pool"))
+		},
+	)
+
+	t.Run(
+		"Should settle a yield pool at maturity and pay its share holders", func(tt *testing.T) {
+			now := time.Now()
+			pool := types.Pool{
+				BaseAsset:    "settlebond",
+				QuoteAsset:   "settleusd",
+				AmountShares: 2000,
+				AmountBase:   1000,
+				AmountQuote:  1000,
+				FeeFactor:    decimal.MustNew(1, 2),
+				CreatedAt:    now.Add(-time.Hour).Unix(),
+				MaturityAt:   now.Unix(),
+			}
+			require.NoError(tt, redis.CreatePool(ctx, rdb, &pool, time.Second))
+
+			var ad helpers.AssetData
+			require.NoError(tt, ad.RegisterAsset("settlebond", 0, 0, 0, false, true, true, false, false, false,
+				[]*helpers.Coupon{{Date: now.UTC().Format(time.RFC1123), Yield: 1.5, IsMaturity: true}}))
+			require.NoError(tt, ad.RegisterAsset("settleusd", 0, 0, 0, true, false, true, false, false, false, nil))
+
+			holder := ltypes.InitialPosition("settle-user")
+			holder.Owned = ltypes.NewBalances(pool.PoolID, 1500)
+			// locked shares are released, so they can be redeemed
+			holder.Locked = ltypes.NewBalances(pool.PoolID, 300)
+			// the rest of the shares are supplied to the module
+			supplier := ltypes.InitialPosition("settle-supplier")
+			supplier.Supplied = ltypes.NewBalances(pool.PoolID, 500)
+			require.NoError(
+				tt,
+				lredis.SetUsersPosition(
+					ctx, rdb, time.Second,
+					map[string]*ltypes.Position{holder.UserID: holder, supplier.UserID: supplier},
+				),
+			)
+			module, err := lredis.GetModulePosition(ctx, rdb, time.Second)
+			require.NoError(tt, err)
+			if module == nil {
+				module = ltypes.InitialModule()
+			}
+			module.Balance = module.Balance.AddAmount(pool.PoolID, 500)
+			module.Supplied = module.Supplied.AddAmount(pool.PoolID, 500)
+			require.NoError(tt, lredis.SetModulePosition(ctx, rdb, time.Second, module))
+
+			settlement, err := redis.SettlePool(ctx, rdb, time.Second, pool.PoolID, ad, now)
+			require.NoError(tt, err)
+			assert.Equal(tt, ltypes.NewAmount("settleusd", 1500), settlement.Redemption)
+			assert.Equal(tt, ltypes.NewAmount("settleusd", 2500), settlement.Proceeds)
+			assert.Equal(tt, ltypes.NewAmount("settleusd", 1875), settlement.Payouts[holder.UserID])
+			assert.Equal(tt, ltypes.NewAmount("settleusd", 625), settlement.ModulePayout)
+
+			got, err := redis.GetPool(ctx, rdb, time.Second, pool.PoolID)
+			require.NoError(tt, err)
+			assert.Equal(tt, now.Unix(), got.SettledAt)
+			assert.Equal(tt, uint64(0), got.AmountBase)
+			assert.Equal(tt, uint64(0), got.AmountQuote)
+			assert.Equal(tt, uint64(0), got.AmountShares)
+
+			module, err = lredis.GetModulePosition(ctx, rdb, time.Second)
+			require.NoError(tt, err)
+			assert.Equal(tt, int64(0), module.Balance.AmountOf(pool.PoolID))
+			assert.Equal(tt, int64(625), module.Balance.AmountOf("settleusd"))
+			assert.Equal(tt, int64(625), module.Supplied.AmountOf("settleusd"))
+			positions, err := lredis.GetUsersPosition(ctx, rdb, time.Second, supplier.UserID)
+			require.NoError(tt, err)
+			assert.Equal(tt, int64(0), positions[supplier.UserID].Supplied.AmountOf(pool.PoolID))
+			assert.Equal(tt, int64(625), positions[supplier.UserID].Supplied.AmountOf("settleusd"))
+
+			positions, err = lredis.GetUsersPosition(ctx, rdb, time.Second, holder.UserID)
+			require.NoError(tt, err)
+			assert.Equal(tt, int64(0), positions[holder.UserID].Owned.AmountOf(pool.PoolID))
+			assert.Equal(tt, int64(0), positions[holder.UserID].Locked.AmountOf(pool.PoolID))
+			assert.Equal(tt, int64(1875), positions[holder.UserID].Owned.AmountOf("settleusd"))
+
+			// the redemptions are journaled with the module's lending
+			entries, err := lredis.ReadJournal(ctx, rdb, "-", 1000)
+			require.NoError(tt, err)
+			require.NotEmpty(tt, entries)
+			entry := entries[len(entries)-1]
+			assert.Equal(tt, types.SettlementReason, entry.Reason)
+			assert.Contains(
+				tt,
+				entry.Postings,
+				ltypes.Posting{UserID: holder.UserID, Account: ltypes.AccountOwned, AssetID: pool.PoolID, Amount: -1500},
+			)
+			assert.Contains(
+				tt,
+				entry.Postings,
+				ltypes.Posting{UserID: holder.UserID, Account: ltypes.AccountOwned, AssetID: "settleusd", Amount: 1875},
+			)
+			assert.Contains(
+				tt,
+				entry.Postings,
+				ltypes.Posting{Account: ltypes.AccountModuleBalance, AssetID: "settleusd", Amount: 625},
+			)
+
+			_, err = redis.SettlePool(ctx, rdb, time.Second, pool.PoolID, ad, now)
+			require.ErrorIs(tt, err, errors.ErrPoolSettled)
+		},
+	)
+
+	t.Run(
+		"Should pay collected fees to share holders", func(tt *testing.T) {
+			pool := types.Pool{
+				BaseAsset:          "feebase",
+				QuoteAsset:         "feequote",
+				IsProductPool:      true,
+				AmountShares:       2000,
+				AmountBase:         1000,
+				AmountQuote:        1000,
+				FeeFactor:          decimal.MustNew(1, 2),
+				FeesCollectedBase:  100,
+				FeesCollectedQuote: 40,
+			}
+			require.NoError(tt, redis.CreatePool(ctx, rdb, &pool, time.Second))
+
+			holder := ltypes.InitialPosition("fee-user")
+			holder.Owned = ltypes.NewBalances(pool.PoolID, 1000)
+			require.NoError(
+				tt,
+				lredis.SetUsersPosition(ctx, rdb, time.Second, map[string]*ltypes.Position{holder.UserID: holder}),
+			)
+
+			claims, err := redis.ClaimFees(ctx, rdb, time.Second, pool.PoolID, time.Now())
+			require.NoError(tt, err)
+			assert.Equal(
+				tt,
+				[]ltypes.Amount{ltypes.NewAmount("feebase", 50), ltypes.NewAmount("feequote", 20)},
+				claims[holder.UserID],
+			)
+
+			got, err := redis.GetPool(ctx, rdb, time.Second, pool.PoolID)
+			require.NoError(tt, err)
+			assert.Equal(tt, uint64(50), got.FeesCollectedBase)
+			assert.Equal(tt, uint64(20), got.FeesCollectedQuote)
+
+			positions, err := lredis.GetUsersPosition(ctx, rdb, time.Second, holder.UserID)
+			require.NoError(tt, err)
+			assert.Equal(tt, int64(1000), positions[holder.UserID].Owned.AmountOf(pool.PoolID))
+			assert.Equal(tt, int64(50), positions[holder.UserID].Owned.AmountOf("feebase"))
+			assert.Equal(tt, int64(20), positions[holder.UserID].Owned.AmountOf("feequote"))
+
+			// claiming again pays nothing, and the fees on the other shares stay collected
+			claims, err = redis.ClaimFees(ctx, rdb, time.Second, pool.PoolID, time.Now())
+			require.NoError(tt, err)
+			assert.Equal(
+				tt,
+				[]ltypes.Amount{ltypes.NewAmount("feebase", 0), ltypes.NewAmount("feequote", 0)},
+				claims[holder.UserID],
+			)
+			got, err = redis.GetPool(ctx, rdb, time.Second, pool.PoolID)
+			require.NoError(tt, err)
+			assert.Equal(tt, uint64(50), got.FeesCollectedBase)
+			assert.Equal(tt, uint64(20), got.FeesCollectedQuote)
+		},
+	)
+
+	t.Run(
+		"Should index pools and backfill the index", func(tt *testing.T) {
+			now := time.Now()
+			product := types.Pool{
+				BaseAsset:     "idxa",
+				QuoteAsset:    "idxusd",
+				IsProductPool: true,
+				AmountShares:  2000,
+				AmountBase:    1000,
+				AmountQuote:   1000,
+				FeeFactor:     decimal.MustNew(1, 2),
+			}
+			require.NoError(tt, redis.CreatePool(ctx, rdb, &product, time.Second))
+			yield := types.Pool{
+				BaseAsset:    "idxbond",
+				QuoteAsset:   "idxusd",
+				AmountShares: 2000,
+				AmountBase:   1000,
+				AmountQuote:  1000,
+				FeeFactor:    decimal.MustNew(102, 2),
+				CreatedAt:    now.Unix(),
+				MaturityAt:   now.Add(time.Hour).Unix(),
+			}
+			require.NoError(tt, redis.CreatePool(ctx, rdb, &yield, time.Second))
+			// pools with parameters invalid for their kind are not created
+			weighted := types.Pool{
+				BaseAsset:  "idxw",
+				QuoteAsset: "idxusd",
+				PoolKind:   types.PoolKindWeighted,
+				WeightBase: decimal.One,
+				FeeFactor:  decimal.MustNew(1, 2),
+			}
+			require.Error(tt, redis.CreatePool(ctx, rdb, &weighted, time.Second))
+
+			ids := func(pools []*types.Pool) []string {
+				var ids []string
+				for _, p := range pools {
+					ids = append(ids, p.PoolID)
+				}
+				return ids
+			}
+
+			pools, err := redis.PoolsForAsset(ctx, rdb, time.Second, "idxusd")
+			require.NoError(tt, err)
+			assert.Equal(tt, []string{product.PoolID, yield.PoolID}, ids(pools))
+			assert.Equal(tt, product, *pools[0])
+
+			pools, err = redis.PoolsForPair(ctx, rdb, time.Second, "idxusd", "idxbond")
+			require.NoError(tt, err)
+			assert.Equal(tt, []string{yield.PoolID}, ids(pools))
+
+			pools, err = redis.ListPools(ctx, rdb, time.Second)
+			require.NoError(tt, err)
+			assert.Subset(tt, ids(pools), []string{product.PoolID, yield.PoolID})
+
+			pools, err = redis.ListPoolsOfKind(ctx, rdb, time.Second, types.PoolKindYield)
+			require.NoError(tt, err)
+			assert.Contains(tt, ids(pools), yield.PoolID)
+			assert.NotContains(tt, ids(pools), product.PoolID)
+
+			pools, err = redis.PoolsMaturingBefore(ctx, rdb, time.Second, time.Unix(yield.MaturityAt, 0))
+			require.NoError(tt, err)
+			assert.NotContains(tt, ids(pools), yield.PoolID)
+			pools, err = redis.PoolsMaturingBefore(ctx, rdb, time.Second, time.Unix(yield.MaturityAt+1, 0))
+			require.NoError(tt, err)
+			assert.Contains(tt, ids(pools), yield.PoolID)
+
+			// pools written without CreatePool or UpdatePool are only indexed by the backfill
+			legacy := types.Pool{
+				PoolID:        orderbook.ID("idxlegacy", "idxusd"),
+				BaseAsset:     "idxlegacy",
+				QuoteAsset:    "idxusd",
+				IsProductPool: true,
+				AmountShares:  2000,
+				AmountBase:    1000,
+				AmountQuote:   1000,
+				FeeFactor:     decimal.MustNew(1, 2),
+			}
+			_, err = rdb.TxPipelined(
+				ctx, func(pipe redisv9.Pipeliner) error {
+					return redis.UpdatePoolCmd(ctx, pipe, &legacy, nil, now)
+				},
+			)
+			require.NoError(tt, err)
+			pools, err = redis.PoolsForAsset(ctx, rdb, time.Second, "idxlegacy")
+			require.NoError(tt, err)
+			assert.Empty(tt, pools)
+
+			updated := legacy
+			updated.PoolID = orderbook.ID("idxupdated", "idxusd")
+			updated.BaseAsset = "idxupdated"
+			require.NoError(tt, redis.UpdatePool(ctx, rdb, &updated, time.Second, updated.PoolID))
+			pools, err = redis.PoolsForAsset(ctx, rdb, time.Second, "idxupdated")
+			require.NoError(tt, err)
+			assert.Equal(tt, []string{updated.PoolID}, ids(pools))
+
+			indexed, err := redis.BackfillPoolIndex(ctx, rdb, time.Second)
+			require.NoError(tt, err)
+			assert.GreaterOrEqual(tt, indexed, 4)
+			pools, err = redis.PoolsForAsset(ctx, rdb, time.Second, "idxlegacy")
+			require.NoError(tt, err)
+			assert.Equal(tt, []string{legacy.PoolID}, ids(pools))
+		},
+	)
 }
@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	redisv9 "github.com/redis/go-redis/v9"
+
+	lredis "github.com/dora-network/dora-service-utils/ledger/redis"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/redis"
+)
+
+// PoolShareDiscrepancy is a pool whose shares differ from the sum of its shares held by users.
+type PoolShareDiscrepancy struct {
+	PoolID string `json:"pool_id"`
+	// PoolShares is the pool's AmountShares
+	PoolShares uint64 `json:"pool_shares"`
+	// OwnedShares is the sum of the pool's shares in users' Owned balances, including negative (borrowed) amounts
+	OwnedShares int64 `json:"owned_shares"`
+	// SuppliedShares is the sum of the pool's shares in users' Supplied balances
+	SuppliedShares int64 `json:"supplied_shares"`
+}
+
+// ReconciliationReport describes the discrepancies found by ReconcilePools.
+type ReconciliationReport struct {
+	// Time the pools were checked at, in unix seconds
+	Time int64 `json:"time"`
+	// Number of pools and user positions checked
+	Pools int `json:"pools"`
+	Users int `json:"users"`
+	// MissingPools were requested but do not exist
+	MissingPools  []string                   `json:"missing_pools"`
+	Discrepancies []PoolShareDiscrepancy     `json:"discrepancies"`
+	Violations    []types.InvariantViolation `json:"violations"`
+}
+
+// OK returns true if the report found no discrepancies.
+func (r *ReconciliationReport) OK() bool {
+	return len(r.MissingPools) == 0 && len(r.Discrepancies) == 0 && len(r.Violations) == 0
+}
+
+// ReconcilePools checks the invariants of the given pools, and compares each pool's shares against the sum of
+// its shares held by all users, in their Owned and Supplied balances. Pools and positions are read from a single
+// snapshot, so the report is consistent even while they are being updated. ReconcilePools does not modify anything.
+func ReconcilePools(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	poolIDs []string,
+	now time.Time,
+) (*ReconciliationReport, error) {
+	positionKeys, userIDs, err := getAllUserIDs(ctx, rdb)
+	if err != nil {
+		return nil, err
+	}
+	watch := append(redis.WatchKeys(PoolKey, poolIDs...), positionKeys...)
+
+	var report *ReconciliationReport
+	txFunc := func(tx *redisv9.Tx) error {
+		pools := make([]*types.Pool, len(poolIDs))
+		for i, poolID := range poolIDs {
+			pools[i] = new(types.Pool)
+			if err := GetPoolCmd(ctx, tx, poolID).Scan(pools[i]); err != nil {
+				return err
+			}
+		}
+		positionCmds, err := lredis.GetUsersPositionCmd(ctx, tx, userIDs...)
+		if err != nil {
+			return err
+		}
+		positions := make([]*ltypes.Position, 0, len(positionCmds))
+		for _, cmd := range positionCmds {
+			res, err := cmd.(*redisv9.MapStringStringCmd).Result()
+			if err != nil {
+				return err
+			}
+			for _, v := range res {
+				p := new(ltypes.Position)
+				if err := p.UnmarshalBinary([]byte(v)); err != nil {
+					return err
+				}
+				positions = append(positions, p)
+			}
+		}
+
+		report = reconcilePools(poolIDs, pools, positions, now)
+		return nil
+	}
+
+	if err := redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		watch...,
+	); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// reconcilePools builds the report for pools read by ID, where missing pools have an empty PoolID.
+func reconcilePools(
+	poolIDs []string,
+	pools []*types.Pool,
+	positions []*ltypes.Position,
+	now time.Time,
+) *ReconciliationReport {
+	report := &ReconciliationReport{
+		Time:  now.Unix(),
+		Pools: len(pools),
+		Users: len(positions),
+	}
+	for i, pool := range pools {
+		if pool.PoolID == "" {
+			report.MissingPools = append(report.MissingPools, poolIDs[i])
+			continue
+		}
+		report.Violations = append(report.Violations, pool.CheckInvariants(now)...)
+
+		d := PoolShareDiscrepancy{PoolID: pool.PoolID, PoolShares: pool.AmountShares}
+		for _, p := range positions {
+			d.OwnedShares += p.Owned.AmountOf(pool.PoolID)
+			d.SuppliedShares += p.Supplied.AmountOf(pool.PoolID)
+		}
+		if held := d.OwnedShares + d.SuppliedShares; held < 0 || uint64(held) != pool.AmountShares {
+			report.Discrepancies = append(report.Discrepancies, d)
+		}
+	}
+	return report
+}
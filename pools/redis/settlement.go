@@ -0,0 +1,199 @@
+package redis
+
+import (
+	"context"
+	stderrors "errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	redisv9 "github.com/redis/go-redis/v9"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/helpers"
+	lredis "github.com/dora-network/dora-service-utils/ledger/redis"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/redis"
+)
+
+// SettlePool settles a yield pool at or after its maturity, atomically: its bonds are redeemed at par, see
+// Pool.SettleAt, and the shares users own are redeemed for their part of the proceeds, which are added to their
+// Owned balances. Shares users have locked are released first, since they can no longer be traded; callers should
+// cancel orders for them. The shares the module holds, which back supplied shares, are redeemed for the module,
+// and its lending of the pool's shares moves to the quote asset, see Pool.SettleLending. All of this is posted in a
+// single journal entry, which is applied to the module and to the users who own, supply or owe the shares, and
+// appended to the journal. The settled pool no longer swaps or takes liquidity. The settled pool's price is
+// recorded for TWAP at now, if it still has one.
+func SettlePool(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	poolID string,
+	assetData helpers.AssetData,
+	now time.Time,
+) (*types.Settlement, error) {
+	positionKeys, userIDs, err := getAllUserIDs(ctx, rdb)
+	if err != nil {
+		return nil, err
+	}
+	watch := append([]string{PoolKey(poolID), PoolTWAPKey(poolID), lredis.ModulePositionKey()}, positionKeys...)
+
+	var settlement *types.Settlement
+	txFunc := func(tx *redisv9.Tx) error {
+		pool := new(types.Pool)
+		if err := GetPoolCmd(ctx, tx, poolID).Scan(pool); err != nil {
+			return err
+		}
+		if pool.PoolID == "" {
+			return backoff.Permanent(errors.ErrPoolNotFound)
+		}
+		positions, holders, err := getShareHolders(ctx, tx, poolID, userIDs)
+		if err != nil {
+			return err
+		}
+		module := new(ltypes.Module)
+		if err := lredis.GetModulePositionCmd(ctx, tx).Scan(module); err != nil {
+			if !stderrors.Is(err, redisv9.Nil) {
+				return err
+			}
+			module = ltypes.InitialModule()
+		}
+		previous, err := GetLastPriceObservation(ctx, tx, poolID)
+		if err != nil {
+			return err
+		}
+
+		s, err := pool.SettleAt(assetData, now)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		if err = pool.DistributeSettlement(s, holders); err != nil {
+			return backoff.Permanent(err)
+		}
+		var postings []ltypes.Posting
+		post := func(userID string, account ltypes.Account, assetID string, amount int64) {
+			if amount != 0 {
+				postings = append(
+					postings,
+					ltypes.Posting{UserID: userID, Account: account, AssetID: assetID, Amount: amount},
+				)
+			}
+		}
+		holderIDs := make([]string, 0, len(holders))
+		for userID := range holders {
+			holderIDs = append(holderIDs, userID)
+		}
+		sort.Strings(holderIDs)
+		for _, userID := range holderIDs {
+			locked := max(0, positions[userID].Locked.AmountOf(poolID))
+			post(userID, ltypes.AccountLocked, poolID, -locked)
+			post(userID, ltypes.AccountAvailable, poolID, locked)
+			shares, payout := int64(holders[userID]), int64(s.Payouts[userID].Amount)
+			post(userID, ltypes.AccountOwned, poolID, -shares)
+			post("", ltypes.AccountExternal, poolID, shares)
+			post("", ltypes.AccountExternal, pool.QuoteAsset, -payout)
+			post(userID, ltypes.AccountOwned, pool.QuoteAsset, payout)
+		}
+		lending, err := pool.SettleLending(s, module, positions)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		if lending != nil {
+			postings = append(postings, lending.Postings...)
+		}
+		var entry *ltypes.JournalEntry
+		if len(postings) > 0 {
+			if entry, err = ltypes.NewJournalEntry(types.SettlementReason, pool.SettledAt, postings...); err != nil {
+				return backoff.Permanent(err)
+			}
+			if err = entry.Apply(positions, module); err != nil {
+				return backoff.Permanent(err)
+			}
+		}
+		modified := make(map[string]*ltypes.Position)
+		for userID, p := range positions {
+			if p.IsModified() {
+				modified[userID] = p
+			}
+		}
+
+		if _, err = tx.TxPipelined(
+			ctx, func(pipe redisv9.Pipeliner) error {
+				lredis.SetUsersPositionCmd(ctx, pipe, modified)
+				if entry != nil {
+					if entry.PostsToModule() {
+						lredis.SetModulePositionCmd(ctx, pipe, module)
+					}
+					lredis.AppendJournalEntryCmd(ctx, pipe, entry)
+				}
+				return UpdatePoolCmd(ctx, pipe, pool, previous, now)
+			},
+		); err != nil {
+			return err
+		}
+		settlement = s
+		return nil
+	}
+
+	if err := redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		watch...,
+	); err != nil {
+		return nil, err
+	}
+
+	return settlement, nil
+}
+
+// getAllUserIDs returns the keys of all users' positions, and the users' IDs.
+func getAllUserIDs(ctx context.Context, rdb redis.Client) (positionKeys, userIDs []string, err error) {
+	positionKeys, err = lredis.GetAllUsersPositionKeys(ctx, rdb)
+	if err != nil {
+		return nil, nil, err
+	}
+	userIDs = make([]string, len(positionKeys))
+	for i, key := range positionKeys {
+		userIDs[i] = strings.TrimPrefix(key, lredis.UserPositionKey(""))
+	}
+	return positionKeys, userIDs, nil
+}
+
+// getShareHolders reads the positions of the users who own, supply or owe a pool's shares, and the number of shares
+// each owner owns.
+func getShareHolders(
+	ctx context.Context,
+	tx redis.Cmdable,
+	poolID string,
+	userIDs []string,
+) (map[string]*ltypes.Position, map[string]uint64, error) {
+	positionCmds, err := lredis.GetUsersPositionCmd(ctx, tx, userIDs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	positions := make(map[string]*ltypes.Position)
+	holders := make(map[string]uint64)
+	for _, cmd := range positionCmds {
+		res, err := cmd.(*redisv9.MapStringStringCmd).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, v := range res {
+			p := new(ltypes.Position)
+			if err := p.UnmarshalBinary([]byte(v)); err != nil {
+				return nil, nil, err
+			}
+			if shares := p.Owned.AmountOf(poolID); shares > 0 {
+				holders[p.UserID] = uint64(shares)
+			}
+			if p.Owned.AmountOf(poolID) != 0 || p.Supplied.AmountOf(poolID) != 0 {
+				positions[p.UserID] = p
+			}
+		}
+	}
+	return positions, holders, nil
+}
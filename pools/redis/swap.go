@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	redisv9 "github.com/redis/go-redis/v9"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/redis"
+)
+
+// ExecuteSwap executes a swap against the pool stored in Redis, atomically. The swap is only executed if the
+// stored pool's sequence is expectedSequence, the sequence the caller quoted the swap against.
+// Error ErrPoolSequenceMismatch if the pool changed in the meantime; callers should re-read the pool and retry.
+// The pool's price after the swap is recorded for TWAP.
+func ExecuteSwap(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	poolID string,
+	expectedSequence uint64,
+	balanceIn, minOut *ltypes.Balance,
+	deadline time.Time,
+	opts ...PoolOption,
+) (*types.SwapReceipt, error) {
+	key := PoolKey(poolID)
+	now := newPoolConfig(opts...).clock.Now()
+
+	var receipt *types.SwapReceipt
+	txFunc := func(tx *redisv9.Tx) error {
+		pool := new(types.Pool)
+		if err := GetPoolCmd(ctx, tx, poolID).Scan(pool); err != nil {
+			return err
+		}
+		if pool.PoolID == "" {
+			return backoff.Permanent(errors.ErrPoolNotFound)
+		}
+		if pool.Sequence != expectedSequence {
+			return backoff.Permanent(errors.ErrPoolSequenceMismatch)
+		}
+
+		previous, err := GetLastPriceObservation(ctx, tx, poolID)
+		if err != nil {
+			return err
+		}
+		r, err := pool.ExecuteSwapAt(balanceIn, minOut, deadline, now)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+
+		if _, err = tx.TxPipelined(
+			ctx, func(pipe redisv9.Pipeliner) error {
+				return UpdatePoolBalanceCmd(ctx, pipe, pool, previous, now)
+			},
+		); err != nil {
+			return err
+		}
+		receipt = r
+		return nil
+	}
+
+	if err := redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		key,
+		PoolTWAPKey(poolID),
+	); err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
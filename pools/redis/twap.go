@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	redisv9 "github.com/redis/go-redis/v9"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/redis"
+)
+
+// MaxPriceObservations is the number of price observations kept for each pool. Older observations are removed,
+// so how far back a TWAP can look depends on how often the pool changes.
+const MaxPriceObservations = 1024
+
+// PoolTWAPKey is the sorted set of a pool's price observations, scored by time.
+func PoolTWAPKey(poolID string) string {
+	return fmt.Sprintf("pools:%s:twap", poolID)
+}
+
+// GetLastPriceObservation returns the pool's last price observation, or nil if it has none.
+// In a transaction, it must be called before the transaction's commands are queued.
+func GetLastPriceObservation(ctx context.Context, tx redis.Cmdable, poolID string) (*types.PriceObservation, error) {
+	res, err := tx.ZRevRange(ctx, PoolTWAPKey(poolID), 0, 0).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+	o := new(types.PriceObservation)
+	if err := o.UnmarshalBinary([]byte(res[0])); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// RecordPriceCmd records the pool's price at a specific time, following its previous observation (nil for the
+// first, see GetLastPriceObservation). The pool should already include the change being recorded.
+// Pools without a price, such as empty pools, are not recorded: their previous price is assumed to hold, see
+// types.Pool.Observe.
+func RecordPriceCmd(
+	ctx context.Context,
+	tx redis.Cmdable,
+	pool *types.Pool,
+	previous *types.PriceObservation,
+	now time.Time,
+) error {
+	o, err := pool.Observe(previous, now)
+	if err == errors.ErrPoolHasNoPrice {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	member, err := o.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	key := PoolTWAPKey(pool.PoolID)
+	score := float64(o.Time)
+	// only keep the last observation of each second
+	tx.ZRemRangeByScore(ctx, key, fmt.Sprint(o.Time), fmt.Sprint(o.Time))
+	tx.ZAdd(ctx, key, redisv9.Z{Score: score, Member: member})
+	tx.ZRemRangeByRank(ctx, key, 0, -MaxPriceObservations-1)
+	return nil
+}
+
+// GetPriceObservations returns the pool's price observations, sorted by time.
+func GetPriceObservations(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	poolID string,
+) ([]types.PriceObservation, error) {
+	key := PoolTWAPKey(poolID)
+
+	var observations []types.PriceObservation
+	txFunc := func(tx *redisv9.Tx) error {
+		res, err := tx.ZRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		observations = make([]types.PriceObservation, len(res))
+		for i, v := range res {
+			if err := observations[i].UnmarshalBinary([]byte(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := redis.TryTransaction(
+		ctx,
+		rdb,
+		txFunc,
+		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(timeout)),
+		key,
+	); err != nil {
+		return nil, err
+	}
+
+	return observations, nil
+}
+
+// TWAP returns the pool's time-weighted average price over the window ending now.
+// Error ErrNotEnoughPriceHistory if the pool has no observation as old as the window.
+func TWAP(ctx context.Context, rdb redis.Client, timeout time.Duration, poolID string, window time.Duration) (
+	float64,
+	error,
+) {
+	return TWAPAt(ctx, rdb, timeout, poolID, window, time.Now())
+}
+
+// TWAPAt is TWAP over the window ending at a specific time.
+func TWAPAt(
+	ctx context.Context,
+	rdb redis.Client,
+	timeout time.Duration,
+	poolID string,
+	window time.Duration,
+	now time.Time,
+) (float64, error) {
+	observations, err := GetPriceObservations(ctx, rdb, timeout, poolID)
+	if err != nil {
+		return 0, err
+	}
+	return types.TWAP(observations, now.Add(-window), now)
+}
@@ -0,0 +1,142 @@
+package types
+
+import (
+	gmath "math"
+	"math/big"
+	"time"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/math"
+)
+
+// SimulateSwapExactOut returns the smallest balanceIn for which SimulateSwap gives at least balanceOut,
+// along with the fee SimulateSwap charges for it. Because amounts are integers, swapping balanceIn may give
+// slightly more than balanceOut, but never less, so the pool is never under-charged.
+// Error ErrNotEnoughPoolReserves if balanceOut is not lower than the pool's reserve of that asset.
+func (p *Pool) SimulateSwapExactOut(balanceOut *types.Balance) (balanceIn, balanceFee *types.Balance, err error) {
+	return p.SimulateSwapExactOutAt(balanceOut, time.Now())
+}
+
+// SimulateSwapExactOutAt is SimulateSwapExactOut at a specific time.
+func (p *Pool) SimulateSwapExactOutAt(
+	balanceOut *types.Balance,
+	now time.Time,
+) (balanceIn, balanceFee *types.Balance, err error) {
+	if balanceOut == nil {
+		return nil, nil, errors.ErrSwapInputInNil
+	}
+	if !balanceOut.Valid() {
+		return nil, nil, errors.New(errors.InvalidInputError, "invalid balance")
+	}
+	if balanceOut.IsZero() {
+		return nil, nil, errors.ErrAmountCannotBeZero
+	}
+	poolReserveAssetOut, poolReserveAssetIn, err := p.Balances(balanceOut.Asset)
+	if err != nil {
+		return nil, nil, err
+	}
+	if balanceOut.Amount >= poolReserveAssetOut.Amount {
+		return nil, nil, errors.ErrNotEnoughPoolReserves
+	}
+
+	// the estimate only starts the search: the product curve is close enough for weighted and stable pools
+	var estimate uint64
+	if p.Kind() == PoolKindYield {
+		estimate = p.estimateYieldPoolAmountIn(poolReserveAssetIn, poolReserveAssetOut, balanceOut.Amount, now)
+	} else {
+		estimate = p.estimateProductPoolAmountIn(poolReserveAssetIn.Amount, poolReserveAssetOut.Amount, balanceOut.Amount)
+	}
+
+	amountIn, err := p.searchAmountIn(poolReserveAssetIn.Asset, balanceOut.Amount, estimate, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	balanceIn = types.NewBalance(poolReserveAssetIn.Asset, int64(amountIn))
+	_, balanceFee, err = p.SimulateSwapAt(balanceIn, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	return balanceIn, balanceFee, nil
+}
+
+// estimateProductPoolAmountIn inverts the constant product formula used by simulateProductPoolSwap:
+// amountInAfterFee = reserveIn * amountOut / (reserveOut - amountOut), amountIn = amountInAfterFee / (1 - fee).
+// Both divisions round up. Returns 0 if no estimate could be made.
+func (p *Pool) estimateProductPoolAmountIn(reserveIn, reserveOut, amountOut uint64) uint64 {
+	num := math.Mul(new(big.Int).SetUint64(reserveIn), new(big.Int).SetUint64(amountOut))
+	den := new(big.Int).SetUint64(reserveOut - amountOut)
+	afterFee, _ := new(big.Float).SetInt(math.DivI(num, den, true)).Float64()
+	fee := p.SwapFee()
+	if fee >= 1 {
+		return 0
+	}
+	return floatToAmount(gmath.Ceil(afterFee / (1 - fee)))
+}
+
+// estimateYieldPoolAmountIn inverts the yield curve used by simulateYieldPoolSwap (including its fee factor):
+// in_end = [k - out_end^(1-tg)]^[1/(1-tg)]. Returns 0 if no estimate could be made.
+func (p *Pool) estimateYieldPoolAmountIn(
+	reserveIn, reserveOut *types.Balance,
+	amountOut uint64,
+	now time.Time,
+) uint64 {
+	t, _ := calculateT(now.Unix(), p.MaturityAt, p.Duration()).Float64()
+	G := p.G()
+	if reserveIn.Asset == p.BaseAsset {
+		G = 1 / G
+	}
+	exp := 1 - t*G
+	if exp == 0 {
+		return 0
+	}
+	k := gmath.Pow(float64(p.AmountQuote), exp) + gmath.Pow(float64(p.AmountBase), exp)
+	inEnd := gmath.Pow(k-gmath.Pow(float64(reserveOut.Amount-amountOut), exp), 1/exp)
+	return floatToAmount(gmath.Ceil(inEnd - float64(reserveIn.Amount)))
+}
+
+// searchAmountIn finds the smallest amount in of assetIn for which SimulateSwap gives at least amountOut,
+// starting from an estimate. Assumes the amount out grows with the amount in. The estimate only seeds
+// the search, so the result is as deterministic as SimulateSwap itself.
+func (p *Pool) searchAmountIn(assetIn string, amountOut, estimate uint64, now time.Time) (uint64, error) {
+	enough := func(amountIn uint64) bool {
+		out, _, err := p.SimulateSwapAt(types.NewBalance(assetIn, int64(amountIn)), now)
+		return err == nil && out.Amount >= amountOut
+	}
+
+	// Find an amount which is enough, growing the step until it is
+	hi := max(estimate, 1)
+	for step := uint64(1); !enough(hi); step *= 2 {
+		if hi > gmath.MaxInt64-step {
+			return 0, errors.ErrNotEnoughPoolReserves
+		}
+		hi += step
+	}
+	// Find an amount which is not enough, shrinking by a growing step until it is not
+	lo := uint64(0)
+	for step := uint64(1); hi > step; step *= 2 {
+		if !enough(hi - step) {
+			lo = hi - step
+			break
+		}
+		hi -= step
+	}
+	// Binary search between the two
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if enough(mid) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi, nil
+}
+
+// floatToAmount converts a float estimate to an amount, returning 0 for anything which is not a valid int64.
+func floatToAmount(f float64) uint64 {
+	if gmath.IsNaN(f) || f <= 0 || f >= gmath.MaxInt64 {
+		return 0
+	}
+	return uint64(f)
+}
@@ -0,0 +1,64 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func TestSimulateSwapExactOut(t *testing.T) {
+	yieldPool := &types.Pool{
+		PoolID:       consts.BondID + "-" + consts.StableID,
+		BaseAsset:    consts.BondID,
+		QuoteAsset:   consts.StableID,
+		AmountBase:   1_000_000,
+		AmountQuote:  950_000,
+		AmountShares: 1_950_000,
+		FeeFactor:    decimal.MustParse("1.02"),
+		CreatedAt:    time.Now().Add(-100 * 24 * time.Hour).Unix(),
+		MaturityAt:   time.Now().Add(265 * 24 * time.Hour).Unix(),
+	}
+	productPool := productPool(consts.BondID, consts.StableID, 1_000_000, 950_000)
+
+	for name, pool := range map[string]*types.Pool{"product": productPool, "yield": yieldPool} {
+		t.Run(
+			name, func(tt *testing.T) {
+				require := require.New(tt)
+				for _, asset := range []string{consts.BondID, consts.StableID} {
+					for _, amount := range []int64{1, 7, 1_000, 123_456, 900_000} {
+						want := ltypes.NewBalance(asset, amount)
+						in, fee, err := pool.SimulateSwapExactOut(want)
+						require.NoError(err)
+
+						out, expectedFee, err := pool.SimulateSwap(in)
+						require.NoError(err)
+						require.Equal(expectedFee, fee)
+						require.GreaterOrEqual(out.Amount, want.Amount, "pool must not be under-charged")
+
+						// one less must not be enough
+						if in.Amount > 1 {
+							out, _, err = pool.SimulateSwap(ltypes.NewBalance(in.Asset, int64(in.Amount-1)))
+							if err == nil {
+								require.Less(out.Amount, want.Amount)
+							}
+						}
+					}
+				}
+
+				_, _, err := pool.SimulateSwapExactOut(ltypes.NewBalance(consts.StableID, int64(pool.AmountQuote)))
+				require.ErrorIs(err, errors.ErrNotEnoughPoolReserves)
+				_, _, err = pool.SimulateSwapExactOut(ltypes.NewBalance(consts.StableID, int64(0)))
+				require.ErrorIs(err, errors.ErrAmountCannotBeZero)
+				_, _, err = pool.SimulateSwapExactOut(ltypes.NewBalance("other", int64(1)))
+				require.ErrorIs(err, errors.ErrAssetNotFoundInPool)
+			},
+		)
+	}
+}
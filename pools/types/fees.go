@@ -0,0 +1,176 @@
+package types
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/goccy/go-json"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/math"
+)
+
+// ShareValue returns the underlying value of an amount of the pool's shares: their part of the pool's reserves
+// and of its collected fees, rounded down. Removing the shares pays the reserves, see RemoveLiquidity, and
+// claiming pays the fees, see ClaimFees.
+func (p *Pool) ShareValue(shares uint64) (base, quote types.Amount, err error) {
+	if shares > p.AmountShares {
+		return types.Amount{}, types.Amount{}, errors.Data(
+			"ShareValue: %d shares is more than pool %s has", shares, p.PoolID,
+		)
+	}
+	base, quote = types.NewAmount(p.BaseAsset, 0), types.NewAmount(p.QuoteAsset, 0)
+	if shares == 0 {
+		return base, quote, nil
+	}
+	if base.Amount, err = p.sharesOf(p.AmountBase, p.FeesCollectedBase, shares); err != nil {
+		return types.Amount{}, types.Amount{}, err
+	}
+	if quote.Amount, err = p.sharesOf(p.AmountQuote, p.FeesCollectedQuote, shares); err != nil {
+		return types.Amount{}, types.Amount{}, err
+	}
+	return base, quote, nil
+}
+
+// feeIndexScale scales fee indexes, so that fees of less than one per share are counted.
+var feeIndexScale = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+// FeeIndex is an amount of a pool's collected fees per share, scaled by 10^18.
+type FeeIndex struct {
+	Base  *big.Int `json:"base"`
+	Quote *big.Int `json:"quote"`
+}
+
+// of returns the index of the base asset if base is true, else of the quote asset. Unset indexes are zero.
+func (i FeeIndex) of(base bool) *big.Int {
+	index := i.Quote
+	if base {
+		index = i.Base
+	}
+	if index == nil {
+		return new(big.Int)
+	}
+	return index
+}
+
+// FeeCheckpoints records which of a pool's collected fees its share holders have been paid, see ClaimFees.
+type FeeCheckpoints struct {
+	// Index is the fees collected per share, from the pool's first claim to its last
+	Index FeeIndex `json:"index"`
+	// OwedBase and OwedQuote are the collected fees counted in Index which have not been paid
+	OwedBase  uint64 `json:"owed_base"`
+	OwedQuote uint64 `json:"owed_quote"`
+	// Holders are the Index each holder was last paid at
+	Holders map[string]FeeIndex `json:"holders"`
+}
+
+func (c *FeeCheckpoints) MarshalBinary() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+func (c *FeeCheckpoints) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, c)
+}
+
+// ClaimFees pays the pool's collected fees to its share holders, pro-rata to the shares each holds, rounded down.
+// The fees collected since the last claim are counted per share into the checkpoints' index, and each holder is
+// paid the index's growth since their checkpoint, which is then moved to the index. Holders claiming again are
+// only paid the fees collected since, and fees on shares which are not claimed for, such as the module's, stay
+// collected until they are. Holders without a checkpoint are paid the fees collected since the last claim, which
+// shares added in the meantime paid for their part of, see AddLiquidity. A holder's checkpoint covers all the
+// shares they hold when claiming, so payments are capped to the fees owed. Returns the base and quote fees paid to
+// each holder. Pool and checkpoints are mutated, and left unchanged on error.
+// Error if the holders hold more shares than the pool has.
+func (p *Pool) ClaimFees(checkpoints *FeeCheckpoints, holders map[string]uint64) (map[string][]types.Amount, error) {
+	ids := make([]string, 0, len(holders))
+	var total uint64
+	for id, shares := range holders {
+		ids = append(ids, id)
+		var err error
+		if total, err = math.CheckedAddU64(total, shares); err != nil {
+			return nil, err
+		}
+	}
+	if total > p.AmountShares {
+		return nil, errors.Data("ClaimFees: holders hold %d shares but pool %s has %d", total, p.PoolID, p.AmountShares)
+	}
+	sort.Strings(ids)
+
+	updated := *p
+	fees := [2]*uint64{&updated.FeesCollectedBase, &updated.FeesCollectedQuote}
+	owed := [2]uint64{checkpoints.OwedBase, checkpoints.OwedQuote}
+	last := checkpoints.Index
+	index := FeeIndex{Base: new(big.Int).Set(last.of(true)), Quote: new(big.Int).Set(last.of(false))}
+	for i, base := range []bool{true, false} {
+		owed[i] = min(owed[i], *fees[i])
+		if p.AmountShares == 0 {
+			continue
+		}
+		// fees collected since the last claim are shared by the shares at the time of this claim
+		perShare := math.DivI(
+			math.Mul(new(big.Int).SetUint64(*fees[i]-owed[i]), feeIndexScale),
+			new(big.Int).SetUint64(p.AmountShares),
+			false,
+		)
+		index.of(base).Add(index.of(base), perShare)
+		owed[i] = *fees[i]
+	}
+
+	claims := make(map[string][]types.Amount, len(holders))
+	for _, id := range ids {
+		if holders[id] == 0 {
+			continue
+		}
+		checkpoint, ok := checkpoints.Holders[id]
+		if !ok {
+			checkpoint = last
+		}
+		claim := []types.Amount{types.NewAmount(p.BaseAsset, 0), types.NewAmount(p.QuoteAsset, 0)}
+		for i, base := range []bool{true, false} {
+			due := math.DivI(
+				math.Mul(new(big.Int).Sub(index.of(base), checkpoint.of(base)), new(big.Int).SetUint64(holders[id])),
+				feeIndexScale,
+				false,
+			)
+			if due.Sign() <= 0 {
+				continue
+			}
+			fee := owed[i]
+			if due.IsUint64() {
+				fee = min(fee, due.Uint64())
+			}
+			owed[i] -= fee
+			*fees[i] -= fee
+			claim[i].Amount = fee
+		}
+		claims[id] = claim
+	}
+
+	if updated.FeesCollectedBase != p.FeesCollectedBase || updated.FeesCollectedQuote != p.FeesCollectedQuote {
+		updated.Sequence++
+	}
+	if checkpoints.Holders == nil {
+		checkpoints.Holders = make(map[string]FeeIndex, len(claims))
+	}
+	for id := range claims {
+		checkpoints.Holders[id] = index
+	}
+	checkpoints.Index = index
+	checkpoints.OwedBase, checkpoints.OwedQuote = owed[0], owed[1]
+	*p = updated
+	return claims, nil
+}
+
+// sharesOf returns floor((reserve + fees) * shares / poolShares).
+func (p *Pool) sharesOf(reserve, fees, shares uint64) (uint64, error) {
+	if p.AmountShares == 0 {
+		return 0, errors.ErrNotEnoughPoolReserves
+	}
+	total := new(big.Int).Add(new(big.Int).SetUint64(reserve), new(big.Int).SetUint64(fees))
+	amount := math.DivI(math.Mul(total, new(big.Int).SetUint64(shares)), new(big.Int).SetUint64(p.AmountShares), false)
+	if !amount.IsUint64() {
+		return 0, errors.Data("sharesOf: amount overflows")
+	}
+	return amount.Uint64(), nil
+}
@@ -0,0 +1,161 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func TestPool_ShareValue(t *testing.T) {
+	require := require.New(t)
+
+	pool := productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000)
+	_, err := pool.ExecuteSwapAt(ltypes.NewBalance(consts.StableID, int64(100_000)), nil, goldenNow, goldenNow)
+	require.NoError(err)
+	require.Positive(pool.FeesCollectedQuote)
+
+	// all shares are worth the reserves and the fees
+	base, quote, err := pool.ShareValue(pool.AmountShares)
+	require.NoError(err)
+	require.Equal(ltypes.NewAmount(consts.BondID, pool.AmountBase), base)
+	require.Equal(ltypes.NewAmount(consts.StableID, pool.AmountQuote+pool.FeesCollectedQuote), quote)
+
+	// part of the shares are worth more than removing them pays, until the fees are claimed
+	before := *pool
+	base, quote, err = pool.ShareValue(1_000)
+	require.NoError(err)
+	removed, err := before.RemoveLiquidity(ltypes.NewAmount(pool.PoolID, 1_000))
+	require.NoError(err)
+	require.Equal(removed[0], base)
+	require.Greater(quote.Amount, removed[1].Amount)
+
+	base, quote, err = pool.ShareValue(0)
+	require.NoError(err)
+	require.True(base.IsZero() && quote.IsZero())
+	_, _, err = pool.ShareValue(pool.AmountShares + 1)
+	require.Error(err)
+}
+
+func TestPool_ClaimFees(t *testing.T) {
+	require := require.New(t)
+
+	pool := productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000)
+	pool.FeesCollectedBase = 1_000
+	pool.FeesCollectedQuote = 3_001
+	sequence := pool.Sequence
+
+	checkpoints := new(types.FeeCheckpoints)
+	_, err := pool.ClaimFees(checkpoints, map[string]uint64{"alice": pool.AmountShares, "bob": 1})
+	require.Error(err)
+	require.Equal(sequence, pool.Sequence)
+	require.Equal(types.FeeCheckpoints{}, *checkpoints)
+
+	// alice holds a quarter of the shares and bob half; fees on the rest stay collected
+	claims, err := pool.ClaimFees(checkpoints, map[string]uint64{"alice": 500_000, "bob": 1_000_000, "carol": 0})
+	require.NoError(err)
+	require.Equal(
+		[]ltypes.Amount{ltypes.NewAmount(consts.BondID, 250), ltypes.NewAmount(consts.StableID, 750)},
+		claims["alice"],
+	)
+	require.Equal(
+		[]ltypes.Amount{ltypes.NewAmount(consts.BondID, 500), ltypes.NewAmount(consts.StableID, 1_500)},
+		claims["bob"],
+	)
+	require.NotContains(claims, "carol")
+	require.Equal(uint64(250), pool.FeesCollectedBase)
+	require.Equal(uint64(751), pool.FeesCollectedQuote)
+	require.Equal(sequence+1, pool.Sequence)
+	require.Empty(pool.CheckInvariants(goldenNow))
+
+	// claiming again pays nothing, and the fees on the rest of the shares stay collected for them
+	claims, err = pool.ClaimFees(checkpoints, map[string]uint64{"alice": 500_000, "bob": 1_000_000})
+	require.NoError(err)
+	require.Equal(
+		[]ltypes.Amount{ltypes.NewAmount(consts.BondID, 0), ltypes.NewAmount(consts.StableID, 0)},
+		claims["alice"],
+	)
+	require.Equal(claims["alice"], claims["bob"])
+	require.Equal(uint64(250), pool.FeesCollectedBase)
+	require.Equal(uint64(751), pool.FeesCollectedQuote)
+	require.Equal(sequence+1, pool.Sequence)
+
+	// only fees collected since are paid to holders who claimed before, and dave holds the rest of the shares
+	pool.FeesCollectedBase += 2_000
+	claims, err = pool.ClaimFees(checkpoints, map[string]uint64{"alice": 500_000, "dave": 500_000})
+	require.NoError(err)
+	require.Equal(
+		[]ltypes.Amount{ltypes.NewAmount(consts.BondID, 500), ltypes.NewAmount(consts.StableID, 0)},
+		claims["alice"],
+	)
+	require.Equal(
+		[]ltypes.Amount{ltypes.NewAmount(consts.BondID, 500), ltypes.NewAmount(consts.StableID, 0)},
+		claims["dave"],
+	)
+	// bob's part of the new fees, and dave's part of the fees before the last claim, stay collected
+	require.Equal(uint64(1_250), pool.FeesCollectedBase)
+	require.Equal(uint64(751), pool.FeesCollectedQuote)
+	require.Equal(uint64(1_250), checkpoints.OwedBase)
+
+	// checkpoints survive being stored
+	data, err := checkpoints.MarshalBinary()
+	require.NoError(err)
+	stored := new(types.FeeCheckpoints)
+	require.NoError(stored.UnmarshalBinary(data))
+	claims, err = pool.ClaimFees(stored, map[string]uint64{"bob": 1_000_000})
+	require.NoError(err)
+	require.Equal(
+		[]ltypes.Amount{ltypes.NewAmount(consts.BondID, 1_000), ltypes.NewAmount(consts.StableID, 0)},
+		claims["bob"],
+	)
+}
+
+func TestPool_AddLiquidityWithFees(t *testing.T) {
+	require := require.New(t)
+
+	newPool := func() *types.Pool {
+		pool := productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000)
+		pool.FeesCollectedBase = 1_000
+		pool.FeesCollectedQuote = 3_000
+		return pool
+	}
+
+	// bob adds a tenth of the pool, so pays a tenth of the fees, which go to the fees
+	pool := newPool()
+	before := *pool
+	quoteIn, sharesOut, err := pool.AddLiquidity(ltypes.NewAmount(consts.BondID, 100_100))
+	require.NoError(err)
+	require.Equal(ltypes.NewAmount(consts.StableID, 100_300), quoteIn)
+	require.Equal(ltypes.NewAmount(pool.PoolID, 200_000), sharesOut)
+	require.Equal(uint64(1_100_000), pool.AmountBase)
+	require.Equal(uint64(1_100_000), pool.AmountQuote)
+	require.Equal(uint64(1_100), pool.FeesCollectedBase)
+	require.Equal(uint64(3_300), pool.FeesCollectedQuote)
+	require.Empty(types.CheckTransition(&before, pool, goldenNow))
+
+	// claiming pays bob back what was paid for the fees, and alice all the fees collected before
+	claims, err := pool.ClaimFees(new(types.FeeCheckpoints), map[string]uint64{"alice": 2_000_000, "bob": 200_000})
+	require.NoError(err)
+	require.Equal(
+		[]ltypes.Amount{ltypes.NewAmount(consts.BondID, 1_000), ltypes.NewAmount(consts.StableID, 3_000)},
+		claims["alice"],
+	)
+	require.Equal(
+		[]ltypes.Amount{ltypes.NewAmount(consts.BondID, 100), ltypes.NewAmount(consts.StableID, 300)},
+		claims["bob"],
+	)
+
+	// and the same given the quote asset
+	pool = newPool()
+	before = *pool
+	baseIn, sharesOut, err := pool.AddLiquidityQuote(ltypes.NewAmount(consts.StableID, 300_900))
+	require.NoError(err)
+	require.Equal(ltypes.NewAmount(consts.BondID, 300_300), baseIn)
+	require.Equal(ltypes.NewAmount(pool.PoolID, 600_000), sharesOut)
+	require.Equal(uint64(1_300), pool.FeesCollectedBase)
+	require.Equal(uint64(3_900), pool.FeesCollectedQuote)
+	require.Empty(types.CheckTransition(&before, pool, goldenNow))
+}
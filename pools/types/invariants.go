@@ -0,0 +1,236 @@
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/govalues/decimal"
+
+	"github.com/dora-network/dora-service-utils/math"
+)
+
+// Invariants checked by CheckInvariants and CheckTransition.
+const (
+	// InvariantAssets requires the pool's assets to be valid.
+	InvariantAssets = "assets"
+	// InvariantKind requires the pool's kind to be supported and to agree with IsProductPool, and its parameters
+	// to be valid for its kind.
+	InvariantKind = "kind"
+	// InvariantSharesReserves requires a pool to have shares if and only if it has reserves.
+	InvariantSharesReserves = "shares_reserves"
+	// InvariantYieldCurve requires the yield curve's k to be computable from a yield pool's reserves.
+	InvariantYieldCurve = "yield_curve"
+	// InvariantImmutable requires a pool's identity and parameters not to change.
+	InvariantImmutable = "immutable"
+	// InvariantSequence requires a pool's sequence to grow whenever the pool changes, and never to shrink.
+	InvariantSequence = "sequence"
+	// InvariantConstantProduct requires a product pool's x * y not to decrease when its shares do not change.
+	InvariantConstantProduct = "constant_product"
+	// InvariantCurve requires a weighted or stable pool's invariant not to decrease when its shares do not change.
+	InvariantCurve = "curve"
+	// InvariantYieldK requires a yield pool's k, counting the fees it collects, not to decrease when its shares
+	// do not change. Swaps which the fee curve prices above the fee-free curve violate it; this happens while
+	// the pool holds more base than quote.
+	InvariantYieldK = "yield_k"
+	// InvariantSettled requires a pool to be settled at most once, see Pool.SettleAt.
+	InvariantSettled = "settled"
+	// InvariantShareValue requires the reserves backing each share, with and without the collected fees, not to
+	// decrease.
+	InvariantShareValue = "share_value"
+)
+
+// InvariantViolation describes a pool invariant which does not hold.
+type InvariantViolation struct {
+	PoolID    string `json:"pool_id"`
+	Invariant string `json:"invariant"`
+	Detail    string `json:"detail"`
+}
+
+func (v InvariantViolation) String() string {
+	return fmt.Sprintf("pool %s: %s: %s", v.PoolID, v.Invariant, v.Detail)
+}
+
+// CheckInvariants returns the invariants which do not hold for the pool at a specific time.
+// A pool created by this package's operations never violates them; violations indicate corrupt pool state.
+func (p *Pool) CheckInvariants(now time.Time) []InvariantViolation {
+	var violations []InvariantViolation
+	violate := func(invariant, format string, a ...any) {
+		violations = append(
+			violations,
+			InvariantViolation{PoolID: p.PoolID, Invariant: invariant, Detail: fmt.Sprintf(format, a...)},
+		)
+	}
+
+	if err := p.validateAssets(); err != nil {
+		violate(InvariantAssets, "%v", err)
+	}
+	hasReserves := p.AmountBase != 0 || p.AmountQuote != 0
+	// a settled pool's bonds have been redeemed, so its shares are backed by the quote asset alone
+	settled := p.SettledAt != 0
+	switch {
+	case hasReserves && p.AmountShares == 0:
+		violate(InvariantSharesReserves, "reserves %d %s and %d %s without shares",
+			p.AmountBase, p.BaseAsset, p.AmountQuote, p.QuoteAsset)
+	case settled && p.AmountBase != 0:
+		violate(InvariantSharesReserves, "settled with reserves %d %s", p.AmountBase, p.BaseAsset)
+	case p.AmountShares != 0 && ((p.AmountBase == 0 && !settled) || p.AmountQuote == 0):
+		violate(InvariantSharesReserves, "%d shares with reserves %d %s and %d %s",
+			p.AmountShares, p.AmountBase, p.BaseAsset, p.AmountQuote, p.QuoteAsset)
+	}
+	if err := p.validateKind(); err != nil {
+		violate(InvariantKind, "%v", err)
+	}
+	invariant, err := p.Invariant()
+	switch {
+	case err != nil:
+		violate(InvariantKind, "unsupported pool kind %q", p.Kind())
+	case p.Kind() != PoolKindYield:
+		if err := invariant.Validate(p); err != nil {
+			violate(InvariantKind, "%v", err)
+		}
+	case !settled:
+		if p.MaturityAt <= p.CreatedAt {
+			violate(InvariantYieldCurve, "maturity %d is not after creation %d", p.MaturityAt, p.CreatedAt)
+		} else if tPrime := p.yieldTPrime(now); !tPrime.IsZero() {
+			if _, err := calculateK(p.AmountBase, p.AmountQuote, tPrime); err != nil {
+				violate(InvariantYieldCurve, "%v", err)
+			}
+		}
+	}
+	return violations
+}
+
+// CheckTransition returns the invariants which do not hold between two states of the same pool at a specific
+// time, such as before and after a swap or a liquidity change. It does not check the states themselves, see
+// CheckInvariants. Swaps must not decrease the pool's k, and no operation may decrease the reserves backing
+// each share, since amounts are always rounded in the pool's favour. Operations which combine a swap and a
+// liquidity change, such as AddLiquiditySingleSided, move reserves unevenly and should be checked step by step.
+// Settlement redeems a pool's bonds rather than swapping them, so k is not checked when a pool is settled.
+func CheckTransition(before, after *Pool, now time.Time) []InvariantViolation {
+	var violations []InvariantViolation
+	violate := func(invariant, format string, a ...any) {
+		violations = append(
+			violations,
+			InvariantViolation{PoolID: before.PoolID, Invariant: invariant, Detail: fmt.Sprintf(format, a...)},
+		)
+	}
+
+	if before.PoolID != after.PoolID ||
+		before.BaseAsset != after.BaseAsset ||
+		before.QuoteAsset != after.QuoteAsset ||
+		before.IsProductPool != after.IsProductPool ||
+		before.Kind() != after.Kind() ||
+		before.WeightBase.Cmp(after.WeightBase) != 0 ||
+		before.Amplification != after.Amplification ||
+		before.FeeFactor.Cmp(after.FeeFactor) != 0 ||
+		before.CreatedAt != after.CreatedAt ||
+		before.MaturityAt != after.MaturityAt {
+		violate(InvariantImmutable, "pool parameters changed")
+		// the other invariants compare states of the same pool
+		return violations
+	}
+
+	changed := before.AmountShares != after.AmountShares ||
+		before.AmountBase != after.AmountBase ||
+		before.AmountQuote != after.AmountQuote ||
+		before.FeesCollectedBase != after.FeesCollectedBase ||
+		before.FeesCollectedQuote != after.FeesCollectedQuote
+	switch {
+	case after.Sequence < before.Sequence:
+		violate(InvariantSequence, "sequence decreased from %d to %d", before.Sequence, after.Sequence)
+	case changed && after.Sequence == before.Sequence:
+		violate(InvariantSequence, "pool changed without its sequence %d changing", before.Sequence)
+	}
+
+	if before.AmountShares == after.AmountShares && after.SettledAt == 0 {
+		switch before.Kind() {
+		case PoolKindProduct:
+			kBefore := productK(before.AmountBase, before.AmountQuote)
+			kAfter := productK(after.AmountBase, after.AmountQuote)
+			if kAfter.Cmp(kBefore) < 0 {
+				violate(InvariantConstantProduct, "k decreased from %s to %s", kBefore, kAfter)
+			}
+		case PoolKindWeighted:
+			kBefore, errBefore := before.weightedK(before.AmountBase, before.AmountQuote)
+			kAfter, errAfter := before.weightedK(after.AmountBase, after.AmountQuote)
+			if errBefore == nil && errAfter == nil && kAfter.Less(kBefore) {
+				violate(InvariantCurve, "k decreased from %s to %s", kBefore, kAfter)
+			}
+		case PoolKindStable:
+			dBefore, errBefore := stableD(before.AmountBase, before.AmountQuote, before.Amplification)
+			dAfter, errAfter := stableD(after.AmountBase, after.AmountQuote, before.Amplification)
+			if errBefore == nil && errAfter == nil && dAfter.Cmp(dBefore) < 0 {
+				violate(InvariantCurve, "D decreased from %s to %s", dBefore, dAfter)
+			}
+		case PoolKindYield:
+			// Yield pool swaps price the amount out on the whole amount in, but keep the fee out of the reserves,
+			// so k only holds once the fees collected by the swap are counted back in
+			base := after.AmountBase + (after.FeesCollectedBase - min(before.FeesCollectedBase, after.FeesCollectedBase))
+			quote := after.AmountQuote + (after.FeesCollectedQuote - min(before.FeesCollectedQuote, after.FeesCollectedQuote))
+			if tPrime := before.yieldTPrime(now); tPrime.IsZero() {
+				// while t is one, the yield curve's limit is the product curve
+				kBefore := productK(before.AmountBase, before.AmountQuote)
+				kAfter := productK(base, quote)
+				if kAfter.Cmp(kBefore) < 0 {
+					violate(InvariantYieldK, "k decreased from %s to %s", kBefore, kAfter)
+				}
+			} else {
+				kBefore, errBefore := calculateK(before.AmountBase, before.AmountQuote, tPrime)
+				kAfter, errAfter := calculateK(base, quote, tPrime)
+				if errBefore == nil && errAfter == nil && kAfter.Less(kBefore) {
+					violate(InvariantYieldK, "k decreased from %s to %s", kBefore, kAfter)
+				}
+			}
+		}
+	}
+
+	if before.SettledAt != 0 && after.SettledAt != before.SettledAt {
+		violate(InvariantSettled, "settled at changed from %d to %d", before.SettledAt, after.SettledAt)
+	}
+	if before.AmountShares != after.AmountShares && before.AmountShares != 0 && after.AmountShares != 0 {
+		// amountAfter / sharesAfter >= amountBefore / sharesBefore, without dividing. The amount is the reserve,
+		// and then the reserve with the collected fees, so that new shares pay for their part of the fees.
+		decreased := func(amountBefore, amountAfter *big.Int) bool {
+			perShareBefore := math.Mul(amountBefore, new(big.Int).SetUint64(after.AmountShares))
+			perShareAfter := math.Mul(amountAfter, new(big.Int).SetUint64(before.AmountShares))
+			return perShareAfter.Cmp(perShareBefore) < 0
+		}
+		for _, asset := range []struct {
+			id                    string
+			before, after         uint64
+			feesBefore, feesAfter uint64
+		}{
+			{before.BaseAsset, before.AmountBase, after.AmountBase, before.FeesCollectedBase, after.FeesCollectedBase},
+			{
+				before.QuoteAsset, before.AmountQuote, after.AmountQuote,
+				before.FeesCollectedQuote, after.FeesCollectedQuote,
+			},
+		} {
+			amountBefore, amountAfter := new(big.Int).SetUint64(asset.before), new(big.Int).SetUint64(asset.after)
+			if decreased(amountBefore, amountAfter) {
+				violate(InvariantShareValue, "%s per share decreased from %d/%d to %d/%d",
+					asset.id, asset.before, before.AmountShares, asset.after, after.AmountShares)
+				continue
+			}
+			amountBefore.Add(amountBefore, new(big.Int).SetUint64(asset.feesBefore))
+			amountAfter.Add(amountAfter, new(big.Int).SetUint64(asset.feesAfter))
+			if decreased(amountBefore, amountAfter) {
+				violate(InvariantShareValue, "%s with fees per share decreased from %s/%d to %s/%d",
+					asset.id, amountBefore, before.AmountShares, amountAfter, after.AmountShares)
+			}
+		}
+	}
+	return violations
+}
+
+// productK returns x * y.
+func productK(x, y uint64) *big.Int {
+	return math.Mul(new(big.Int).SetUint64(x), new(big.Int).SetUint64(y))
+}
+
+// yieldTPrime returns the yield curve's exponent 1 - t at a specific time, without fees.
+func (p *Pool) yieldTPrime(now time.Time) decimal.Decimal {
+	tPrime, _ := decimal.One.Sub(calculateT(now.Unix(), p.MaturityAt, p.Duration()))
+	return tPrime
+}
@@ -0,0 +1,160 @@
+package types_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/require"
+
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func invariants(violations []types.InvariantViolation) []string {
+	var names []string
+	for _, v := range violations {
+		names = append(names, v.Invariant)
+	}
+	return names
+}
+
+func TestPool_CheckInvariants(t *testing.T) {
+	require := require.New(t)
+
+	pool := productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000)
+	require.Empty(pool.CheckInvariants(goldenNow))
+	require.Empty(productPool(consts.BondID, consts.StableID, 0, 0).CheckInvariants(goldenNow))
+
+	noShares := *pool
+	noShares.AmountShares = 0
+	require.Equal([]string{types.InvariantSharesReserves}, invariants(noShares.CheckInvariants(goldenNow)))
+
+	drained := *pool
+	drained.AmountQuote = 0
+	require.Equal([]string{types.InvariantSharesReserves}, invariants(drained.CheckInvariants(goldenNow)))
+
+	poolShare := productPool(ltypes.NewPoolShareID(consts.BondID, consts.StableID).String(), consts.StableID, 1, 1)
+	require.Equal([]string{types.InvariantAssets}, invariants(poolShare.CheckInvariants(goldenNow)))
+
+	yield := goldenPool(false, 1_000_000, 950_000, "1.02", "0.5")
+	yield.AmountShares = 1_950_000
+	require.Empty(yield.CheckInvariants(goldenNow))
+	yield.MaturityAt = yield.CreatedAt
+	require.Equal([]string{types.InvariantYieldCurve}, invariants(yield.CheckInvariants(goldenNow)))
+}
+
+func TestCheckTransition(t *testing.T) {
+	require := require.New(t)
+
+	// operations never violate the invariants
+	pool := productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000)
+	before := *pool
+	_, err := pool.ExecuteSwapAt(ltypes.NewBalance(consts.StableID, int64(10_000)), nil, goldenNow, goldenNow)
+	require.NoError(err)
+	require.Empty(types.CheckTransition(&before, pool, goldenNow))
+
+	before = *pool
+	_, _, err = pool.AddLiquidity(ltypes.NewAmount(consts.BondID, 333))
+	require.NoError(err)
+	require.Empty(types.CheckTransition(&before, pool, goldenNow))
+
+	before = *pool
+	_, err = pool.RemoveLiquidity(ltypes.NewAmount(pool.PoolID, 777))
+	require.NoError(err)
+	require.Empty(types.CheckTransition(&before, pool, goldenNow))
+
+	// yield pool swaps hold k only while the pool holds less base than quote
+	for _, reserves := range [][2]uint64{{1_000_000, 950_000}, {950_000, 1_000_000}} {
+		for _, assetIn := range []string{"b", "q"} {
+			for _, tParam := range []string{"1", "0.5", "0.1"} {
+				yield := goldenPool(false, reserves[0], reserves[1], "1.02", tParam)
+				yield.AmountShares = 1_950_000
+				before := *yield
+				receipt, err := yield.ExecuteSwapAt(ltypes.NewBalance(assetIn, int64(25_000)), nil, goldenNow, goldenNow)
+				require.NoError(err)
+				name := fmt.Sprintf("%v %s %s", reserves, assetIn, tParam)
+				if reserves[0] > reserves[1] {
+					// the fee curve prices these swaps above the fee-free curve, so they collect no fee
+					require.Zero(receipt.Fee.Amount, name)
+					require.Equal(
+						[]string{types.InvariantYieldK},
+						invariants(types.CheckTransition(&before, yield, goldenNow)),
+						name,
+					)
+					continue
+				}
+				require.Positive(receipt.Fee.Amount, name)
+				require.Empty(types.CheckTransition(&before, yield, goldenNow), name)
+			}
+		}
+	}
+
+	yield := goldenPool(false, 1_000_000, 950_000, "1.02", "0.5")
+	yield.AmountShares = 1_950_000
+	before = *yield
+	_, err = yield.ExecuteSwapAt(ltypes.NewBalance("q", int64(25_000)), nil, goldenNow, goldenNow)
+	require.NoError(err)
+
+	// corrupt transitions
+	before = *pool
+	after := *pool
+	after.Sequence--
+	require.Equal([]string{types.InvariantSequence}, invariants(types.CheckTransition(&before, &after, goldenNow)))
+
+	after = *pool
+	after.AmountBase--
+	require.Equal(
+		[]string{types.InvariantSequence, types.InvariantConstantProduct},
+		invariants(types.CheckTransition(&before, &after, goldenNow)),
+	)
+
+	after = *pool
+	after.AmountShares++
+	after.Sequence++
+	require.Equal(
+		[]string{types.InvariantShareValue, types.InvariantShareValue},
+		invariants(types.CheckTransition(&before, &after, goldenNow)),
+	)
+
+	// shares added on the reserves alone take part of the collected fees
+	before = *pool
+	before.FeesCollectedQuote = 10_000
+	after = before
+	after.AmountShares += 20_000
+	after.AmountBase += 10_000
+	after.AmountQuote += 10_000
+	after.Sequence++
+	require.Equal([]string{types.InvariantShareValue}, invariants(types.CheckTransition(&before, &after, goldenNow)))
+
+	before = *yield
+	after = *yield
+	after.AmountQuote -= 100
+	after.Sequence++
+	require.Equal([]string{types.InvariantYieldK}, invariants(types.CheckTransition(&before, &after, goldenNow)))
+
+	// fees collected by a swap count towards k, fees already collected do not
+	after = *yield
+	after.AmountQuote -= 100
+	after.FeesCollectedQuote += 100
+	after.Sequence++
+	require.Empty(types.CheckTransition(&before, &after, goldenNow))
+
+	before.FeesCollectedQuote = 100
+	after = before
+	after.AmountQuote -= 100
+	after.Sequence++
+	require.Equal([]string{types.InvariantYieldK}, invariants(types.CheckTransition(&before, &after, goldenNow)))
+
+	before = *yield
+	after = *yield
+	after.MaturityAt++
+	require.Equal([]string{types.InvariantImmutable}, invariants(types.CheckTransition(&before, &after, goldenNow)))
+	// parameters are compared by value, not by representation
+	after = *yield
+	after.FeeFactor = decimal.MustParse("1.020")
+	require.Empty(types.CheckTransition(&before, &after, goldenNow))
+	after.FeeFactor = decimal.MustParse("1.03")
+	require.Equal([]string{types.InvariantImmutable}, invariants(types.CheckTransition(&before, &after, goldenNow)))
+}
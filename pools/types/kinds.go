@@ -0,0 +1,369 @@
+package types
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/govalues/decimal"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/math"
+	mdecimal "github.com/dora-network/dora-service-utils/math/decimal"
+)
+
+// PoolKind discriminates the curves pools swap on.
+type PoolKind string
+
+const (
+	// PoolKindProduct pools swap on the constant product x * y = k.
+	PoolKindProduct PoolKind = "product"
+	// PoolKindYield pools swap on the yield curve x^t' + y^t' = k, whose t' depends on the time to maturity.
+	PoolKindYield PoolKind = "yield"
+	// PoolKindWeighted pools swap on the weighted product x^w * y^(1-w) = k, where w is the pool's WeightBase.
+	PoolKindWeighted PoolKind = "weighted"
+	// PoolKindStable pools swap on the stable-swap invariant of the Curve whitepaper, with the pool's
+	// Amplification, which prices close to 1:1 while the reserves are balanced.
+	PoolKindStable PoolKind = "stable"
+)
+
+// maxAmplification bounds stable pools' amplification, beyond which the invariant no longer converges quickly.
+const maxAmplification = 1_000_000
+
+// Invariant is a pool kind's curve, which SimulateSwap and the first AddLiquidity dispatch to. Liquidity is
+// otherwise added and removed in proportion to the reserves, whatever the pool's kind.
+type Invariant interface {
+	// SimulateSwap returns the amount out and fee of swapping balanceIn at a specific time, see Pool.SimulateSwap.
+	SimulateSwap(p *Pool, balanceIn *types.Balance, now time.Time) (balanceOut, balanceFee *types.Balance, err error)
+	// InitialShares returns the shares created by depositing base and quote into an empty pool.
+	InitialShares(p *Pool, base, quote uint64) (uint64, error)
+	// Validate returns an error if the pool's parameters are invalid for its kind.
+	Validate(p *Pool) error
+}
+
+// Kind returns the pool's kind. Pools stored before pools had kinds are product or yield pools, according to
+// IsProductPool.
+func (p *Pool) Kind() PoolKind {
+	if p.PoolKind != "" {
+		return p.PoolKind
+	}
+	if p.IsProductPool {
+		return PoolKindProduct
+	}
+	return PoolKindYield
+}
+
+// validateKind requires the pool's kind to agree with IsProductPool, which pools stored before pools had kinds
+// are read by.
+func (p *Pool) validateKind() error {
+	if p.PoolKind != "" && (p.PoolKind == PoolKindProduct) != p.IsProductPool {
+		return errors.Data(
+			"pool %s has kind %s but is product pool %t", p.PoolID, p.PoolKind, p.IsProductPool,
+		)
+	}
+	return nil
+}
+
+// Invariant returns the pool's curve. Error ErrInvalidPoolType if the pool's kind is not supported.
+func (p *Pool) Invariant() (Invariant, error) {
+	switch p.Kind() {
+	case PoolKindProduct:
+		return productInvariant{}, nil
+	case PoolKindYield:
+		return yieldInvariant{}, nil
+	case PoolKindWeighted:
+		return weightedInvariant{}, nil
+	case PoolKindStable:
+		return stableInvariant{}, nil
+	default:
+		return nil, errors.ErrInvalidPoolType
+	}
+}
+
+type productInvariant struct{}
+
+func (productInvariant) SimulateSwap(p *Pool, balanceIn *types.Balance, _ time.Time) (*types.Balance, *types.Balance, error) {
+	return p.simulateProductPoolSwap(balanceIn)
+}
+
+func (productInvariant) InitialShares(_ *Pool, base, quote uint64) (uint64, error) {
+	return math.CheckedAddU64(base, quote)
+}
+
+func (productInvariant) Validate(p *Pool) error {
+	return validateFeeFraction(p)
+}
+
+type yieldInvariant struct{}
+
+func (yieldInvariant) SimulateSwap(p *Pool, balanceIn *types.Balance, now time.Time) (*types.Balance, *types.Balance, error) {
+	return p.simulateYieldPoolSwap(balanceIn, now)
+}
+
+func (yieldInvariant) InitialShares(_ *Pool, base, quote uint64) (uint64, error) {
+	return math.CheckedAddU64(base, quote)
+}
+
+func (yieldInvariant) Validate(p *Pool) error {
+	if p.MaturityAt <= p.CreatedAt {
+		return errors.Data("yield pool %s matures at %d, before it is created at %d", p.PoolID, p.MaturityAt, p.CreatedAt)
+	}
+	if !p.FeeFactor.IsPos() {
+		return errors.Data("yield pool %s has non-positive fee factor %s", p.PoolID, p.FeeFactor)
+	}
+	return nil
+}
+
+type weightedInvariant struct{}
+
+// SimulateSwap returns amountOut := floor(reserveOut * (1 - (reserveIn / (reserveIn + amountInAfterFee))^(wIn/wOut))).
+func (weightedInvariant) SimulateSwap(p *Pool, balanceIn *types.Balance, _ time.Time) (*types.Balance, *types.Balance, error) {
+	if !balanceIn.Valid() {
+		return nil, nil, errors.New(errors.InvalidInputError, "invalid balance")
+	}
+	if balanceIn.IsZero() {
+		return nil, nil, errors.ErrAmountCannotBeZero
+	}
+	reserveIn, reserveOut, err := p.Balances(balanceIn.Asset)
+	if err != nil {
+		return nil, nil, err
+	}
+	fee, err := p.swapFee(balanceIn.Amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	wIn, wOut, err := p.weights(balanceIn.Asset)
+	if err != nil {
+		return nil, nil, err
+	}
+	exponent, err := wIn.Quo(wOut)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inEnd, err := math.CheckedAddU64(reserveIn.Amount, balanceIn.Amount-fee)
+	if err != nil {
+		return nil, nil, err
+	}
+	ratio, err := quoUint64(reserveIn.Amount, inEnd)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the part of the out reserve which remains is rounded up, so the amount out is rounded down
+	remains, err := ratio.Pow(exponent)
+	if err != nil {
+		return nil, nil, err
+	}
+	outD, err := mdecimal.FromUint64(reserveOut.Amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	outEndD, err := outD.Mul(remains)
+	if err != nil {
+		return nil, nil, err
+	}
+	outEnd, err := mdecimal.CeilUint64(outEndD)
+	if err != nil {
+		return nil, nil, err
+	}
+	amountOut, _ := math.CheckedSubU64ToZero(reserveOut.Amount, outEnd)
+
+	return types.NewBalance(reserveOut.Asset, int64(amountOut)), types.NewBalance(balanceIn.Asset, int64(fee)), nil
+}
+
+func (weightedInvariant) InitialShares(_ *Pool, base, quote uint64) (uint64, error) {
+	return math.CheckedAddU64(base, quote)
+}
+
+func (weightedInvariant) Validate(p *Pool) error {
+	if !p.WeightBase.IsPos() || !p.WeightBase.Less(decimal.One) {
+		return errors.Data("weighted pool %s has base weight %s, not between 0 and 1", p.PoolID, p.WeightBase)
+	}
+	return validateFeeFraction(p)
+}
+
+type stableInvariant struct{}
+
+// SimulateSwap returns amountOut := reserveOut - y(reserveIn + amountInAfterFee) - 1, where y keeps the
+// invariant D constant. The 1 rounds the amount out down, in the pool's favour.
+func (stableInvariant) SimulateSwap(p *Pool, balanceIn *types.Balance, _ time.Time) (*types.Balance, *types.Balance, error) {
+	if !balanceIn.Valid() {
+		return nil, nil, errors.New(errors.InvalidInputError, "invalid balance")
+	}
+	if balanceIn.IsZero() {
+		return nil, nil, errors.ErrAmountCannotBeZero
+	}
+	reserveIn, reserveOut, err := p.Balances(balanceIn.Asset)
+	if err != nil {
+		return nil, nil, err
+	}
+	fee, err := p.swapFee(balanceIn.Amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	inEnd, err := math.CheckedAddU64(reserveIn.Amount, balanceIn.Amount-fee)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d, err := stableD(reserveIn.Amount, reserveOut.Amount, p.Amplification)
+	if err != nil {
+		return nil, nil, err
+	}
+	outEnd, err := stableY(new(big.Int).SetUint64(inEnd), d, p.Amplification)
+	if err != nil {
+		return nil, nil, err
+	}
+	amountOut := new(big.Int).Sub(new(big.Int).SetUint64(reserveOut.Amount), outEnd)
+	amountOut.Sub(amountOut, big.NewInt(1))
+	if amountOut.Sign() < 0 {
+		amountOut.SetInt64(0)
+	}
+
+	return types.NewBalance(reserveOut.Asset, amountOut.Int64()), types.NewBalance(balanceIn.Asset, int64(fee)), nil
+}
+
+// InitialShares returns the invariant D of the first deposit, which is base + quote for a balanced deposit.
+func (stableInvariant) InitialShares(p *Pool, base, quote uint64) (uint64, error) {
+	d, err := stableD(base, quote, p.Amplification)
+	if err != nil {
+		return 0, err
+	}
+	if !d.IsUint64() {
+		return 0, errors.Data("InitialShares: shares overflow")
+	}
+	return d.Uint64(), nil
+}
+
+func (stableInvariant) Validate(p *Pool) error {
+	if p.Amplification == 0 || p.Amplification > maxAmplification {
+		return errors.Data(
+			"stable pool %s has amplification %d, not between 1 and %d", p.PoolID, p.Amplification, maxAmplification,
+		)
+	}
+	return validateFeeFraction(p)
+}
+
+// validateFeeFraction requires the pool's fee factor to be a fraction of the amount in, from 0 up to 1.
+func validateFeeFraction(p *Pool) error {
+	if p.FeeFactor.IsNeg() || !p.FeeFactor.Less(decimal.One) {
+		return errors.Data("%s pool %s has fee factor %s, not between 0 and 1", p.Kind(), p.PoolID, p.FeeFactor)
+	}
+	return nil
+}
+
+// swapFee returns fee := ceil(amountIn * feeFactor) for pools whose fee factor is a fraction of the amount in.
+// Error ErrInsufficientBalance if the fee is the whole amount in.
+func (p *Pool) swapFee(amountIn uint64) (uint64, error) {
+	amtIn, err := mdecimal.FromUint64(amountIn)
+	if err != nil {
+		return 0, err
+	}
+	feeD, err := amtIn.Mul(p.FeeFactor)
+	if err != nil {
+		return 0, err
+	}
+	fee, err := mdecimal.CeilUint64(feeD)
+	if err != nil {
+		return 0, err
+	}
+	if fee >= amountIn {
+		return 0, errors.ErrInsufficientBalance
+	}
+	return fee, nil
+}
+
+// weights returns the weights of an asset in a weighted pool and of the other asset.
+func (p *Pool) weights(assetIn string) (wIn, wOut decimal.Decimal, err error) {
+	wQuote, err := decimal.One.Sub(p.WeightBase)
+	if err != nil {
+		return decimal.Decimal{}, decimal.Decimal{}, err
+	}
+	switch assetIn {
+	case p.BaseAsset:
+		return p.WeightBase, wQuote, nil
+	case p.QuoteAsset:
+		return wQuote, p.WeightBase, nil
+	default:
+		return decimal.Decimal{}, decimal.Decimal{}, errors.ErrAssetNotFoundInPool
+	}
+}
+
+// weightedK returns x^w * y^(1-w), where w is the pool's base weight.
+func (p *Pool) weightedK(x, y uint64) (decimal.Decimal, error) {
+	wBase, wQuote, err := p.weights(p.BaseAsset)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	xw, err := powUint64(x, wBase)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	yw, err := powUint64(y, wQuote)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	return xw.Mul(yw)
+}
+
+// stableD returns the stable-swap invariant D of two reserves x and y, with ann := 4A, by Newton's method:
+// 4A(x + y) + D = 4AD + D^3 / 4xy.
+func stableD(x, y, amplification uint64) (*big.Int, error) {
+	if x == 0 || y == 0 {
+		return nil, errors.ErrNotEnoughPoolReserves
+	}
+	if amplification == 0 {
+		return nil, errors.ErrInvalidPoolType
+	}
+	xI, yI := new(big.Int).SetUint64(x), new(big.Int).SetUint64(y)
+	ann := math.Mul(new(big.Int).SetUint64(amplification), big.NewInt(4))
+	sum := new(big.Int).Add(xI, yI)
+	annSum := math.Mul(ann, sum)
+	annMinusOne := new(big.Int).Sub(ann, big.NewInt(1))
+
+	d := new(big.Int).Set(sum)
+	for i := 0; i < 255; i++ {
+		// dP := D^3 / 4xy
+		dP := new(big.Int).Set(d)
+		dP.Quo(math.Mul(dP, d), math.Mul(xI, big.NewInt(2)))
+		dP.Quo(math.Mul(dP, d), math.Mul(yI, big.NewInt(2)))
+		// D := (ann * S + 2 dP) * D / ((ann - 1) * D + 3 dP)
+		num := math.Mul(new(big.Int).Add(annSum, math.Mul(dP, big.NewInt(2))), d)
+		den := new(big.Int).Add(math.Mul(annMinusOne, d), math.Mul(dP, big.NewInt(3)))
+		prev := d
+		d = new(big.Int).Quo(num, den)
+		if new(big.Int).Abs(new(big.Int).Sub(d, prev)).Cmp(big.NewInt(1)) <= 0 {
+			return d, nil
+		}
+	}
+	return nil, errors.Data("stableD: invariant did not converge")
+}
+
+// stableY returns the reserve y which keeps the stable-swap invariant D with the other reserve x, rounded up,
+// by Newton's method on y^2 + (x + D/ann - D)y = D^3 / (4x * ann).
+func stableY(x, d *big.Int, amplification uint64) (*big.Int, error) {
+	if x.Sign() <= 0 {
+		return nil, errors.ErrNotEnoughPoolReserves
+	}
+	ann := math.Mul(new(big.Int).SetUint64(amplification), big.NewInt(4))
+	// c := D^3 / (4x * ann), b := x + D / ann
+	c := new(big.Int).Quo(math.Mul(d, d), math.Mul(x, big.NewInt(2)))
+	c.Quo(math.Mul(c, d), math.Mul(ann, big.NewInt(2)))
+	b := new(big.Int).Add(x, new(big.Int).Quo(d, ann))
+
+	y := new(big.Int).Set(d)
+	for i := 0; i < 255; i++ {
+		// y := (y^2 + c) / (2y + b - D)
+		num := new(big.Int).Add(math.Mul(y, y), c)
+		den := new(big.Int).Sub(new(big.Int).Add(math.Mul(y, big.NewInt(2)), b), d)
+		if den.Sign() <= 0 {
+			return nil, errors.ErrNotEnoughPoolReserves
+		}
+		prev := y
+		y = math.DivI(num, den, true)
+		if new(big.Int).Abs(new(big.Int).Sub(y, prev)).Cmp(big.NewInt(1)) <= 0 {
+			return y, nil
+		}
+	}
+	return nil, errors.Data("stableY: invariant did not converge")
+}
@@ -0,0 +1,162 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func kindPool(kind types.PoolKind, amountBase, amountQuote uint64) *types.Pool {
+	p := productPool(consts.BondID, consts.StableID, amountBase, amountQuote)
+	p.IsProductPool = false
+	p.PoolKind = kind
+	p.WeightBase = decimal.MustParse("0.5")
+	p.Amplification = 100
+	return p
+}
+
+func TestPool_Kind(t *testing.T) {
+	require := require.New(t)
+
+	// pools stored before pools had kinds
+	require.Equal(types.PoolKindProduct, productPool(consts.BondID, consts.StableID, 1, 1).Kind())
+	require.Equal(types.PoolKindYield, goldenPool(false, 1, 1, "1.02", "0.5").Kind())
+	require.Equal(types.PoolKindStable, kindPool(types.PoolKindStable, 1, 1).Kind())
+
+	unknown := kindPool("other", 1_000_000, 1_000_000)
+	_, err := unknown.Invariant()
+	require.ErrorIs(err, errors.ErrInvalidPoolType)
+	_, _, err = unknown.SimulateSwap(ltypes.NewBalance(consts.BondID, uint64(1_000)))
+	require.ErrorIs(err, errors.ErrInvalidPoolType)
+	_, _, err = unknown.AddLiquidity(ltypes.NewAmount(consts.BondID, 1_000))
+	require.ErrorIs(err, errors.ErrInvalidPoolType)
+	_, err = unknown.RemoveLiquidity(ltypes.NewAmount(unknown.PoolID, 1_000))
+	require.ErrorIs(err, errors.ErrInvalidPoolType)
+	require.Equal(types.InvariantKind, unknown.CheckInvariants(goldenNow)[0].Invariant)
+	require.ErrorIs(unknown.Validate(), errors.ErrInvalidPoolType)
+	require.NoError(goldenPool(false, 1, 1, "1.02", "0.5").Validate())
+}
+
+func TestPool_KindValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		mutate  func(p *types.Pool)
+		wantErr bool
+	}{
+		"weighted": {mutate: func(p *types.Pool) { p.PoolKind = types.PoolKindWeighted }},
+		"weighted zero weight": {
+			mutate:  func(p *types.Pool) { p.PoolKind, p.WeightBase = types.PoolKindWeighted, decimal.Zero },
+			wantErr: true,
+		},
+		"weighted whole weight": {
+			mutate:  func(p *types.Pool) { p.PoolKind, p.WeightBase = types.PoolKindWeighted, decimal.One },
+			wantErr: true,
+		},
+		"stable": {mutate: func(p *types.Pool) { p.PoolKind = types.PoolKindStable }},
+		"stable no amplification": {
+			mutate:  func(p *types.Pool) { p.PoolKind, p.Amplification = types.PoolKindStable, 0 },
+			wantErr: true,
+		},
+		"stable large amplification": {
+			mutate:  func(p *types.Pool) { p.PoolKind, p.Amplification = types.PoolKindStable, 1<<40 },
+			wantErr: true,
+		},
+		"stable whole fee": {
+			mutate:  func(p *types.Pool) { p.PoolKind, p.FeeFactor = types.PoolKindStable, decimal.One },
+			wantErr: true,
+		},
+		"product": {mutate: func(p *types.Pool) { p.PoolKind, p.IsProductPool = types.PoolKindProduct, true }},
+		"product not product pool": {
+			mutate:  func(p *types.Pool) { p.PoolKind = types.PoolKindProduct },
+			wantErr: true,
+		},
+		"weighted product pool": {
+			mutate:  func(p *types.Pool) { p.PoolKind, p.IsProductPool = types.PoolKindWeighted, true },
+			wantErr: true,
+		},
+		"unknown": {mutate: func(p *types.Pool) { p.PoolKind = "other" }, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := kindPool("", 1_000_000, 1_000_000)
+			tc.mutate(p)
+			if tc.wantErr {
+				require.Error(t, p.Validate())
+				require.NotEmpty(t, p.CheckInvariants(goldenNow))
+			} else {
+				require.NoError(t, p.Validate())
+				require.Empty(t, p.CheckInvariants(goldenNow))
+			}
+		})
+	}
+}
+
+func TestPool_KindSwaps(t *testing.T) {
+	require := require.New(t)
+
+	product := productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000)
+	weighted := kindPool(types.PoolKindWeighted, 1_000_000, 1_000_000)
+	stable := kindPool(types.PoolKindStable, 1_000_000, 1_000_000)
+
+	in := ltypes.NewBalance(consts.BondID, uint64(100_000))
+	productOut, productFee, err := product.SimulateSwap(in)
+	require.NoError(err)
+	// with equal weights the weighted product is the constant product
+	weightedOut, weightedFee, err := weighted.SimulateSwap(in)
+	require.NoError(err)
+	require.Equal(productFee, weightedFee)
+	require.InDelta(productOut.Amount, weightedOut.Amount, 1)
+	// the stable pool prices close to 1:1, with much less impact
+	stableOut, stableFee, err := stable.SimulateSwap(in)
+	require.NoError(err)
+	require.Equal(productFee, stableFee)
+	require.Greater(stableOut.Amount, productOut.Amount)
+	require.Greater(stableOut.Amount, uint64(99_000))
+	require.Less(stableOut.Amount, in.Amount-stableFee.Amount)
+
+	// heavier base weight makes the quote reserve cheaper to buy
+	weighted.WeightBase = decimal.MustParse("0.8")
+	heavyOut, _, err := weighted.SimulateSwap(in)
+	require.NoError(err)
+	require.Greater(heavyOut.Amount, weightedOut.Amount)
+
+	for _, pool := range []*types.Pool{weighted, stable} {
+		for _, balanceIn := range []*ltypes.Balance{in, ltypes.NewBalance(consts.StableID, uint64(250_000))} {
+			before := *pool
+			_, err := pool.ExecuteSwapAt(balanceIn, nil, goldenNow, goldenNow)
+			require.NoError(err)
+			require.Empty(types.CheckTransition(&before, pool, goldenNow))
+			require.Empty(pool.CheckInvariants(goldenNow))
+		}
+	}
+}
+
+func TestPool_KindLiquidity(t *testing.T) {
+	require := require.New(t)
+
+	// the first deposit into a stable pool mints the invariant D, which is base + quote for a balanced deposit
+	stable := kindPool(types.PoolKindStable, 0, 0)
+	stable.AmountShares = 0
+	stable.InitialAssetsRatio = decimal.One
+	quoteIn, sharesOut, err := stable.AddLiquidity(ltypes.NewAmount(consts.BondID, 1_000_000))
+	require.NoError(err)
+	require.Equal(uint64(1_000_000), quoteIn.Amount)
+	require.Equal(uint64(2_000_000), sharesOut.Amount)
+
+	// later deposits and withdrawals are proportional to the reserves
+	before := *stable
+	_, sharesOut, err = stable.AddLiquidity(ltypes.NewAmount(consts.BondID, 500_000))
+	require.NoError(err)
+	require.Equal(uint64(1_000_000), sharesOut.Amount)
+	out, err := stable.RemoveLiquidity(sharesOut)
+	require.NoError(err)
+	require.Equal(uint64(500_000), out[0].Amount)
+	require.Equal(uint64(500_000), out[1].Amount)
+	require.Equal(before.AmountShares, stable.AmountShares)
+	require.Equal(before.AmountBase, stable.AmountBase)
+	require.Equal(before.AmountQuote, stable.AmountQuote)
+}
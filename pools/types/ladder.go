@@ -0,0 +1,89 @@
+package types
+
+import (
+	gmath "math"
+	"time"
+
+	"github.com/govalues/decimal"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+)
+
+// LadderQuote is the quote for one trade size of a QuoteLadder.
+type LadderQuote struct {
+	AmountIn  *types.Balance `json:"amount_in"`
+	AmountOut *types.Balance `json:"amount_out"`
+	Fee       *types.Balance `json:"fee"`
+	// Price the swap executes at, fee included, in base per quote like Pool.Price
+	Price float64 `json:"price"`
+	// ImpactPercent is how much worse than the spot price the swap executes at, in percent
+	ImpactPercent float64 `json:"impact_percent"`
+}
+
+// QuoteLadder quotes swapping each of several amounts of assetIn for the pool's other asset, without mutating
+// the pool, so that the price impact of different trade sizes can be compared. Impact is relative to the pool's
+// spot price, see Pool.Price. Error if any size cannot be quoted.
+func (p *Pool) QuoteLadder(assetIn string, sizes []uint64) ([]LadderQuote, error) {
+	return p.QuoteLadderAt(assetIn, sizes, time.Now())
+}
+
+// QuoteLadderAt is QuoteLadder at a specific time.
+func (p *Pool) QuoteLadderAt(assetIn string, sizes []uint64, now time.Time) ([]LadderQuote, error) {
+	if _, err := p.OtherAssetID(assetIn); err != nil {
+		return nil, err
+	}
+	spot, err := p.priceAt(now)
+	if err != nil {
+		return nil, err
+	}
+	if !spot.IsPos() {
+		return nil, errors.ErrNotEnoughPoolReserves
+	}
+
+	ladder := make([]LadderQuote, len(sizes))
+	for i, size := range sizes {
+		if size > gmath.MaxInt64 {
+			return nil, errors.Data("QuoteLadder: size %d is too large", size)
+		}
+		in := types.NewBalance(assetIn, int64(size))
+		out, fee, err := p.SimulateSwapAt(in, now)
+		if err != nil {
+			return nil, err
+		}
+		if out.IsZero() {
+			return nil, errors.ErrNotEnoughAmountIn
+		}
+
+		// price and impact := (price / spot - 1) * 100 buying quote, or (1 - price / spot) * 100 selling it
+		var price, impact decimal.Decimal
+		if assetIn == p.BaseAsset {
+			price, err = quoUint64(in.Amount, out.Amount)
+		} else {
+			price, err = quoUint64(out.Amount, in.Amount)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ratio, err := price.Quo(spot)
+		if err != nil {
+			return nil, err
+		}
+		if assetIn == p.BaseAsset {
+			impact, err = ratio.Sub(decimal.One)
+		} else {
+			impact, err = decimal.One.Sub(ratio)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if impact, err = impact.Mul(decimal.Hundred); err != nil {
+			return nil, err
+		}
+
+		ladder[i] = LadderQuote{AmountIn: in, AmountOut: out, Fee: fee}
+		ladder[i].Price, _ = price.Float64()
+		ladder[i].ImpactPercent, _ = impact.Float64()
+	}
+	return ladder, nil
+}
@@ -0,0 +1,50 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func TestPool_QuoteLadder(t *testing.T) {
+	sizes := []uint64{10_000, 50_000, 100_000, 500_000, 1_000_000}
+	for name, pool := range map[string]*types.Pool{
+		"product": productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000),
+		"yield":   goldenPool(false, 1_000_000, 950_000, "1.02", "0.5"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			before := *pool
+
+			for _, assetIn := range pool.AssetIDs() {
+				ladder, err := pool.QuoteLadderAt(assetIn, sizes, goldenNow)
+				require.NoError(err)
+				require.Len(ladder, len(sizes))
+				for i, q := range ladder {
+					// each rung is the swap's simulation
+					out, fee, err := pool.SimulateSwapAt(ltypes.NewBalance(assetIn, int64(sizes[i])), goldenNow)
+					require.NoError(err)
+					require.Equal(out, q.AmountOut)
+					require.Equal(fee, q.Fee)
+					// larger trades move the price further
+					if i > 0 {
+						require.Greater(q.ImpactPercent, ladder[i-1].ImpactPercent)
+					}
+				}
+				require.Less(ladder[0].ImpactPercent, 2.0)
+				require.Greater(ladder[len(ladder)-1].ImpactPercent, 10.0)
+			}
+			require.Equal(before, *pool)
+		})
+	}
+
+	pool := productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000)
+	_, err := pool.QuoteLadderAt("other", []uint64{100}, goldenNow)
+	require.Error(t, err)
+	_, err = pool.QuoteLadderAt(consts.BondID, []uint64{0}, goldenNow)
+	require.Error(t, err)
+}
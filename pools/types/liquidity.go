@@ -0,0 +1,308 @@
+package types
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/math"
+	mdecimal "github.com/dora-network/dora-service-utils/math/decimal"
+)
+
+// AddLiquidityQuote to a pool, based on the quote asset given. Pool is mutated.
+// It is AddLiquidity given the quote asset instead of the base asset.
+func (p *Pool) AddLiquidityQuote(quoteIn types.Amount) (
+	baseIn types.Amount,
+	sharesOut types.Amount,
+	err error,
+) {
+	if err = quoteIn.Validate(); err != nil {
+		return types.Amount{}, types.Amount{}, err
+	}
+	if quoteIn.IsZero() {
+		return types.Amount{}, types.Amount{}, errors.ErrAmountCannotBeZero
+	}
+	if quoteIn.AssetID != p.QuoteAsset {
+		return types.Amount{}, types.Amount{}, errors.ErrQuoteAssetMismatch
+	}
+	if p.SettledAt != 0 {
+		return types.Amount{}, types.Amount{}, errors.ErrPoolSettled
+	}
+	invariant, err := p.Invariant()
+	if err != nil {
+		return types.Amount{}, types.Amount{}, err
+	}
+
+	// Amounts in are rounded up and shares out are rounded down, in the pool's favour
+	var baseFee, quoteFee uint64
+	if p.AmountQuote == 0 {
+		if !p.InitialAssetsRatio.IsPos() {
+			return types.Amount{}, types.Amount{}, errors.Data("AddLiquidityQuote: pool has no initial assets ratio")
+		}
+		// Calculate base assets in := ceil(quoteIn / ratio)
+		quoteInD, err := mdecimal.FromUint64(quoteIn.Amount)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		baseInD, err := quoteInD.Quo(p.InitialAssetsRatio)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		baseInAmt, err := mdecimal.CeilUint64(baseInD)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		baseIn = types.NewAmount(p.BaseAsset, baseInAmt)
+		// Calculate shares out of floor(quoteIn / ratio) and quoteIn, see Invariant.InitialShares
+		baseInFloor, err := mdecimal.FloorUint64(baseInD)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		sharesOutAmt, err := invariant.InitialShares(p, baseInFloor, quoteIn.Amount)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		sharesOut = types.NewAmount(p.PoolID, sharesOutAmt)
+	} else {
+		// Shares are priced on the pool's reserves and collected fees, see proportionalIn
+		var baseReserve, sharesOutAmt uint64
+		quoteFee, baseReserve, baseFee, sharesOutAmt, err = p.proportionalIn(
+			quoteIn.Amount, p.AmountQuote, p.FeesCollectedQuote, p.AmountBase, p.FeesCollectedBase,
+		)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		baseInAmt, err := math.CheckedAddU64(baseReserve, baseFee)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		baseIn = types.NewAmount(p.BaseAsset, baseInAmt)
+		sharesOut = types.NewAmount(p.PoolID, sharesOutAmt)
+	}
+
+	// Mutate the pool
+	err = p.addLiquidity(sharesOut.Amount, baseIn.Amount-baseFee, quoteIn.Amount-quoteFee, baseFee, quoteFee)
+	if err != nil {
+		return types.Amount{}, types.Amount{}, err
+	}
+	p.Sequence++
+	return baseIn, sharesOut, nil
+}
+
+// AddLiquiditySingleSided adds liquidity to a pool from a single asset (zap-in), by swapping part of it for the
+// pool's other asset and adding both. The swap pays the pool's swap fee. Up to a few units of the other asset
+// may be left over, which stay in the pool. Pool is mutated, and left unchanged on error.
+// Error ErrNotEnoughLP if no shares, or fewer than minSharesOut shares, would be created.
+func (p *Pool) AddLiquiditySingleSided(amountIn types.Amount, minSharesOut uint64) (types.Amount, error) {
+	return p.AddLiquiditySingleSidedAt(amountIn, minSharesOut, time.Now())
+}
+
+// AddLiquiditySingleSidedAt is AddLiquiditySingleSided at a specific time.
+func (p *Pool) AddLiquiditySingleSidedAt(
+	amountIn types.Amount,
+	minSharesOut uint64,
+	now time.Time,
+) (types.Amount, error) {
+	if err := amountIn.Validate(); err != nil {
+		return types.Amount{}, err
+	}
+	if amountIn.IsZero() {
+		return types.Amount{}, errors.ErrAmountCannotBeZero
+	}
+	if amountIn.AssetID != p.BaseAsset && amountIn.AssetID != p.QuoteAsset {
+		return types.Amount{}, errors.ErrAssetNotFoundInPool
+	}
+	if p.AmountBase == 0 || p.AmountQuote == 0 {
+		// an empty pool has no price to swap at
+		return types.Amount{}, errors.ErrNotEnoughPoolReserves
+	}
+
+	// zap swaps part of the amount in, and adds the rest along with as much of the swap's output as it needs.
+	// Swapping more leaves less to add and gives more output, so the smallest swap whose output covers what
+	// the rest needs leaves the least over.
+	zap := func(swapAmt uint64) (*Pool, types.Amount, error) {
+		updated := *p
+		receipt, err := updated.ExecuteSwapAt(
+			types.NewBalance(amountIn.AssetID, int64(swapAmt)),
+			nil,
+			time.Time{},
+			now,
+		)
+		if err != nil {
+			return nil, types.Amount{}, err
+		}
+		rest := types.NewAmount(amountIn.AssetID, amountIn.Amount-swapAmt)
+		var otherIn, sharesOut types.Amount
+		if rest.AssetID == p.BaseAsset {
+			otherIn, sharesOut, err = updated.AddLiquidity(rest)
+		} else {
+			otherIn, sharesOut, err = updated.AddLiquidityQuote(rest)
+		}
+		if err != nil {
+			return nil, types.Amount{}, err
+		}
+		if otherIn.Amount > receipt.AmountOut.Amount {
+			return nil, types.Amount{}, errors.ErrNotEnoughAmountIn
+		}
+		// the left over output stays in the pool
+		if err = updated.addReserve(otherIn.AssetID, receipt.AmountOut.Amount-otherIn.Amount); err != nil {
+			return nil, types.Amount{}, err
+		}
+		return &updated, sharesOut, nil
+	}
+
+	// Binary search for the smallest swap which works, between swapping 1 and all but 1
+	if amountIn.Amount < 2 {
+		return types.Amount{}, errors.ErrNotEnoughAmountIn
+	}
+	lo, hi := uint64(0), amountIn.Amount-1
+	if _, _, err := zap(hi); err != nil {
+		return types.Amount{}, errors.ErrNotEnoughAmountIn
+	}
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if _, _, err := zap(mid); err == nil {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	updated, sharesOut, err := zap(hi)
+	if err != nil {
+		return types.Amount{}, err
+	}
+	if sharesOut.IsZero() || sharesOut.Amount < minSharesOut {
+		return types.Amount{}, errors.ErrNotEnoughLP
+	}
+	*p = *updated
+	return sharesOut, nil
+}
+
+// RemoveLiquiditySingleSided removes liquidity from a pool for a single asset, by removing both assets and
+// swapping the other one for assetOut. The swap pays the pool's swap fee. Amounts of the other asset too small
+// to swap stay in the pool. Pool is mutated, and left unchanged on error.
+// Error if less than minOut of assetOut would be removed, or if sharesIn are all of the pool's shares.
+func (p *Pool) RemoveLiquiditySingleSided(sharesIn types.Amount, assetOut string, minOut uint64) (
+	types.Amount,
+	error,
+) {
+	return p.RemoveLiquiditySingleSidedAt(sharesIn, assetOut, minOut, time.Now())
+}
+
+// RemoveLiquiditySingleSidedAt is RemoveLiquiditySingleSided at a specific time.
+func (p *Pool) RemoveLiquiditySingleSidedAt(
+	sharesIn types.Amount,
+	assetOut string,
+	minOut uint64,
+	now time.Time,
+) (types.Amount, error) {
+	otherAsset, err := p.OtherAssetID(assetOut)
+	if err != nil {
+		return types.Amount{}, err
+	}
+
+	updated := *p
+	amountsOut, err := updated.RemoveLiquidity(sharesIn)
+	if err != nil {
+		return types.Amount{}, err
+	}
+	if updated.AmountShares == 0 {
+		// nothing would be left to swap against
+		return types.Amount{}, errors.ErrNotEnoughPoolReserves
+	}
+	var amountOut, otherOut types.Amount
+	for _, a := range amountsOut {
+		if a.AssetID == assetOut {
+			amountOut = a
+		} else {
+			otherOut = a
+		}
+	}
+
+	if !otherOut.IsZero() {
+		swapIn := types.NewBalance(otherAsset, int64(otherOut.Amount))
+		swapOut, _, err := updated.SimulateSwapAt(swapIn, now)
+		if err != nil {
+			return types.Amount{}, err
+		}
+		if swapOut.IsZero() {
+			// too little to swap: it stays in the pool
+			if err = updated.addReserve(otherAsset, otherOut.Amount); err != nil {
+				return types.Amount{}, err
+			}
+		} else {
+			receipt, err := updated.ExecuteSwapAt(swapIn, nil, time.Time{}, now)
+			if err != nil {
+				return types.Amount{}, err
+			}
+			if amountOut.Amount, err = math.CheckedAddU64(amountOut.Amount, receipt.AmountOut.Amount); err != nil {
+				return types.Amount{}, err
+			}
+		}
+	}
+
+	if amountOut.Amount < minOut {
+		return types.Amount{}, errors.NewNotEnoughAmountOut(
+			types.NewAmount(assetOut, minOut).String(),
+			amountOut.String(),
+		)
+	}
+	*p = updated
+	return amountOut, nil
+}
+
+// proportionalIn prices adding amountIn of one of the pool's assets to a pool with reserves, as a portion of
+// the pool. The portion is amountIn / (reserveIn + feesIn), so the new shares pay for their part of the collected
+// fees as well as of the reserves, and claiming fees pays them back only what they paid for. Of amountIn, the
+// part of feesIn, rounded down, goes to the fees. The other asset in is the portion of its reserve and of its
+// fees, each rounded up, and shares out are the portion of the pool's shares, rounded down.
+func (p *Pool) proportionalIn(amountIn, reserveIn, feesIn, reserveOther, feesOther uint64) (
+	inFee, otherReserve, otherFee, sharesOut uint64,
+	err error,
+) {
+	amountInI := new(big.Int).SetUint64(amountIn)
+	totalInI := new(big.Int).Add(new(big.Int).SetUint64(reserveIn), new(big.Int).SetUint64(feesIn))
+	portion := func(amount uint64, roundUp bool) *big.Int {
+		return math.DivI(math.Mul(new(big.Int).SetUint64(amount), amountInI), totalInI, roundUp)
+	}
+	inFeeI := portion(feesIn, false)
+	otherReserveI := portion(reserveOther, true)
+	otherFeeI := portion(feesOther, true)
+	sharesOutI := portion(p.AmountShares, false)
+	if !otherReserveI.IsUint64() || !otherFeeI.IsUint64() || !sharesOutI.IsUint64() {
+		return 0, 0, 0, 0, errors.Data("proportionalIn: amounts overflow")
+	}
+	return inFeeI.Uint64(), otherReserveI.Uint64(), otherFeeI.Uint64(), sharesOutI.Uint64(), nil
+}
+
+// addLiquidity adds shares, reserves and collected fees to the pool, without changing the pool's sequence.
+func (p *Pool) addLiquidity(shares, base, quote, baseFee, quoteFee uint64) (err error) {
+	if p.AmountShares, err = math.CheckedAddU64(p.AmountShares, shares); err != nil {
+		return err
+	}
+	if p.AmountBase, err = math.CheckedAddU64(p.AmountBase, base); err != nil {
+		return err
+	}
+	if p.AmountQuote, err = math.CheckedAddU64(p.AmountQuote, quote); err != nil {
+		return err
+	}
+	if p.FeesCollectedBase, err = math.CheckedAddU64(p.FeesCollectedBase, baseFee); err != nil {
+		return err
+	}
+	p.FeesCollectedQuote, err = math.CheckedAddU64(p.FeesCollectedQuote, quoteFee)
+	return err
+}
+
+// addReserve adds to one of the pool's reserves, without creating shares or changing the pool's sequence.
+func (p *Pool) addReserve(assetID string, amount uint64) (err error) {
+	switch assetID {
+	case p.BaseAsset:
+		p.AmountBase, err = math.CheckedAddU64(p.AmountBase, amount)
+	case p.QuoteAsset:
+		p.AmountQuote, err = math.CheckedAddU64(p.AmountQuote, amount)
+	default:
+		err = errors.ErrAssetNotFoundInPool
+	}
+	return err
+}
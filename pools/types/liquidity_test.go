@@ -0,0 +1,121 @@
+package types_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+// requireKPerShareNotDecreased checks that x * y / shares^2 did not decrease, which holds for any sequence of
+// product pool swaps and liquidity changes.
+func requireKPerShareNotDecreased(t *testing.T, before, after *types.Pool) {
+	k := func(p *types.Pool, shares uint64) *big.Int {
+		x := new(big.Int).SetUint64(p.AmountBase)
+		y := new(big.Int).SetUint64(p.AmountQuote)
+		s := new(big.Int).SetUint64(shares)
+		return x.Mul(x, y).Mul(x, s).Mul(x, s)
+	}
+	require.GreaterOrEqual(t, k(after, before.AmountShares).Cmp(k(before, after.AmountShares)), 0)
+}
+
+func TestAddLiquidityQuote(t *testing.T) {
+	require := require.New(t)
+	p := productPool(consts.BondID, consts.StableID, 1_000, 10_000)
+
+	baseIn, sharesOut, err := p.AddLiquidityQuote(ltypes.NewAmount(consts.StableID, 1_001))
+	require.NoError(err)
+	require.Equal(ltypes.NewAmount(consts.BondID, 101), baseIn) // rounded up
+	require.Equal(ltypes.NewAmount(p.PoolID, 1_101), sharesOut) // rounded down
+	require.Equal(uint64(1_101), p.AmountBase)
+	require.Equal(uint64(11_001), p.AmountQuote)
+	require.Equal(uint64(12_101), p.AmountShares)
+
+	_, _, err = p.AddLiquidityQuote(ltypes.NewAmount(consts.BondID, 1_000))
+	require.ErrorIs(err, errors.ErrQuoteAssetMismatch)
+	_, _, err = p.AddLiquidityQuote(ltypes.NewAmount(consts.StableID, 0))
+	require.ErrorIs(err, errors.ErrAmountCannotBeZero)
+
+	fresh := productPool(consts.BondID, consts.StableID, 0, 0)
+	fresh.InitialAssetsRatio = decimal.MustParse("2")
+	baseIn, sharesOut, err = fresh.AddLiquidityQuote(ltypes.NewAmount(consts.StableID, 1_001))
+	require.NoError(err)
+	require.Equal(ltypes.NewAmount(consts.BondID, 501), baseIn)
+	require.Equal(ltypes.NewAmount(fresh.PoolID, 1_501), sharesOut)
+}
+
+func TestAddLiquiditySingleSided(t *testing.T) {
+	require := require.New(t)
+	p := productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000)
+	in := ltypes.NewAmount(consts.StableID, 10_000)
+
+	// slippage protection leaves the pool untouched
+	before := *p
+	_, err := p.AddLiquiditySingleSidedAt(in, 10_000, goldenNow)
+	require.ErrorIs(err, errors.ErrNotEnoughLP)
+	require.Equal(before, *p)
+
+	sharesOut, err := p.AddLiquiditySingleSidedAt(in, 9_900, goldenNow)
+	require.NoError(err)
+	require.Equal(p.PoolID, sharesOut.AssetID)
+	require.Less(sharesOut.Amount, uint64(10_000))
+	require.Equal(before.AmountShares+sharesOut.Amount, p.AmountShares)
+	// the base swapped out is all added back, along with anything left over
+	require.Equal(before.AmountBase, p.AmountBase)
+	require.Equal(before.AmountQuote+in.Amount-p.FeesCollectedQuote, p.AmountQuote)
+	require.Positive(p.FeesCollectedQuote)
+	requireKPerShareNotDecreased(t, &before, p)
+
+	_, err = p.AddLiquiditySingleSidedAt(ltypes.NewAmount(consts.StableID, 1), 0, goldenNow)
+	require.ErrorIs(err, errors.ErrNotEnoughAmountIn)
+	_, err = p.AddLiquiditySingleSidedAt(ltypes.NewAmount("other", 10_000), 0, goldenNow)
+	require.ErrorIs(err, errors.ErrAssetNotFoundInPool)
+	_, err = productPool(consts.BondID, consts.StableID, 0, 0).AddLiquiditySingleSidedAt(in, 0, goldenNow)
+	require.ErrorIs(err, errors.ErrNotEnoughPoolReserves)
+}
+
+func TestRemoveLiquiditySingleSided(t *testing.T) {
+	require := require.New(t)
+	p := productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000)
+	sharesIn := ltypes.NewAmount(p.PoolID, 100_000)
+
+	proportional := *p
+	amountsOut, err := proportional.RemoveLiquidity(sharesIn)
+	require.NoError(err)
+	swapOut, _, err := proportional.SimulateSwapAt(
+		ltypes.NewBalance(consts.BondID, int64(amountsOut[0].Amount)),
+		goldenNow,
+	)
+	require.NoError(err)
+	want := amountsOut[1].Amount + swapOut.Amount
+
+	// slippage protection leaves the pool untouched
+	before := *p
+	_, err = p.RemoveLiquiditySingleSidedAt(sharesIn, consts.StableID, want+1, goldenNow)
+	require.ErrorContains(err, errors.ErrNotEnoughAmountOut.Error())
+	require.Equal(before, *p)
+
+	amountOut, err := p.RemoveLiquiditySingleSidedAt(sharesIn, consts.StableID, want, goldenNow)
+	require.NoError(err)
+	require.Equal(ltypes.NewAmount(consts.StableID, want), amountOut)
+	require.Equal(before.AmountShares-sharesIn.Amount, p.AmountShares)
+	require.Equal(before.AmountBase, p.AmountBase+p.FeesCollectedBase)
+	require.Equal(before.AmountQuote-want, p.AmountQuote)
+	requireKPerShareNotDecreased(t, &before, p)
+
+	_, err = p.RemoveLiquiditySingleSidedAt(
+		ltypes.NewAmount(p.PoolID, p.AmountShares),
+		consts.StableID,
+		0,
+		goldenNow,
+	)
+	require.ErrorIs(err, errors.ErrNotEnoughPoolReserves)
+	_, err = p.RemoveLiquiditySingleSidedAt(sharesIn, "other", 0, goldenNow)
+	require.Error(err)
+}
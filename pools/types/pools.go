@@ -2,7 +2,6 @@ package types
 
 import (
 	"fmt"
-	gmath "math"
 	"math/big"
 	"sort"
 	"strings"
@@ -11,12 +10,14 @@ import (
 	"github.com/dora-network/dora-service-utils/errors"
 	"github.com/dora-network/dora-service-utils/ledger/types"
 	"github.com/dora-network/dora-service-utils/math"
+	mdecimal "github.com/dora-network/dora-service-utils/math/decimal"
 	"github.com/goccy/go-json"
 	"github.com/govalues/decimal"
 )
 
 const (
-	swapSimluateFraction float64 = 0.01
+	// Price simulates swapping 1/swapSimulateDivisor of each reserve
+	swapSimulateDivisor uint64 = 100
 )
 
 // Pool represents a liquidity pool in the DORA network.
@@ -37,6 +38,14 @@ type Pool struct {
 	InitialAssetsRatio decimal.Decimal `json:"initial_assets_ratio" redis:"initial_assets_ratio"`
 	DisplayName        string          `json:"display_name" redis:"display_name"`
 	Sequence           uint64          `json:"sequence" redis:"sequence"`
+	// SettledAt is the unix time a yield pool was settled at maturity, or zero if it has not been
+	SettledAt int64 `json:"settled_at" redis:"settled_at"`
+	// PoolKind is the curve the pool swaps on, see Kind. IsProductPool is only set for product pools
+	PoolKind PoolKind `json:"pool_kind" redis:"pool_kind"`
+	// WeightBase is a weighted pool's weight of the base asset, between 0 and 1; the quote asset weighs the rest
+	WeightBase decimal.Decimal `json:"weight_base" redis:"weight_base"`
+	// Amplification is a stable pool's amplification A, which flattens its curve around balanced reserves
+	Amplification uint64 `json:"amplification" redis:"amplification"`
 }
 
 func (p *Pool) MarshalBinary() ([]byte, error) {
@@ -144,18 +153,40 @@ func (p *Pool) OtherAssetIDFromSet(IDs []string) (IDout string, ok bool) {
 	return "", false
 }
 
+// Validate returns an error if the pool's assets are invalid, if its kind is not supported or contradicts
+// IsProductPool, or if its parameters are invalid for its kind, see Invariant.Validate.
 func (p *Pool) Validate() error {
+	if err := p.validateAssets(); err != nil {
+		return err
+	}
+	if err := p.validateKind(); err != nil {
+		return err
+	}
+	invariant, err := p.Invariant()
+	if err != nil {
+		return err
+	}
+	return invariant.Validate(p)
+}
+
+// validateAssets requires the pool's assets to be base assets which make a valid market.
+func (p *Pool) validateAssets() error {
 	base := p.BaseAsset
 	quote := p.QuoteAsset
-	if HasHyphen(base) || HasHyphen(quote) {
-		return errors.Data(
-			"cannot create pool where one asset is a pool share (%s-%s)",
-			base,
-			quote,
-		)
+	for _, id := range []string{base, quote} {
+		asset, err := types.ParseAssetID(id)
+		if err != nil {
+			return err
+		}
+		if !asset.IsBase() {
+			return errors.Data(
+				"cannot create pool where one asset is a pool share (%s-%s)",
+				base,
+				quote,
+			)
+		}
 	}
-	// TODO
-	return nil
+	return types.NewMarketID(base, quote).Validate()
 }
 
 // AddAmount to the pool. Error if asset ID is not one of the pool's assets.
@@ -201,6 +232,8 @@ func (p *Pool) SubAmount(amount types.Amount) error {
 }
 
 // AddLiquidity to a pool, based on the assets given. Pool is mutated.
+// Shares are priced on the pool's reserves and collected fees, and the part of the amounts in paying for the
+// fees goes to the collected fees.
 func (p *Pool) AddLiquidity(baseIn types.Amount) (
 	quoteIn types.Amount,
 	sharesOut types.Amount,
@@ -215,38 +248,61 @@ func (p *Pool) AddLiquidity(baseIn types.Amount) (
 	if baseIn.AssetID != p.BaseAsset {
 		return types.Amount{}, types.Amount{}, errors.ErrBaseAssetMismatch
 	}
+	if p.SettledAt != 0 {
+		return types.Amount{}, types.Amount{}, errors.ErrPoolSettled
+	}
+	invariant, err := p.Invariant()
+	if err != nil {
+		return types.Amount{}, types.Amount{}, err
+	}
 
-	// What portion of the pool is being added? For example, adding 20 to a pool of 100 results in 0.2 here
-	baseInF := new(big.Float).SetInt64(int64(baseIn.Amount))
-	poolBaseF := new(big.Float).SetInt64(int64(p.AmountBase))
-	poolQuoteF := new(big.Float).SetInt64(int64(p.AmountQuote))
-	poolSharesF := new(big.Float).SetInt64(int64(p.AmountShares))
-	if math.IsFloatZero(poolBaseF) {
-		// Calculate quote assets in
-		ratio, _ := p.InitialAssetsRatio.Float64()
-		quoteInAmtF := math.MulFloat64ByBigFloat(ratio, baseInF)
-		quoteIn = types.NewAmount(p.QuoteAsset, math.Int(quoteInAmtF).Uint64())
-		// Calculate shares out
-		sharesOutAmt := math.Int(math.AddF(baseInF, quoteInAmtF))
-		sharesOut = types.NewAmount(p.PoolID, sharesOutAmt.Uint64())
+	// Amounts in are rounded up and shares out are rounded down, in the pool's favour
+	var baseFee, quoteFee uint64
+	if p.AmountBase == 0 {
+		// Calculate quote assets in := ceil(baseIn * ratio)
+		baseInD, err := mdecimal.FromUint64(baseIn.Amount)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		quoteInD, err := baseInD.Mul(p.InitialAssetsRatio)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		quoteInAmt, err := mdecimal.CeilUint64(quoteInD)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		quoteIn = types.NewAmount(p.QuoteAsset, quoteInAmt)
+		// Calculate shares out of baseIn and floor(baseIn * ratio), see Invariant.InitialShares
+		quoteInFloor, err := mdecimal.FloorUint64(quoteInD)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		sharesOutAmt, err := invariant.InitialShares(p, baseIn.Amount, quoteInFloor)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		sharesOut = types.NewAmount(p.PoolID, sharesOutAmt)
 	} else {
-		addedRatio := new(big.Float).Quo(baseInF, poolBaseF)
-		// Calculate quote assets in
-		quoteInAmt := math.Int(math.MulF(poolQuoteF, addedRatio))
-		quoteIn = types.NewAmount(p.QuoteAsset, quoteInAmt.Uint64())
-		// Calculate shares out
-		sharesOutAmt := math.Int(math.MulF(poolSharesF, addedRatio))
-		sharesOut = types.NewAmount(p.PoolID, sharesOutAmt.Uint64())
+		// Shares are priced on the pool's reserves and collected fees, see proportionalIn
+		var quoteReserve, sharesOutAmt uint64
+		baseFee, quoteReserve, quoteFee, sharesOutAmt, err = p.proportionalIn(
+			baseIn.Amount, p.AmountBase, p.FeesCollectedBase, p.AmountQuote, p.FeesCollectedQuote,
+		)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		quoteInAmt, err := math.CheckedAddU64(quoteReserve, quoteFee)
+		if err != nil {
+			return types.Amount{}, types.Amount{}, err
+		}
+		quoteIn = types.NewAmount(p.QuoteAsset, quoteInAmt)
+		sharesOut = types.NewAmount(p.PoolID, sharesOutAmt)
 	}
 
 	// Mutate the pool
-	if p.AmountShares, err = math.CheckedAddU64(p.AmountShares, sharesOut.Amount); err != nil {
-		return types.Amount{}, types.Amount{}, err
-	}
-	if p.AmountBase, err = math.CheckedAddU64(p.AmountBase, baseIn.Amount); err != nil {
-		return types.Amount{}, types.Amount{}, err
-	}
-	if p.AmountQuote, err = math.CheckedAddU64(p.AmountQuote, quoteIn.Amount); err != nil {
+	err = p.addLiquidity(sharesOut.Amount, baseIn.Amount-baseFee, quoteIn.Amount-quoteFee, baseFee, quoteFee)
+	if err != nil {
 		return types.Amount{}, types.Amount{}, err
 	}
 	p.Sequence++
@@ -267,16 +323,16 @@ func (p *Pool) RemoveLiquidity(sharesIn types.Amount) ([]types.Amount, error) {
 	if p.AmountShares < sharesIn.Amount {
 		return nil, fmt.Errorf("RemoveLiquidity: removing more sharesIn than pool has")
 	}
+	if _, err := p.Invariant(); err != nil {
+		return nil, err
+	}
 
 	// What portion of the pool is being withdrawn (for example, 14 out of 50 sharesIn would be 0.28)
-	sharesF := new(big.Float).SetInt64(int64(sharesIn.Amount))
-	poolBaseF := new(big.Float).SetInt64(int64(p.AmountBase))
-	poolQuoteF := new(big.Float).SetInt64(int64(p.AmountQuote))
-	poolSharesF := new(big.Float).SetInt64(int64(p.AmountShares))
-	removeRatio := new(big.Float).Quo(sharesF, poolSharesF)
-	// Calculate amounts out
-	baseOutAmt := math.Int(math.MulF(poolBaseF, removeRatio))
-	quoteOutAmt := math.Int(math.MulF(poolQuoteF, removeRatio))
+	// Amounts out := floor(poolAmount * sharesIn / poolShares), in the pool's favour
+	sharesI := new(big.Int).SetUint64(sharesIn.Amount)
+	poolSharesI := new(big.Int).SetUint64(p.AmountShares)
+	baseOutAmt := math.DivI(math.Mul(new(big.Int).SetUint64(p.AmountBase), sharesI), poolSharesI, false)
+	quoteOutAmt := math.DivI(math.Mul(new(big.Int).SetUint64(p.AmountQuote), sharesI), poolSharesI, false)
 	baseOut := types.NewAmount(p.BaseAsset, baseOutAmt.Uint64())
 	quoteOut := types.NewAmount(p.QuoteAsset, quoteOutAmt.Uint64())
 
@@ -306,6 +362,7 @@ func contains(set []string, target string) bool {
 	return false
 }
 
+// Deprecated: use types.ParseAssetID, which also tells pool shares apart from coupon and snapshot entries.
 func HasHyphen(UID string) bool {
 	return strings.Contains(UID, "-")
 }
@@ -330,42 +387,89 @@ func (p *Pool) Balances(assetA string) (balanceA, balanceB *types.Balance, err e
 	return
 }
 
+// T returns the pool's t, which ranges from 1 to 0 over the life of the bond. Error for product pools.
 func (p *Pool) T() (float64, error) {
-	if p.IsProductPool {
-		return 0, errors.Data("product pool does not have t")
+	return p.TAt(time.Now())
+}
+
+// TAt is T at a specific time.
+func (p *Pool) TAt(now time.Time) (float64, error) {
+	if p.Kind() != PoolKindYield {
+		return 0, errors.Data("%s pool does not have t", p.Kind())
 	}
-	return calculateT(time.Now().Unix(), p.MaturityAt, p.Duration()), nil
+	t, _ := calculateT(now.Unix(), p.MaturityAt, p.Duration()).Float64()
+	return t, nil
 }
 
+// Price returns the midpoint of the prices of swapping 1% of each reserve, in base per quote.
+// The price is computed with decimals, only the result is converted to float64.
 func (p *Pool) Price() (float64, error) {
+	return p.PriceAt(time.Now())
+}
+
+// PriceAt is Price at a specific time.
+func (p *Pool) PriceAt(now time.Time) (float64, error) {
+	mid, err := p.priceAt(now)
+	if err != nil {
+		return 0, err
+	}
+	price, _ := mid.Float64()
+	return price, nil
+}
+
+// priceAt is PriceAt as a decimal.
+func (p *Pool) priceAt(now time.Time) (decimal.Decimal, error) {
 	balanceInBase := types.Balance{
 		Asset:  p.BaseAsset,
-		Amount: uint64(float64(p.AmountBase) * swapSimluateFraction),
+		Amount: p.AmountBase / swapSimulateDivisor,
 	}
-	balanceOutQuote, _, err := p.SimulateSwap(&balanceInBase)
+	balanceOutQuote, _, err := p.SimulateSwapAt(&balanceInBase, now)
 	if err != nil {
-		return 0, err
+		return decimal.Decimal{}, err
+	}
+	priceBuy, err := quoUint64(balanceInBase.Amount, balanceOutQuote.Amount)
+	if err != nil {
+		return decimal.Decimal{}, err
 	}
-	priceBuy := float64(balanceInBase.Amount) / float64(balanceOutQuote.Amount)
 
 	balanceInQuote := types.Balance{
 		Asset:  p.QuoteAsset,
-		Amount: uint64(float64(p.AmountQuote) * swapSimluateFraction),
+		Amount: p.AmountQuote / swapSimulateDivisor,
 	}
-	balanceOutBase, _, err := p.SimulateSwap(&balanceInQuote)
+	balanceOutBase, _, err := p.SimulateSwapAt(&balanceInQuote, now)
 	if err != nil {
-		return 0, err
+		return decimal.Decimal{}, err
+	}
+	priceSell, err := quoUint64(balanceOutBase.Amount, balanceInQuote.Amount)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+
+	sum, err := priceBuy.Add(priceSell)
+	if err != nil {
+		return decimal.Decimal{}, err
 	}
-	priceSell := float64(balanceOutBase.Amount) / float64(balanceInQuote.Amount)
-	return (priceBuy + priceSell) / 2, nil
+	return sum.Quo(decimal.Two)
 }
 
+// SimulateSwap returns the amount out and fee of swapping balanceIn, without mutating the pool.
+// All pool math uses integers and decimals, so results are the same on every machine.
+// Amounts out are rounded down and fees are rounded up, in the pool's favour.
 func (p *Pool) SimulateSwap(balanceIn *types.Balance) (balanceOut, balanceFee *types.Balance, err error) {
-	if p.IsProductPool {
-		return p.simulateProductPoolSwap(balanceIn)
-	}
+	return p.SimulateSwapAt(balanceIn, time.Now())
+}
 
-	return p.simulateYieldPoolSwap(balanceIn)
+// SimulateSwapAt is SimulateSwap at a specific time. Only yield pools depend on the time.
+// Error ErrInvalidPoolType if the pool's kind is not supported.
+func (p *Pool) SimulateSwapAt(
+	balanceIn *types.Balance,
+	now time.Time,
+) (balanceOut, balanceFee *types.Balance, err error) {
+	invariant, err := p.Invariant()
+	if err != nil {
+		return nil, nil, err
+	}
+	return invariant.SimulateSwap(p, balanceIn, now)
 }
 
 func (p *Pool) simulateProductPoolSwap(balanceIn *types.Balance) (*types.Balance, *types.Balance, error) {
@@ -380,22 +484,22 @@ func (p *Pool) simulateProductPoolSwap(balanceIn *types.Balance) (*types.Balance
 		return nil, nil, err
 	}
 
-	amtIn := big.NewInt(balanceIn.Amt())
-	fee := math.MulIF64(amtIn, p.SwapFee())
-	amtInAfterFee := math.Sub(amtIn, fee)
-	if amtInAfterFee.Sign() != 1 {
-		return nil, nil, errors.ErrInsufficientBalance
+	fee, err := p.swapFee(balanceIn.Amount)
+	if err != nil {
+		return nil, nil, err
 	}
+	amtInAfterFee := new(big.Int).SetUint64(balanceIn.Amount - fee)
 
-	poolReserveAmountOut := big.NewInt(int64(poolReserveAssetOut.Amount))
-	poolReserveAmountIn := big.NewInt(int64(poolReserveAssetIn.Amount))
+	// amountOut := floor(reserveOut * amountInAfterFee / (reserveIn + amountInAfterFee))
+	poolReserveAmountOut := new(big.Int).SetUint64(poolReserveAssetOut.Amount)
+	poolReserveAmountIn := new(big.Int).SetUint64(poolReserveAssetIn.Amount)
 
 	poolReserveAmountOutMulAmountIn := math.Mul(poolReserveAmountOut, amtInAfterFee)
 	poolReserveAmountInPlusAmountIn := math.Add(poolReserveAmountIn, amtInAfterFee)
 	amountOut := new(big.Int).Quo(poolReserveAmountOutMulAmountIn, poolReserveAmountInPlusAmountIn)
 
 	balanceOut := types.NewBalance(poolReserveAssetOut.Asset, amountOut.Int64())
-	balanceFee := types.NewBalance(balanceIn.Asset, fee.Int64())
+	balanceFee := types.NewBalance(balanceIn.Asset, int64(fee))
 
 	return balanceOut, balanceFee, nil
 }
@@ -403,13 +507,16 @@ func (p *Pool) simulateProductPoolSwap(balanceIn *types.Balance) (*types.Balance
 // calculate t, which should range from 1 to 0 over the life of the bond,
 // derived from the current time (now), maturity (end) time, and total duration of the bond.
 // returns 0 if time is past maturity (that is, now >= end). Also returns zero on invalid duration.
-func calculateT(now, end, duration int64) float64 {
+func calculateT(now, end, duration int64) decimal.Decimal {
 	if duration <= 0 || now >= end {
-		return 0
+		return decimal.Zero
 	}
-	t := float64(end-now) / float64(duration)
-	if t > 1 {
-		t = 1
+	if end-now >= duration {
+		return decimal.One
+	}
+	t, err := decimal.MustNew(end-now, 0).Quo(decimal.MustNew(duration, 0))
+	if err != nil {
+		return decimal.Zero
 	}
 	return t
 }
@@ -432,41 +539,110 @@ func calculateZ(t, g float64, isSell bool) float64 {
 
 // returns k := x^t' + y^t'
 // where t' := 1 - (t * g) and t progresses from 1 to 0 over time
-func calculateK(x, y *big.Int, t, g float64) float64 {
-	xf, _ := x.Float64()
-	yf, _ := y.Float64()
-	tPrime := 1 - (t * g)
-	return gmath.Pow(xf, tPrime) + gmath.Pow(yf, tPrime)
+func calculateK(x, y uint64, tPrime decimal.Decimal) (decimal.Decimal, error) {
+	xt, err := powUint64(x, tPrime)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	yt, err := powUint64(y, tPrime)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	return xt.Add(yt)
 }
 
-// Calculates how the out asset changes if we increase in asset.
-// <param:assetInBalance> [x_end] = x_start + ∆x
+// Calculates how much the out asset decreases if we increase the in asset, keeping k constant.
+// <param:assetInEnd> [x_end] = x_start + ∆x
 //
-// y_end = [k - x_end^(1-tg)]^[1/(1-t)]  || Note: tg can also be t/g depending on the asset.
+// y_end = [k - x_end^t']^[1/t'] where t' := 1-tg || Note: tg can also be t/g depending on the asset.
 //
-// ∆y = y_end - y_start
-func calculateDelta(
-	assetOutBalance, assetInBalance *big.Int,
-	k, timeToMaturity, gFeeFactor float64,
-) *big.Int {
-	in, _ := assetInBalance.Float64()
-	out, _ := assetOutBalance.Float64()
+// ∆y = y_start - y_end, rounded down. When t' is zero the curve's limit x * y = k is used instead,
+// so the pool behaves like a product pool. Error ErrNotEnoughPoolReserves if x_end is beyond the curve.
+func calculateDelta(assetInBalance, assetOutBalance, assetInEnd uint64, tPrime decimal.Decimal) (uint64, error) {
+	if tPrime.IsZero() {
+		// y_end := ceil(x * y / x_end)
+		k := math.Mul(new(big.Int).SetUint64(assetInBalance), new(big.Int).SetUint64(assetOutBalance))
+		outEnd := math.DivI(k, new(big.Int).SetUint64(assetInEnd), true)
+		if !outEnd.IsUint64() || outEnd.Uint64() > assetOutBalance {
+			return 0, nil
+		}
+		return assetOutBalance - outEnd.Uint64(), nil
+	}
+
+	k, err := calculateK(assetInBalance, assetOutBalance, tPrime)
+	if err != nil {
+		return 0, err
+	}
+	inEnd, err := powUint64(assetInEnd, tPrime)
+	if err != nil {
+		return 0, err
+	}
+	rest, err := k.Sub(inEnd)
+	if err != nil {
+		return 0, err
+	}
+	if !rest.IsPos() {
+		return 0, errors.ErrNotEnoughPoolReserves
+	}
+	inv, err := tPrime.Inv()
+	if err != nil {
+		return 0, err
+	}
+	outEnd, err := rest.Pow(inv)
+	if err != nil {
+		return 0, err
+	}
+	outStart, err := mdecimal.FromUint64(assetOutBalance)
+	if err != nil {
+		return 0, err
+	}
+	delta, err := outStart.Sub(outEnd)
+	if err != nil {
+		return 0, err
+	}
+	if !delta.IsPos() {
+		return 0, nil
+	}
+	return mdecimal.FloorUint64(delta)
+}
+
+// powUint64 returns x^e.
+func powUint64(x uint64, e decimal.Decimal) (decimal.Decimal, error) {
+	d, err := mdecimal.FromUint64(x)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	return d.Pow(e)
+}
 
-	updatedOut := k - gmath.Pow(in, 1-(gFeeFactor*timeToMaturity))
-	updatedOut = gmath.Pow(updatedOut, 1/(1-(gFeeFactor*timeToMaturity)))
-	delta := math.Int(big.NewFloat(updatedOut - out))
-	return delta
+// quoUint64 returns a / b.
+func quoUint64(a, b uint64) (decimal.Decimal, error) {
+	da, err := mdecimal.FromUint64(a)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	db, err := mdecimal.FromUint64(b)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	return da.Quo(db)
 }
 
 func (p *Pool) Duration() int64 {
-	if p.IsProductPool {
+	if p.Kind() != PoolKindYield {
 		return 0
 	}
 	return p.MaturityAt - p.CreatedAt
 }
 
+// Matured returns true if the pool is a yield pool at or after its maturity, when it stops swapping and can be
+// settled, see SettleAt.
+func (p *Pool) Matured(now time.Time) bool {
+	return p.Kind() == PoolKindYield && now.Unix() >= p.MaturityAt
+}
+
 func (p *Pool) SwapFee() float64 {
-	if !p.IsProductPool {
+	if p.Kind() == PoolKindYield {
 		return 0
 	}
 
@@ -475,7 +651,7 @@ func (p *Pool) SwapFee() float64 {
 }
 
 func (p *Pool) G() float64 {
-	if p.IsProductPool {
+	if p.Kind() != PoolKindYield {
 		return 0
 	}
 
@@ -483,24 +659,14 @@ func (p *Pool) G() float64 {
 	return ff
 }
 
-func (p *Pool) simulateYieldPoolSwap(balanceIn *types.Balance) (*types.Balance, *types.Balance, error) {
+func (p *Pool) simulateYieldPoolSwap(balanceIn *types.Balance, now time.Time) (*types.Balance, *types.Balance, error) {
 	if !balanceIn.Valid() {
 		return nil, nil, errors.New(errors.InvalidInputError, "invalid balance")
 	}
 	if balanceIn.IsZero() {
 		return nil, nil, errors.ErrAmountCannotBeZero
 	}
-	timeToMaturity := calculateT(time.Now().Unix(), p.MaturityAt, p.Duration())
-
-	stableAmount := types.Balance{
-		Asset:  p.QuoteAsset,
-		Amount: p.AmountQuote,
-	}
-
-	bondAmount := types.Balance{
-		Asset:  p.BaseAsset,
-		Amount: p.AmountBase,
-	}
+	timeToMaturity := calculateT(now.Unix(), p.MaturityAt, p.Duration())
 
 	assetOutID, err := p.OtherAssetID(balanceIn.Asset)
 	if err != nil {
@@ -512,49 +678,43 @@ func (p *Pool) simulateYieldPoolSwap(balanceIn *types.Balance) (*types.Balance,
 		return nil, nil, err
 	}
 
-	G := p.G()
+	G := p.FeeFactor
 	if balanceIn.Asset == p.BaseAsset {
-		G = 1 / G
+		if G, err = G.Inv(); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	poolBalanceOfIn, err = poolBalanceOfIn.Add(balanceIn)
+	inEnd, err := math.CheckedAddU64(poolBalanceOfIn.Amount, balanceIn.Amount)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	k := calculateK(
-		big.NewInt(int64(stableAmount.Amount)),
-		big.NewInt(int64(bondAmount.Amount)),
-		timeToMaturity,
-		1,
-	)
-	pbOut := big.NewInt(int64(poolBalanceOfOut.Amount))
-	pbIn := big.NewInt(int64(poolBalanceOfIn.Amount))
-	outWithoutFee := calculateDelta(
-		pbOut,
-		pbIn,
-		k,
-		timeToMaturity,
-		1,
-	)
-	k = calculateK(
-		big.NewInt(int64(stableAmount.Amount)),
-		big.NewInt(int64(bondAmount.Amount)),
-		timeToMaturity,
-		G,
-	)
-	outWithFee := calculateDelta(
-		pbOut,
-		pbIn,
-		k,
-		timeToMaturity,
-		G,
-	)
+	// t' := 1 - t without fees
+	tPrime, err := decimal.One.Sub(timeToMaturity)
+	if err != nil {
+		return nil, nil, err
+	}
+	outWithoutFee, err := calculateDelta(poolBalanceOfIn.Amount, poolBalanceOfOut.Amount, inEnd, tPrime)
+	if err != nil {
+		return nil, nil, err
+	}
+	// t' := 1 - tg with fees
+	tg, err := timeToMaturity.Mul(G)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tPrime, err = decimal.One.Sub(tg); err != nil {
+		return nil, nil, err
+	}
+	outWithFee, err := calculateDelta(poolBalanceOfIn.Amount, poolBalanceOfOut.Amount, inEnd, tPrime)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	feeAmt := math.Sub(outWithFee, outWithoutFee)
-	outWithFee = math.Mul(outWithFee, big.NewInt(-1))
-	balanceOut := types.NewBalance(assetOutID, outWithFee.Int64())
-	balanceFee := types.NewBalance(balanceIn.Asset, feeAmt.Int64())
+	feeAmt, _ := math.CheckedSubU64ToZero(outWithoutFee, outWithFee)
+	balanceOut := types.NewBalance(assetOutID, int64(outWithFee))
+	balanceFee := types.NewBalance(balanceIn.Asset, int64(feeAmt))
 
 	return balanceOut, balanceFee, nil
 }
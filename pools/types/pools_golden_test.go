@@ -0,0 +1,202 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/testing/fakeclock"
+)
+
+// goldenNow is the time golden swaps are simulated at.
+var goldenNow = time.Date(2024, 8, 12, 20, 0, 0, 0, time.UTC)
+
+// goldenPool creates a pool between assets "b" and "q". Yield pools have t = tParam at goldenNow.
+func goldenPool(product bool, base, quote uint64, feeFactor, tParam string) *types.Pool {
+	p := &types.Pool{
+		PoolID:        "b-q",
+		BaseAsset:     "b",
+		QuoteAsset:    "q",
+		IsProductPool: product,
+		AmountBase:    base,
+		AmountQuote:   quote,
+		FeeFactor:     decimal.MustParse(feeFactor),
+	}
+	if !product {
+		const duration = 86_400_000
+		elapsed, _ := decimal.One.Sub(decimal.MustParse(tParam))
+		elapsed, _ = elapsed.Mul(decimal.MustNew(duration, 0))
+		seconds, _, _ := elapsed.Int64(0)
+		now := goldenNow.Unix()
+		p.CreatedAt = now - seconds
+		p.MaturityAt = now - seconds + duration
+	}
+	return p
+}
+
+// TestSimulateSwap_Golden checks swap results against golden values. The legacy values were produced by the
+// previous float64 implementation: results must match them, except that product pool fees are now rounded up
+// instead of down, which can lower the amount out of small product pool swaps. Yield pool results match exactly.
+func TestSimulateSwap_Golden(t *testing.T) {
+	cases := []struct {
+		product     bool
+		base, quote uint64
+		feeFactor   string
+		tParam      string
+		assetIn     string
+		amountIn    uint64
+		legacyOut   uint64
+		legacyFee   uint64
+		out         uint64
+		fee         uint64
+	}{
+		{true, 1000000, 950000, "0.003", "", "b", 10, 9, 0, 8, 1},
+		{true, 1000000, 950000, "0.003", "", "b", 1000, 946, 3, 946, 3},
+		{true, 1000000, 950000, "0.003", "", "b", 25000, 23102, 75, 23102, 75},
+		{true, 1000000, 950000, "0.003", "", "b", 400000, 270846, 1200, 270846, 1200},
+		{true, 1000000, 950000, "0.003", "", "q", 10, 10, 0, 9, 1},
+		{true, 1000000, 950000, "0.003", "", "q", 1000, 1048, 3, 1048, 3},
+		{true, 1000000, 950000, "0.003", "", "q", 25000, 25566, 75, 25566, 75},
+		{true, 1000000, 950000, "0.003", "", "q", 400000, 295670, 1200, 295670, 1200},
+		{true, 10000, 10000, "0", "", "b", 1, 0, 0, 0, 0},
+		{true, 10000, 10000, "0", "", "b", 10, 9, 0, 9, 0},
+		{true, 10000, 10000, "0", "", "b", 1000, 909, 0, 909, 0},
+		{true, 10000, 10000, "0", "", "b", 25000, 7142, 0, 7142, 0},
+		{true, 10000, 10000, "0", "", "b", 400000, 9756, 0, 9756, 0},
+		{true, 10000, 10000, "0", "", "q", 1, 0, 0, 0, 0},
+		{true, 10000, 10000, "0", "", "q", 10, 9, 0, 9, 0},
+		{true, 10000, 10000, "0", "", "q", 1000, 909, 0, 909, 0},
+		{true, 10000, 10000, "0", "", "q", 25000, 7142, 0, 7142, 0},
+		{true, 10000, 10000, "0", "", "q", 400000, 9756, 0, 9756, 0},
+		{true, 123456789, 987654321, "0.01", "", "b", 10, 79, 0, 71, 1},
+		{true, 123456789, 987654321, "0.01", "", "b", 1000, 7919, 10, 7919, 10},
+		{true, 123456789, 987654321, "0.01", "", "b", 25000, 197960, 250, 197960, 250},
+		{true, 123456789, 987654321, "0.01", "", "b", 400000, 3157870, 4000, 3157870, 4000},
+		{true, 123456789, 987654321, "0.01", "", "q", 10, 1, 0, 1, 1},
+		{true, 123456789, 987654321, "0.01", "", "q", 1000, 123, 10, 123, 10},
+		{true, 123456789, 987654321, "0.01", "", "q", 25000, 3093, 250, 3093, 250},
+		{true, 123456789, 987654321, "0.01", "", "q", 400000, 49480, 4000, 49480, 4000},
+		{false, 1000000, 950000, "1.02", "0.5", "b", 1, 0, 0, 0, 0},
+		{false, 1000000, 950000, "1.02", "0.5", "b", 10, 9, 0, 9, 0},
+		{false, 1000000, 950000, "1.02", "0.5", "b", 1000, 974, 0, 974, 0},
+		{false, 1000000, 950000, "1.02", "0.5", "b", 25000, 24080, 0, 24080, 0},
+		{false, 1000000, 950000, "1.02", "0.5", "b", 400000, 324799, 0, 324799, 0},
+		{false, 1000000, 950000, "1.02", "0.5", "q", 1, 1, 0, 1, 0},
+		{false, 1000000, 950000, "1.02", "0.5", "q", 10, 10, 0, 10, 0},
+		{false, 1000000, 950000, "1.02", "0.5", "q", 1000, 1025, 0, 1025, 0},
+		{false, 1000000, 950000, "1.02", "0.5", "q", 25000, 25326, 0, 25326, 0},
+		{false, 1000000, 950000, "1.02", "0.5", "q", 400000, 338381, 1000, 338381, 1000},
+		{false, 1000000, 950000, "1.02", "0.25", "b", 1, 0, 0, 0, 0},
+		{false, 1000000, 950000, "1.02", "0.25", "b", 10, 9, 0, 9, 0},
+		{false, 1000000, 950000, "1.02", "0.25", "b", 1000, 987, 0, 987, 0},
+		{false, 1000000, 950000, "1.02", "0.25", "b", 25000, 24534, 0, 24534, 0},
+		{false, 1000000, 950000, "1.02", "0.25", "b", 400000, 358382, 0, 358382, 0},
+		{false, 1000000, 950000, "1.02", "0.25", "q", 1, 1, 0, 1, 0},
+		{false, 1000000, 950000, "1.02", "0.25", "q", 10, 10, 0, 10, 0},
+		{false, 1000000, 950000, "1.02", "0.25", "q", 1000, 1012, 0, 1012, 0},
+		{false, 1000000, 950000, "1.02", "0.25", "q", 25000, 25163, 0, 25163, 0},
+		{false, 1000000, 950000, "1.02", "0.25", "q", 400000, 366192, 599, 366192, 599},
+		{false, 50000000, 48000000, "1.005", "0.75", "b", 1, 0, 0, 0, 0},
+		{false, 50000000, 48000000, "1.005", "0.75", "b", 10, 9, 0, 9, 0},
+		{false, 50000000, 48000000, "1.005", "0.75", "b", 1000, 969, 0, 969, 0},
+		{false, 50000000, 48000000, "1.005", "0.75", "b", 25000, 24240, 0, 24240, 0},
+		{false, 50000000, 48000000, "1.005", "0.75", "b", 400000, 385683, 0, 385683, 0},
+		{false, 50000000, 48000000, "1.005", "0.75", "q", 1, 1, 0, 1, 0},
+		{false, 50000000, 48000000, "1.005", "0.75", "q", 10, 10, 0, 10, 0},
+		{false, 50000000, 48000000, "1.005", "0.75", "q", 1000, 1031, 0, 1031, 0},
+		{false, 50000000, 48000000, "1.005", "0.75", "q", 25000, 25771, 0, 25771, 0},
+		{false, 50000000, 48000000, "1.005", "0.75", "q", 400000, 409937, 0, 409937, 0},
+		{false, 10000, 10000, "1", "0.5", "b", 1, 0, 0, 0, 0},
+		{false, 10000, 10000, "1", "0.5", "b", 10, 9, 0, 9, 0},
+		{false, 10000, 10000, "1", "0.5", "b", 1000, 952, 0, 952, 0},
+		{false, 10000, 10000, "1", "0.5", "b", 25000, 9833, 0, 9833, 0},
+		{false, 10000, 10000, "1", "0.5", "q", 1, 0, 0, 0, 0},
+		{false, 10000, 10000, "1", "0.5", "q", 10, 9, 0, 9, 0},
+		{false, 10000, 10000, "1", "0.5", "q", 1000, 952, 0, 952, 0},
+		{false, 10000, 10000, "1", "0.5", "q", 25000, 9833, 0, 9833, 0},
+	}
+
+	for _, c := range cases {
+		p := goldenPool(c.product, c.base, c.quote, c.feeFactor, c.tParam)
+		out, fee, err := p.SimulateSwapAt(ltypes.NewBalance(c.assetIn, int64(c.amountIn)), goldenNow)
+		require.NoError(t, err, c)
+		require.Equal(t, c.out, out.Amount, c)
+		require.Equal(t, c.fee, fee.Amount, c)
+
+		if !c.product {
+			// yield pools price exactly as the legacy implementation did
+			require.Equal(t, c.legacyOut, c.out, c)
+			require.Equal(t, c.legacyFee, c.fee, c)
+			continue
+		}
+		require.Contains(t, []uint64{c.legacyFee, c.legacyFee + 1}, c.fee, c)
+		if c.fee == c.legacyFee {
+			require.InDelta(t, c.legacyOut, c.out, 1, c)
+		} else {
+			require.LessOrEqual(t, c.out, c.legacyOut, c)
+		}
+	}
+}
+
+func TestSimulateSwap_Rounding(t *testing.T) {
+	require := require.New(t)
+
+	// a fee of 0.003 on 10 units rounds up to 1
+	p := goldenPool(true, 1_000_000, 950_000, "0.003", "")
+	_, fee, err := p.SimulateSwapAt(ltypes.NewBalance("b", int64(10)), goldenNow)
+	require.NoError(err)
+	require.Equal(uint64(1), fee.Amount)
+	// the fee would take the whole amount in
+	_, _, err = p.SimulateSwapAt(ltypes.NewBalance("b", int64(1)), goldenNow)
+	require.ErrorIs(err, errors.ErrInsufficientBalance)
+
+	// with t = 1 and no fees, the yield curve's limit is a product pool
+	p = goldenPool(false, 1_000_000, 950_000, "1", "1")
+	out, _, err := p.SimulateSwapAt(ltypes.NewBalance("b", int64(1000)), goldenNow)
+	require.NoError(err)
+	require.Equal(uint64(949), out.Amount) // floor(950000 - ceil(1000000 * 950000 / 1001000))
+
+	// the yield curve ends before the pool can take this much
+	p = goldenPool(false, 10_000, 10_000, "1", "0.5")
+	_, _, err = p.SimulateSwapAt(ltypes.NewBalance("b", int64(400_000)), goldenNow)
+	require.ErrorIs(err, errors.ErrNotEnoughPoolReserves)
+}
+
+func TestSimulateSwapAt_NearMaturity(t *testing.T) {
+	require := require.New(t)
+	clk := fakeclock.New(goldenNow)
+	p := goldenPool(false, 1_000_000, 950_000, "1.02", "0.5")
+	in := ltypes.NewBalance("q", int64(25_000))
+
+	// t shrinks and the swap approaches 1:1 as the pool approaches maturity
+	previous, _, err := p.SimulateSwapAt(in, clk.Now())
+	require.NoError(err)
+	previousT, err := p.TAt(clk.Now())
+	require.NoError(err)
+	for _, step := range []time.Duration{24 * time.Hour, time.Hour, time.Minute} {
+		clk.Set(time.Unix(p.MaturityAt, 0).Add(-step))
+		out, _, err := p.SimulateSwapAt(in, clk.Now())
+		require.NoError(err)
+		require.LessOrEqual(out.Amount, previous.Amount, step)
+		require.GreaterOrEqual(out.Amount, in.Amount, step)
+		tParam, err := p.TAt(clk.Now())
+		require.NoError(err)
+		require.Less(tParam, previousT, step)
+		previous, previousT = out, tParam
+	}
+
+	// at maturity t is zero and the swap is 1:1
+	clk.Set(time.Unix(p.MaturityAt, 0))
+	tParam, err := p.TAt(clk.Now())
+	require.NoError(err)
+	require.Zero(tParam)
+	out, fee, err := p.SimulateSwapAt(in, clk.Now())
+	require.NoError(err)
+	require.Equal(in.Amount, out.Amount)
+	require.Zero(fee.Amount)
+}
@@ -0,0 +1,131 @@
+package types
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/helpers"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+)
+
+// DefaultMaxHops is the hop limit used by routers created with a non-positive limit.
+const DefaultMaxHops = 3
+
+// Hop is a single swap of a Route.
+type Hop struct {
+	PoolID    string         `json:"pool_id"`
+	AmountIn  *types.Balance `json:"amount_in"`
+	AmountOut *types.Balance `json:"amount_out"`
+	// Fee charged by the pool, in the asset the pool charges fees in.
+	Fee *types.Balance `json:"fee"`
+}
+
+// Route is a sequence of swaps through pools, where each hop's output is the next hop's input.
+type Route struct {
+	Hops      []Hop          `json:"hops"`
+	AmountIn  *types.Balance `json:"amount_in"`
+	AmountOut *types.Balance `json:"amount_out"`
+}
+
+// Router finds swap paths over a set of pools.
+// Router does not copy the pools, which must not be mutated while the router is in use.
+type Router struct {
+	// pools trading each asset, sorted by pool ID so routes are deterministic
+	pools     map[string][]*Pool
+	assetData *helpers.AssetData
+	maxHops   int
+}
+
+// NewRouter builds the asset graph of pools. Pools between assets which are not base assets, such as
+// pool shares, are left out. If assetData is not nil, assets it does not allow trading are left out too.
+func NewRouter(pools []*Pool, assetData *helpers.AssetData, maxHops int) *Router {
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+	r := &Router{
+		pools:     map[string][]*Pool{},
+		assetData: assetData,
+		maxHops:   maxHops,
+	}
+	for _, p := range pools {
+		if p == nil || !r.tradeable(p.BaseAsset) || !r.tradeable(p.QuoteAsset) {
+			continue
+		}
+		r.pools[p.BaseAsset] = append(r.pools[p.BaseAsset], p)
+		r.pools[p.QuoteAsset] = append(r.pools[p.QuoteAsset], p)
+	}
+	for _, ps := range r.pools {
+		sort.Slice(ps, func(i, j int) bool { return ps[i].PoolID < ps[j].PoolID })
+	}
+	return r
+}
+
+// tradeable returns true if an asset can be routed through.
+func (r *Router) tradeable(assetID string) bool {
+	id, err := types.ParseAssetID(assetID)
+	if err != nil || !id.IsBase() {
+		return false
+	}
+	return r.assetData == nil || r.assetData.CanTrade(assetID)
+}
+
+// BestRoute finds the route which swaps balanceIn for the most of assetOut, using at most the router's
+// hop limit. Among routes with the same output, the one with the fewest hops wins.
+// Error ErrNoValidSwapPath if no route exists or every route fails to simulate.
+func (r *Router) BestRoute(balanceIn *types.Balance, assetOut string) (*Route, error) {
+	return r.BestRouteAt(balanceIn, assetOut, time.Now())
+}
+
+// BestRouteAt is BestRoute at a specific time.
+func (r *Router) BestRouteAt(balanceIn *types.Balance, assetOut string, now time.Time) (*Route, error) {
+	if balanceIn == nil {
+		return nil, errors.ErrSwapInputInNil
+	}
+	if !balanceIn.Valid() {
+		return nil, errors.New(errors.InvalidInputError, "invalid balance")
+	}
+	if balanceIn.IsZero() {
+		return nil, errors.ErrAmountCannotBeZero
+	}
+	if balanceIn.Asset == assetOut || !r.tradeable(balanceIn.Asset) || !r.tradeable(assetOut) {
+		return nil, errors.ErrNoValidSwapPath
+	}
+
+	var best *Route
+	visited := map[string]bool{balanceIn.Asset: true}
+	var search func(in *types.Balance, hops []Hop)
+	search = func(in *types.Balance, hops []Hop) {
+		if len(hops) == r.maxHops {
+			return
+		}
+		for _, p := range r.pools[in.Asset] {
+			next, err := p.OtherAssetID(in.Asset)
+			if err != nil || visited[next] || p.SettledAt != 0 || p.Matured(now) {
+				continue
+			}
+			out, fee, err := p.SimulateSwapAt(in, now)
+			if err != nil || out.IsZero() {
+				continue
+			}
+			path := append(hops[:len(hops):len(hops)], Hop{PoolID: p.PoolID, AmountIn: in, AmountOut: out, Fee: fee})
+			if next == assetOut {
+				if best == nil ||
+					out.Amount > best.AmountOut.Amount ||
+					(out.Amount == best.AmountOut.Amount && len(path) < len(best.Hops)) {
+					best = &Route{Hops: path, AmountIn: balanceIn, AmountOut: out}
+				}
+				continue
+			}
+			visited[next] = true
+			search(out, path)
+			visited[next] = false
+		}
+	}
+	search(balanceIn, nil)
+
+	if best == nil {
+		return nil, errors.ErrNoValidSwapPath
+	}
+	return best, nil
+}
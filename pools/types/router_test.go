@@ -0,0 +1,82 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/helpers"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+)
+
+func productPool(base, quote string, amountBase, amountQuote uint64) *types.Pool {
+	return &types.Pool{
+		PoolID:        ltypes.NewPoolShareID(base, quote).String(),
+		BaseAsset:     base,
+		QuoteAsset:    quote,
+		IsProductPool: true,
+		AmountBase:    amountBase,
+		AmountQuote:   amountQuote,
+		AmountShares:  amountBase + amountQuote,
+		FeeFactor:     decimal.MustParse("0.003"),
+	}
+}
+
+func TestRouter_BestRoute(t *testing.T) {
+	require := require.New(t)
+	pools := []*types.Pool{
+		productPool("A", "C", 1_000, 1_000),         // direct, but shallow
+		productPool("A", "B", 1_000_000, 1_000_000), // deep path through B
+		productPool("B", "C", 1_000_000, 1_000_000),
+		productPool("A-B", "C", 1_000_000, 10_000_000), // pool share assets are never routed through
+	}
+	in := ltypes.NewBalance("A", int64(500))
+
+	route, err := types.NewRouter(pools, nil, 2).BestRoute(in, "C")
+	require.NoError(err)
+	require.Len(route.Hops, 2)
+	require.Equal("A-B", route.Hops[0].PoolID)
+	require.Equal("B-C", route.Hops[1].PoolID)
+	require.Equal(route.Hops[0].AmountOut, route.Hops[1].AmountIn)
+	require.Equal(route.Hops[1].AmountOut, route.AmountOut)
+	require.Equal("C", route.AmountOut.Asset)
+	require.Equal("A", route.Hops[0].Fee.Asset)
+
+	// a single hop limit only allows the direct pool
+	route, err = types.NewRouter(pools, nil, 1).BestRoute(in, "C")
+	require.NoError(err)
+	require.Len(route.Hops, 1)
+	require.Equal("A-C", route.Hops[0].PoolID)
+
+	_, err = types.NewRouter(pools, nil, 2).BestRoute(in, "A-B")
+	require.ErrorIs(err, errors.ErrNoValidSwapPath)
+	_, err = types.NewRouter(pools, nil, 2).BestRoute(in, "D")
+	require.ErrorIs(err, errors.ErrNoValidSwapPath)
+	_, err = types.NewRouter(pools, nil, 2).BestRoute(ltypes.NewBalance("A", int64(0)), "C")
+	require.ErrorIs(err, errors.ErrAmountCannotBeZero)
+}
+
+func TestRouter_CanTrade(t *testing.T) {
+	require := require.New(t)
+	pools := []*types.Pool{
+		productPool("A", "C", 1_000, 1_000),
+		productPool("A", "B", 1_000_000, 1_000_000),
+		productPool("B", "C", 1_000_000, 1_000_000),
+	}
+
+	ad := &helpers.AssetData{}
+	for id, canTrade := range map[string]bool{"A": true, "B": false, "C": true} {
+		require.NoError(ad.RegisterAsset(id, 6, 0, 0, false, false, canTrade, false, false, false, nil))
+	}
+
+	route, err := types.NewRouter(pools, ad, 2).BestRoute(ltypes.NewBalance("A", int64(500)), "C")
+	require.NoError(err)
+	require.Len(route.Hops, 1)
+	require.Equal("A-C", route.Hops[0].PoolID)
+
+	_, err = types.NewRouter(pools, ad, 2).BestRoute(ltypes.NewBalance("A", int64(500)), "B")
+	require.ErrorIs(err, errors.ErrNoValidSwapPath)
+}
@@ -0,0 +1,284 @@
+package types
+
+import (
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/govalues/decimal"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/helpers"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/math"
+	mdecimal "github.com/dora-network/dora-service-utils/math/decimal"
+)
+
+// Settlement describes the settlement of a yield pool at maturity.
+type Settlement struct {
+	PoolID string `json:"pool_id"`
+	// SettledAt is the unix time the pool was settled at
+	SettledAt int64 `json:"settled_at"`
+	// BondsRedeemed is the pool's base reserve, redeemed at par
+	BondsRedeemed types.Amount `json:"bonds_redeemed"`
+	// Redemption is the amount of the quote asset the bonds were redeemed for
+	Redemption types.Amount `json:"redemption"`
+	// Proceeds is the pool's quote reserve after redemption, which is shared by the pool's shares
+	Proceeds types.Amount `json:"proceeds"`
+	// Shares is the number of pool shares at settlement
+	Shares uint64 `json:"shares"`
+	// Payouts are the amounts of the quote asset paid to each share holder, see DistributeSettlement
+	Payouts map[string]types.Amount `json:"payouts"`
+	// ModulePayout is the amount of the quote asset paid for the shares the module holds, see SettleLending
+	ModulePayout types.Amount `json:"module_payout"`
+}
+
+// SettlementReason is the reason of the journal entries made by SettleLending.
+const SettlementReason = "pool_settlement"
+
+// SettleAt settles a yield pool at or after its maturity. The pool's base reserve, which must be a bond, is
+// redeemed at par for the quote asset, which must be a currency, using the bond's maturity payment.
+// The pool keeps the proceeds, which its shares are redeemed for by RemoveLiquidity, see DistributeSettlement.
+// Once settled, the pool no longer swaps or takes liquidity. Pool is mutated, and left unchanged on error.
+func (p *Pool) SettleAt(assetData helpers.AssetData, now time.Time) (*Settlement, error) {
+	if p.Kind() != PoolKindYield {
+		return nil, errors.ErrInvalidPoolType
+	}
+	if p.SettledAt != 0 {
+		return nil, errors.ErrPoolSettled
+	}
+	if !p.Matured(now) {
+		return nil, errors.ErrPoolNotMatured
+	}
+	if !assetData.IsBond(p.BaseAsset) || !assetData.IsCurrency(p.QuoteAsset) {
+		return nil, errors.Data("SettleAt: pool %s is not a bond and currency pool", p.PoolID)
+	}
+	maturity, err := assetData.MaturityPayment(p.BaseAsset)
+	if err != nil {
+		return nil, errors.Wrap(errors.InvalidDataErr, err, "SettleAt")
+	}
+	redemption, err := redeemAtPar(assetData, p.BaseAsset, p.QuoteAsset, p.AmountBase, maturity.Yield)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *p
+	updated.AmountBase = 0
+	if err = updated.addReserve(p.QuoteAsset, redemption); err != nil {
+		return nil, err
+	}
+	updated.SettledAt = now.Unix()
+	updated.Sequence++
+
+	settlement := &Settlement{
+		PoolID:        p.PoolID,
+		SettledAt:     updated.SettledAt,
+		BondsRedeemed: types.NewAmount(p.BaseAsset, p.AmountBase),
+		Redemption:    types.NewAmount(p.QuoteAsset, redemption),
+		Proceeds:      types.NewAmount(p.QuoteAsset, updated.AmountQuote),
+		Shares:        updated.AmountShares,
+		Payouts:       map[string]types.Amount{},
+	}
+	*p = updated
+	return settlement, nil
+}
+
+// DistributeSettlement redeems share holders' shares of a settled pool for their part of its proceeds, recording
+// each payout in the settlement. Holders are paid in order of their IDs, and payouts are rounded down, so any
+// remainder stays in the pool. Pool is mutated, and left unchanged on error.
+func (p *Pool) DistributeSettlement(settlement *Settlement, holders map[string]uint64) error {
+	if p.SettledAt == 0 || settlement.PoolID != p.PoolID {
+		return errors.Data("DistributeSettlement: pool %s is not settled", p.PoolID)
+	}
+	ids := make([]string, 0, len(holders))
+	for id := range holders {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	updated := *p
+	payouts := make(map[string]types.Amount, len(holders))
+	for _, id := range ids {
+		if holders[id] == 0 {
+			continue
+		}
+		amountsOut, err := updated.RemoveLiquidity(types.NewAmount(p.PoolID, holders[id]))
+		if err != nil {
+			return err
+		}
+		for _, a := range amountsOut {
+			if a.AssetID == p.QuoteAsset {
+				payouts[id] = a
+			}
+		}
+	}
+	*p = updated
+	for id, a := range payouts {
+		settlement.Payouts[id] = a
+	}
+	return nil
+}
+
+// SettleLending redeems the shares of a settled pool which the module holds, and moves the module's lending of the
+// pool's shares to the quote asset they are redeemed for, since the shares can no longer be added. The module's
+// shares are redeemed like holders' shares, see DistributeSettlement, so it should be called after it. Users'
+// debts of shares become debts of what the shares were worth at settlement, rounded up, and suppliers of shares are then
+// supplying what the module was paid for its shares plus those debts, in proportion to the shares they supplied.
+// Their parts are rounded down, and the remainder goes to the first supplier by ID, so the module stays in balance.
+// Positions must contain every user who supplies or owes the pool's shares. Returns the journal entry, nil if the
+// module lends none of the pool's shares, which the caller applies to the positions and module, see
+// types.JournalEntry.Apply. Pool is mutated, and left unchanged on error.
+func (p *Pool) SettleLending(
+	settlement *Settlement,
+	module *types.Module,
+	positions map[string]*types.Position,
+) (*types.JournalEntry, error) {
+	if p.SettledAt == 0 || settlement.PoolID != p.PoolID {
+		return nil, errors.Data("SettleLending: pool %s is not settled", p.PoolID)
+	}
+	if module.Virtual.AmountOf(p.PoolID) != 0 {
+		return nil, errors.Data("SettleLending: pool %s shares are virtually borrowed", p.PoolID)
+	}
+	ids := make([]string, 0, len(positions))
+	for id := range positions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	updated := *p
+	var postings []types.Posting
+	post := func(userID string, account types.Account, assetID string, amount int64) {
+		if amount != 0 {
+			postings = append(postings, types.Posting{UserID: userID, Account: account, AssetID: assetID, Amount: amount})
+		}
+	}
+
+	// the module redeems the shares it holds
+	var payout uint64
+	if held := module.Balance.AmountOf(p.PoolID); held > 0 {
+		amountsOut, err := updated.RemoveLiquidity(types.NewAmount(p.PoolID, uint64(held)))
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range amountsOut {
+			if a.AssetID == p.QuoteAsset {
+				payout = a.Amount
+			}
+		}
+		post("", types.AccountModuleBalance, p.PoolID, -held)
+		post("", types.AccountExternal, p.PoolID, held)
+		post("", types.AccountExternal, p.QuoteAsset, -int64(payout))
+		post("", types.AccountModuleBalance, p.QuoteAsset, int64(payout))
+	}
+
+	// debts of shares become debts of what the shares were worth at settlement, rounded up
+	supplied := new(big.Int)
+	owed := new(big.Int).SetUint64(payout)
+	for _, id := range ids {
+		debt := positions[id].Debt(p.PoolID)
+		supplied.Add(supplied, big.NewInt(max(0, positions[id].Supplied.AmountOf(p.PoolID))))
+		if debt == 0 {
+			continue
+		}
+		value, err := settlement.valueUp(uint64(debt))
+		if err != nil {
+			return nil, err
+		}
+		owed.Add(owed, new(big.Int).SetUint64(value))
+		post(id, types.AccountOwned, p.PoolID, debt)
+		post("", types.AccountModuleBorrowed, p.PoolID, -debt)
+		post(id, types.AccountOwned, p.QuoteAsset, -int64(value))
+		post("", types.AccountModuleBorrowed, p.QuoteAsset, int64(value))
+	}
+	if !owed.IsInt64() {
+		return nil, errors.Data("SettleLending: pool %s lending is too large", p.PoolID)
+	}
+
+	// suppliers share what the module was paid and is owed
+	if supplied.Sign() == 0 {
+		if owed.Sign() != 0 {
+			return nil, errors.Data("SettleLending: pool %s shares are lent without being supplied", p.PoolID)
+		}
+		*p = updated
+		return nil, nil
+	}
+	remainder := owed.Int64()
+	parts := make(map[string]int64, len(ids))
+	for _, id := range ids {
+		shares := max(0, positions[id].Supplied.AmountOf(p.PoolID))
+		if shares == 0 {
+			continue
+		}
+		parts[id] = math.DivI(math.Mul(owed, big.NewInt(shares)), supplied, false).Int64()
+		remainder -= parts[id]
+	}
+	for _, id := range ids {
+		shares := max(0, positions[id].Supplied.AmountOf(p.PoolID))
+		if shares == 0 {
+			continue
+		}
+		post(id, types.AccountSupplied, p.PoolID, -shares)
+		post("", types.AccountModuleSupplied, p.PoolID, shares)
+		post(id, types.AccountSupplied, p.QuoteAsset, parts[id]+remainder)
+		post("", types.AccountModuleSupplied, p.QuoteAsset, -(parts[id] + remainder))
+		remainder = 0
+	}
+
+	entry, err := types.NewJournalEntry(SettlementReason, p.SettledAt, postings...)
+	if err != nil {
+		return nil, err
+	}
+	settlement.ModulePayout = types.NewAmount(p.QuoteAsset, payout)
+	*p = updated
+	return entry, nil
+}
+
+// valueUp returns the amount of the quote asset an amount of a settled pool's shares was worth at settlement,
+// rounded up.
+func (s *Settlement) valueUp(shares uint64) (uint64, error) {
+	if s.Shares == 0 {
+		return 0, errors.Data("settlement of pool %s has no shares", s.PoolID)
+	}
+	value := math.DivI(
+		math.Mul(new(big.Int).SetUint64(shares), new(big.Int).SetUint64(s.Proceeds.Amount)),
+		new(big.Int).SetUint64(s.Shares),
+		true,
+	)
+	if !value.IsInt64() {
+		return 0, errors.Data("settlement of pool %s: %d shares are worth too much", s.PoolID, shares)
+	}
+	return value.Uint64(), nil
+}
+
+// redeemAtPar returns the amount of a currency paid for an amount of a bond, at a yield in dollars per whole bond,
+// rounded down.
+func redeemAtPar(assetData helpers.AssetData, bondID, currencyID string, amount uint64, yield float64) (uint64, error) {
+	bondDecimals, err := assetData.Decimals(bondID)
+	if err != nil {
+		return 0, errors.Wrap(errors.InvalidDataErr, err, "redeemAtPar")
+	}
+	currencyDecimals, err := assetData.Decimals(currencyID)
+	if err != nil {
+		return 0, errors.Wrap(errors.InvalidDataErr, err, "redeemAtPar")
+	}
+	yieldD, err := decimal.NewFromFloat64(yield)
+	if err != nil || yieldD.IsNeg() {
+		return 0, errors.Data("redeemAtPar: invalid yield %v for %s", yield, bondID)
+	}
+	amountD, err := mdecimal.FromUint64(amount)
+	if err != nil {
+		return 0, err
+	}
+	redemption, err := amountD.Mul(yieldD)
+	if err != nil {
+		return 0, err
+	}
+	scale, err := decimal.Ten.PowInt(currencyDecimals - bondDecimals)
+	if err != nil {
+		return 0, err
+	}
+	if redemption, err = redemption.Mul(scale); err != nil {
+		return 0, err
+	}
+	return mdecimal.FloorUint64(redemption)
+}
@@ -0,0 +1,146 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/helpers"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+)
+
+// settlementAssetData registers "b" as a bond with 3 decimals maturing at 1.02, and "q" as a currency with 6.
+func settlementAssetData(t *testing.T, maturity time.Time) helpers.AssetData {
+	var ad helpers.AssetData
+	require.NoError(t, ad.RegisterAsset("b", 3, 0, 0, false, true, true, false, false, false, []*helpers.Coupon{
+		{Date: maturity.Format(time.RFC1123), Yield: 1.02, IsMaturity: true},
+	}))
+	require.NoError(t, ad.RegisterAsset("q", 6, 0, 0, true, false, true, false, false, false, nil))
+	return ad
+}
+
+func TestPool_SettleAt(t *testing.T) {
+	require := require.New(t)
+
+	pool := goldenPool(false, 1_000_000, 950_000, "1.02", "0.5")
+	pool.AmountShares = 1_950_000
+	maturity := time.Unix(pool.MaturityAt, 0).UTC()
+	ad := settlementAssetData(t, maturity)
+
+	// not before maturity
+	_, err := pool.SettleAt(ad, goldenNow)
+	require.ErrorIs(err, errors.ErrPoolNotMatured)
+
+	// swaps are frozen at maturity
+	_, err = pool.ExecuteSwapAt(ltypes.NewBalance("q", int64(1_000)), nil, time.Time{}, maturity)
+	require.ErrorIs(err, errors.ErrPoolMatured)
+
+	before := *pool
+	settlement, err := pool.SettleAt(ad, maturity)
+	require.NoError(err)
+	require.Empty(pool.CheckInvariants(maturity))
+	require.Empty(types.CheckTransition(&before, pool, maturity))
+
+	// 1,000 whole bonds at 1.02 each are 1,020 whole currency
+	require.Equal(ltypes.NewAmount("b", 1_000_000), settlement.BondsRedeemed)
+	require.Equal(ltypes.NewAmount("q", 1_020_000_000), settlement.Redemption)
+	require.Equal(ltypes.NewAmount("q", 1_020_950_000), settlement.Proceeds)
+	require.Equal(uint64(1_950_000), settlement.Shares)
+	require.Equal(uint64(0), pool.AmountBase)
+	require.Equal(uint64(1_020_950_000), pool.AmountQuote)
+	require.Equal(maturity.Unix(), pool.SettledAt)
+	require.Equal(before.Sequence+1, pool.Sequence)
+
+	// settled pools no longer swap, take liquidity, or settle again
+	_, err = pool.ExecuteSwapAt(ltypes.NewBalance("q", int64(1_000)), nil, time.Time{}, maturity)
+	require.ErrorIs(err, errors.ErrPoolSettled)
+	_, _, err = pool.AddLiquidityQuote(ltypes.NewAmount("q", 1_000))
+	require.ErrorIs(err, errors.ErrPoolSettled)
+	_, err = pool.SettleAt(ad, maturity)
+	require.ErrorIs(err, errors.ErrPoolSettled)
+
+	// proceeds are paid pro-rata, rounded down, and the rest stays in the pool
+	err = pool.DistributeSettlement(settlement, map[string]uint64{"alice": 650_000, "bob": 1_300_000 - 1})
+	require.NoError(err)
+	require.Equal(ltypes.NewAmount("q", 340_316_666), settlement.Payouts["alice"])
+	require.Equal(ltypes.NewAmount("q", 680_632_810), settlement.Payouts["bob"])
+	require.Equal(uint64(1), pool.AmountShares)
+	require.Equal(uint64(1_020_950_000-340_316_666-680_632_810), pool.AmountQuote)
+	require.Empty(pool.CheckInvariants(maturity))
+
+	// product pools do not mature
+	_, err = productPool("b", "q", 1_000, 1_000).SettleAt(ad, maturity)
+	require.ErrorIs(err, errors.ErrInvalidPoolType)
+}
+
+func TestPool_SettleLending(t *testing.T) {
+	require := require.New(t)
+
+	pool := goldenPool(false, 1_000, 980_001, "1.02", "0.5")
+	pool.AmountShares = 2_000
+	maturity := time.Unix(pool.MaturityAt, 0).UTC()
+	ad := settlementAssetData(t, maturity)
+
+	// one owns 1,000 shares, two and three supply 1,000, of which four borrowed 300 and took them out of the ledger
+	positions := map[string]*ltypes.Position{}
+	for _, id := range []string{"one", "two", "three", "four"} {
+		positions[id] = ltypes.InitialPosition(id)
+	}
+	positions["one"].Owned = ltypes.NewBalances(pool.PoolID, 1_000)
+	positions["two"].Supplied = ltypes.NewBalances(pool.PoolID, 600)
+	positions["three"].Supplied = ltypes.NewBalances(pool.PoolID, 400)
+	positions["four"].Owned = ltypes.NewBalances(pool.PoolID, -300)
+	module := ltypes.InitialModule()
+	module.Balance = ltypes.NewBalances(pool.PoolID, 700)
+	module.Supplied = ltypes.NewBalances(pool.PoolID, 1_000)
+	module.Borrowed = ltypes.NewBalances(pool.PoolID, 300)
+
+	// not before settlement
+	_, err := pool.SettleLending(&types.Settlement{PoolID: pool.PoolID}, module, positions)
+	require.Error(err)
+
+	// each share is worth 1,000.0005 of the quote asset
+	settlement, err := pool.SettleAt(ad, maturity)
+	require.NoError(err)
+	require.Equal(ltypes.NewAmount("q", 2_000_001), settlement.Proceeds)
+	require.NoError(pool.DistributeSettlement(settlement, map[string]uint64{"one": 1_000}))
+	require.Equal(ltypes.NewAmount("q", 1_000_000), settlement.Payouts["one"])
+
+	entry, err := pool.SettleLending(settlement, module, positions)
+	require.NoError(err)
+	require.Equal(types.SettlementReason, entry.Reason)
+	require.Equal(ltypes.NewAmount("q", 700_000), settlement.ModulePayout)
+	// the shares outside the ledger are still worth what four owes
+	require.Equal(uint64(300), pool.AmountShares)
+	require.Equal(uint64(300_001), pool.AmountQuote)
+	require.NoError(entry.Apply(positions, module))
+
+	// four owes what the shares were worth, rounded up, and suppliers share it with the module's payout, the
+	// remainder going to three
+	require.Equal(int64(-300_001), positions["four"].Owned.AmountOf("q"))
+	require.Equal(int64(600_000), positions["two"].Supplied.AmountOf("q"))
+	require.Equal(int64(400_001), positions["three"].Supplied.AmountOf("q"))
+	for _, p := range positions {
+		require.Zero(p.Supplied.AmountOf(pool.PoolID), p.UserID)
+		require.LessOrEqual(int64(0), p.Owned.AmountOf(pool.PoolID), p.UserID)
+	}
+	require.Equal(int64(700_000), module.Balance.AmountOf("q"))
+	require.Equal(int64(1_000_001), module.Supplied.AmountOf("q"))
+	require.Equal(int64(300_001), module.Borrowed.AmountOf("q"))
+	for _, bals := range []*ltypes.Balances{module.Balance, module.Supplied, module.Borrowed} {
+		require.Zero(bals.AmountOf(pool.PoolID))
+	}
+	all := make([]*ltypes.Position, 0, len(positions))
+	for _, p := range positions {
+		all = append(all, p)
+	}
+	require.True(ltypes.ReconcileModule(module, all, maturity).OK())
+
+	// nothing is left to settle
+	entry, err = pool.SettleLending(settlement, module, positions)
+	require.NoError(err)
+	require.Nil(entry)
+}
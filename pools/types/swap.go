@@ -0,0 +1,94 @@
+package types
+
+import (
+	"time"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	"github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/math"
+)
+
+// SwapReceipt describes an executed swap.
+type SwapReceipt struct {
+	PoolID    string         `json:"pool_id"`
+	AmountIn  *types.Balance `json:"amount_in"`
+	AmountOut *types.Balance `json:"amount_out"`
+	Fee       *types.Balance `json:"fee"`
+	// Sequence of the pool after the swap.
+	Sequence uint64 `json:"sequence"`
+}
+
+// ExecuteSwap swaps balanceIn for the pool's other asset. Pool is mutated.
+// The swap fails if it would give less than minOut (nil skips the check), or if deadline has passed
+// (zero skips the check). The fee is kept out of the reserves and credited to the fees collected.
+// The pool is left unchanged on error, and its Sequence is bumped exactly once on success.
+// Yield pools stop swapping at maturity, see Matured.
+func (p *Pool) ExecuteSwap(balanceIn, minOut *types.Balance, deadline time.Time) (*SwapReceipt, error) {
+	return p.ExecuteSwapAt(balanceIn, minOut, deadline, time.Now())
+}
+
+// ExecuteSwapAt is ExecuteSwap at a specific time, which is used for both the deadline and the swap itself.
+func (p *Pool) ExecuteSwapAt(balanceIn, minOut *types.Balance, deadline, now time.Time) (*SwapReceipt, error) {
+	if balanceIn == nil {
+		return nil, errors.ErrSwapInputInNil
+	}
+	if !deadline.IsZero() && now.After(deadline) {
+		return nil, errors.ErrSwapDeadlineExceeded
+	}
+	if p.SettledAt != 0 {
+		return nil, errors.ErrPoolSettled
+	}
+	if p.Matured(now) {
+		return nil, errors.ErrPoolMatured
+	}
+	balanceOut, balanceFee, err := p.SimulateSwapAt(balanceIn, now)
+	if err != nil {
+		return nil, err
+	}
+	if minOut != nil {
+		if minOut.Asset != balanceOut.Asset {
+			return nil, errors.ErrPoolAssetsMismatch
+		}
+		if balanceOut.Amount < minOut.Amount {
+			return nil, errors.NewNotEnoughAmountOut(minOut.String(), balanceOut.String())
+		}
+	}
+	if balanceOut.IsZero() {
+		return nil, errors.ErrNotEnoughAmountIn
+	}
+
+	// Apply the swap to a copy, so a failure leaves the pool untouched
+	updated := *p
+	amountIn, err := math.CheckedSubU64(balanceIn.Amount, balanceFee.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if balanceIn.Asset == p.BaseAsset {
+		if updated.AmountBase, err = math.CheckedAddU64(p.AmountBase, amountIn); err != nil {
+			return nil, err
+		}
+		if updated.AmountQuote, err = math.CheckedSubU64(p.AmountQuote, balanceOut.Amount); err != nil {
+			return nil, errors.ErrNotEnoughPoolReserves
+		}
+	} else {
+		if updated.AmountQuote, err = math.CheckedAddU64(p.AmountQuote, amountIn); err != nil {
+			return nil, err
+		}
+		if updated.AmountBase, err = math.CheckedSubU64(p.AmountBase, balanceOut.Amount); err != nil {
+			return nil, errors.ErrNotEnoughPoolReserves
+		}
+	}
+	// AddAccumulatedFees bumps the sequence
+	if err = updated.AddAccumulatedFees(balanceFee); err != nil {
+		return nil, err
+	}
+	*p = updated
+
+	return &SwapReceipt{
+		PoolID:    p.PoolID,
+		AmountIn:  balanceIn.Copy(),
+		AmountOut: balanceOut,
+		Fee:       balanceFee,
+		Sequence:  p.Sequence,
+	}, nil
+}
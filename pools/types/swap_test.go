@@ -0,0 +1,42 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func TestPool_ExecuteSwap(t *testing.T) {
+	require := require.New(t)
+	pool := productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000)
+	pool.Sequence = 3
+	in := ltypes.NewBalance(consts.StableID, int64(10_000))
+
+	expectedOut, expectedFee, err := pool.SimulateSwap(in)
+	require.NoError(err)
+
+	// slippage and deadline checks leave the pool untouched
+	before := *pool
+	_, err = pool.ExecuteSwap(in, ltypes.NewBalance(consts.BondID, int64(expectedOut.Amount+1)), time.Time{})
+	require.ErrorContains(err, errors.ErrNotEnoughAmountOut.Error())
+	_, err = pool.ExecuteSwap(in, nil, time.Now().Add(-time.Second))
+	require.ErrorIs(err, errors.ErrSwapDeadlineExceeded)
+	_, err = pool.ExecuteSwap(in, ltypes.NewBalance(consts.StableID, int64(1)), time.Time{})
+	require.ErrorIs(err, errors.ErrPoolAssetsMismatch)
+	require.Equal(before, *pool)
+
+	receipt, err := pool.ExecuteSwap(in, expectedOut, time.Now().Add(time.Minute))
+	require.NoError(err)
+	require.Equal(expectedOut, receipt.AmountOut)
+	require.Equal(expectedFee, receipt.Fee)
+	require.Equal(uint64(4), receipt.Sequence)
+	require.Equal(uint64(4), pool.Sequence)
+	require.Equal(before.AmountQuote+in.Amount-expectedFee.Amount, pool.AmountQuote)
+	require.Equal(before.AmountBase-expectedOut.Amount, pool.AmountBase)
+	require.Equal(expectedFee.Amount, pool.FeesCollectedQuote)
+}
@@ -0,0 +1,80 @@
+package types
+
+import (
+	"sort"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"github.com/dora-network/dora-service-utils/errors"
+)
+
+// PriceObservation records a pool's price when the pool changes. Observations accumulate price × seconds,
+// so the time-weighted average price between any two observations is the difference of their cumulative
+// prices divided by the time between them.
+type PriceObservation struct {
+	// Time of the observation, in unix seconds
+	Time int64 `json:"time"`
+	// Price of the pool from Time until the next observation, see Pool.Price
+	Price float64 `json:"price"`
+	// Cumulative is the sum of price × seconds from the pool's first observation until Time
+	Cumulative float64 `json:"cumulative"`
+}
+
+func (o *PriceObservation) MarshalBinary() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+func (o *PriceObservation) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, o)
+}
+
+// Observe returns the pool's price observation at a specific time, following the previous observation
+// (nil for the pool's first). The pool should already include the change being observed.
+// Observations never go back in time: if now is before the previous observation, due to clock skew between
+// servers, the observation is made at the previous observation's time instead.
+// Error ErrPoolHasNoPrice if the pool's reserves are too small to price it, or it is a matured yield pool.
+func (p *Pool) Observe(previous *PriceObservation, now time.Time) (*PriceObservation, error) {
+	if p.AmountBase < swapSimulateDivisor || p.AmountQuote < swapSimulateDivisor || p.Matured(now) {
+		return nil, errors.ErrPoolHasNoPrice
+	}
+	price, err := p.PriceAt(now)
+	if err != nil {
+		return nil, err
+	}
+	o := &PriceObservation{Time: now.Unix(), Price: price}
+	if previous != nil {
+		o.Time = max(o.Time, previous.Time)
+		o.Cumulative = previous.CumulativeAt(o.Time)
+	}
+	return o, nil
+}
+
+// CumulativeAt returns the cumulative price at a time after the observation, assuming the price did not change.
+func (o *PriceObservation) CumulativeAt(at int64) float64 {
+	return o.Cumulative + o.Price*float64(at-o.Time)
+}
+
+// TWAP returns the time-weighted average price from one time to another, which must be later, given a pool's
+// observations sorted by time. The price after the last observation is assumed not to have changed.
+// Error ErrNotEnoughPriceHistory if the first observation is after from.
+func TWAP(observations []PriceObservation, from, to time.Time) (float64, error) {
+	// observations are in whole seconds
+	start, end := from.Unix(), to.Unix()
+	if start >= end {
+		return 0, errors.ErrFromMustBeSmallerThanTo
+	}
+	// the observation in effect at a time is the last one at or before it
+	at := func(t int64) *PriceObservation {
+		i := sort.Search(len(observations), func(i int) bool { return observations[i].Time > t })
+		if i == 0 {
+			return nil
+		}
+		return &observations[i-1]
+	}
+	first, last := at(start), at(end)
+	if first == nil {
+		return 0, errors.ErrNotEnoughPriceHistory
+	}
+	return (last.CumulativeAt(end) - first.CumulativeAt(start)) / float64(end-start), nil
+}
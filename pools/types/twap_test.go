@@ -0,0 +1,78 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/errors"
+	ltypes "github.com/dora-network/dora-service-utils/ledger/types"
+	"github.com/dora-network/dora-service-utils/pools/types"
+	"github.com/dora-network/dora-service-utils/testing/consts"
+)
+
+func TestPool_Observe(t *testing.T) {
+	require := require.New(t)
+	pool := productPool(consts.BondID, consts.StableID, 1_000_000, 1_000_000)
+	spot, err := pool.PriceAt(goldenNow)
+	require.NoError(err)
+
+	first, err := pool.Observe(nil, goldenNow)
+	require.NoError(err)
+	require.Equal(types.PriceObservation{Time: goldenNow.Unix(), Price: spot}, *first)
+
+	_, err = pool.ExecuteSwapAt(ltypes.NewBalance(consts.StableID, int64(100_000)), nil, time.Time{}, goldenNow)
+	require.NoError(err)
+	second, err := pool.Observe(first, goldenNow.Add(time.Minute))
+	require.NoError(err)
+	// buying base with quote makes base scarcer, and the price is in base per quote
+	require.Less(second.Price, spot)
+	require.InDelta(60*spot, second.Cumulative, 1e-9)
+
+	// observations never go back in time
+	skewed, err := pool.Observe(second, goldenNow)
+	require.NoError(err)
+	require.Equal(second.Time, skewed.Time)
+	require.Equal(second.Cumulative, skewed.Cumulative)
+
+	_, err = productPool(consts.BondID, consts.StableID, 0, 0).Observe(nil, goldenNow)
+	require.Equal(errors.ErrPoolHasNoPrice, err)
+	_, err = productPool(consts.BondID, consts.StableID, 1_000_000, 99).Observe(nil, goldenNow)
+	require.Equal(errors.ErrPoolHasNoPrice, err)
+}
+
+func TestTWAP(t *testing.T) {
+	require := require.New(t)
+	at := func(seconds int64) time.Time { return goldenNow.Add(time.Duration(seconds) * time.Second) }
+	observations := []types.PriceObservation{
+		{Time: at(0).Unix(), Price: 1, Cumulative: 0},
+		{Time: at(100).Unix(), Price: 3, Cumulative: 100},
+		{Time: at(110).Unix(), Price: 2, Cumulative: 130},
+	}
+
+	for _, tc := range []struct {
+		from, to int64
+		want     float64
+	}{
+		{0, 100, 1},
+		{50, 100, 1},
+		{100, 110, 3},
+		{90, 110, 2},
+		{0, 110, 130.0 / 110},
+		// the last price holds after the last observation
+		{110, 200, 2},
+		{100, 120, 2.5},
+	} {
+		got, err := types.TWAP(observations, at(tc.from), at(tc.to))
+		require.NoError(err)
+		require.InDelta(tc.want, got, 1e-12, "%d to %d", tc.from, tc.to)
+	}
+
+	_, err := types.TWAP(observations, at(-1), at(100))
+	require.ErrorIs(err, errors.ErrNotEnoughPriceHistory)
+	_, err = types.TWAP(nil, at(0), at(100))
+	require.ErrorIs(err, errors.ErrNotEnoughPriceHistory)
+	_, err = types.TWAP(observations, at(100), at(100))
+	require.ErrorIs(err, errors.ErrFromMustBeSmallerThanTo)
+}
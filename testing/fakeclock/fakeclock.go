@@ -0,0 +1,39 @@
+package fakeclock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a clock.Clock which only moves when told to. Clock is safe for concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// New creates a Clock stopped at now.
+func New(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time the clock is stopped at.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set stops the clock at now.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d, and returns the new time.
+func (c *Clock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
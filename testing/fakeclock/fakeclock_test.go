@@ -0,0 +1,26 @@
+package fakeclock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dora-network/dora-service-utils/clock"
+	"github.com/dora-network/dora-service-utils/testing/fakeclock"
+)
+
+func TestClock(t *testing.T) {
+	require := require.New(t)
+	start := time.Date(2024, 2, 28, 12, 0, 0, 0, time.UTC)
+
+	var c clock.Clock = fakeclock.New(start)
+	require.Equal(start, c.Now())
+
+	fc := c.(*fakeclock.Clock)
+	require.Equal(time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), fc.Advance(24*time.Hour))
+	require.Equal(time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), c.Now())
+
+	fc.Set(start)
+	require.Equal(start, c.Now())
+}